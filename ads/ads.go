@@ -0,0 +1,275 @@
+// Package ads shows interstitial and banner ads through a pluggable
+// provider. The Manager decides when ads can be shown: it caps the
+// frequency of the interstitials and shows nothing if the user is
+// entitled to no ads.
+//
+// Providers report their results asynchronously on a channel. The
+// application passes the events to Manager.Handle, usually from its
+// render loop, and the Manager calls the callbacks from there.
+package ads
+
+import (
+	"errors"
+	"time"
+)
+
+// Format is the format of an ad.
+type Format int
+
+const (
+	// A full screen ad shown between two moments of the game
+	Interstitial Format = iota
+
+	// A strip shown at the bottom of the screen
+	Banner
+
+	numFormats
+)
+
+func (f Format) String() string {
+	switch f {
+	case Interstitial:
+		return "interstitial"
+	case Banner:
+		return "banner"
+	}
+	return "unknown"
+}
+
+// EventKind is what happened to an ad.
+type EventKind int
+
+const (
+	// The ad is ready to be shown
+	Loaded EventKind = iota
+
+	// The ad is on the screen
+	Shown
+
+	// The ad was closed or hidden
+	Closed
+
+	// Loading or showing the ad failed
+	Failed
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case Loaded:
+		return "loaded"
+	case Shown:
+		return "shown"
+	case Closed:
+		return "closed"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Event is reported by the providers.
+type Event struct {
+	Format Format
+	Kind   EventKind
+
+	// Why the ad failed
+	Err error
+}
+
+// ErrUnsupported is reported by providers for the formats they
+// can't show.
+var ErrUnsupported = errors.New("ads: format not supported by the provider")
+
+// Provider loads and shows the ads. Its methods must not block, the
+// results are reported on the Events channel.
+type Provider interface {
+	Load(format Format)
+	Show(format Format)
+	Hide(format Format)
+	Events() <-chan Event
+}
+
+// Config configures the frequency of the interstitials.
+type Config struct {
+	// The minimum time between two interstitials
+	MinInterval time.Duration
+
+	// The maximum number of interstitials shown in a session, 0
+	// means no limit
+	MaxPerSession int
+}
+
+// DefaultConfig returns an interval of three minutes and at most
+// five interstitials per session.
+func DefaultConfig() Config {
+	return Config{
+		MinInterval:   3 * time.Minute,
+		MaxPerSession: 5,
+	}
+}
+
+// Manager requests the ads to a provider. It must be used from a
+// single goroutine.
+type Manager struct {
+	// The callbacks, called by Handle. They can be nil.
+	OnLoad  func(Format)
+	OnShow  func(Format)
+	OnClose func(Format)
+	OnFail  func(Format, error)
+
+	provider Provider
+	config   Config
+	noAds    bool
+
+	loaded, showing, requested [numFormats]bool
+
+	// The banner stays on the screen until hidden
+	wantBanner bool
+
+	impressions int
+	lastShown   time.Time
+}
+
+// NewManager returns a manager showing the ads of provider.
+func NewManager(provider Provider, config Config) *Manager {
+	return &Manager{provider: provider, config: config}
+}
+
+// Events returns the events of the provider, to be passed to
+// Handle.
+func (m *Manager) Events() <-chan Event {
+	return m.provider.Events()
+}
+
+// SetNoAds sets the entitlement to no ads, hiding the ads shown.
+func (m *Manager) SetNoAds(noAds bool) {
+	m.noAds = noAds
+	if !noAds {
+		if m.wantBanner {
+			m.ShowBanner()
+		}
+		return
+	}
+	for f := Format(0); f < numFormats; f++ {
+		if m.showing[f] {
+			m.provider.Hide(f)
+		}
+		m.requested[f] = false
+	}
+}
+
+// NoAds returns true if the user is entitled to no ads.
+func (m *Manager) NoAds() bool {
+	return m.noAds
+}
+
+// Preload loads an ad to show it later without waiting.
+func (m *Manager) Preload(format Format) {
+	if !m.noAds && !m.loaded[format] {
+		m.provider.Load(format)
+	}
+}
+
+// CanShowInterstitial returns true if an interstitial can be shown
+// now without exceeding the frequency cap.
+func (m *Manager) CanShowInterstitial() bool {
+	switch {
+	case m.noAds, m.showing[Interstitial], m.requested[Interstitial]:
+		return false
+	case m.config.MaxPerSession > 0 && m.impressions >= m.config.MaxPerSession:
+		return false
+	case !m.lastShown.IsZero() && time.Since(m.lastShown) < m.config.MinInterval:
+		return false
+	}
+	return true
+}
+
+// ShowInterstitial shows an interstitial if the frequency cap
+// allows it. An interstitial not loaded yet is shown as soon as
+// it's loaded. It returns false if the interstitial won't be shown.
+func (m *Manager) ShowInterstitial() bool {
+	if !m.CanShowInterstitial() {
+		return false
+	}
+	m.requested[Interstitial] = true
+	if m.loaded[Interstitial] {
+		m.provider.Show(Interstitial)
+	} else {
+		m.provider.Load(Interstitial)
+	}
+	return true
+}
+
+// ShowBanner shows the banner until HideBanner is called.
+func (m *Manager) ShowBanner() {
+	m.wantBanner = true
+	if m.noAds || m.showing[Banner] || m.requested[Banner] {
+		return
+	}
+	m.requested[Banner] = true
+	if m.loaded[Banner] {
+		m.provider.Show(Banner)
+	} else {
+		m.provider.Load(Banner)
+	}
+}
+
+// HideBanner hides the banner.
+func (m *Manager) HideBanner() {
+	m.wantBanner = false
+	m.requested[Banner] = false
+	if m.showing[Banner] {
+		m.provider.Hide(Banner)
+	}
+}
+
+// Impressions returns the number of interstitials shown in the
+// session.
+func (m *Manager) Impressions() int {
+	return m.impressions
+}
+
+// Handle updates the state of the ads and calls the callbacks.
+func (m *Manager) Handle(e Event) {
+	f := e.Format
+	if f < 0 || f >= numFormats {
+		return
+	}
+	switch e.Kind {
+	case Loaded:
+		m.loaded[f] = true
+		if m.OnLoad != nil {
+			m.OnLoad(f)
+		}
+		if m.requested[f] && !m.noAds {
+			m.provider.Show(f)
+		}
+	case Shown:
+		m.loaded[f] = false
+		m.requested[f] = false
+		m.showing[f] = true
+		if f == Interstitial {
+			m.impressions++
+			m.lastShown = time.Now()
+		}
+		if m.OnShow != nil {
+			m.OnShow(f)
+		}
+	case Closed:
+		m.requested[f] = false
+		m.showing[f] = false
+		if m.OnClose != nil {
+			m.OnClose(f)
+		}
+		if f == Interstitial {
+			// Have the next one ready
+			m.Preload(Interstitial)
+		}
+	case Failed:
+		m.loaded[f] = false
+		m.requested[f] = false
+		if m.OnFail != nil {
+			m.OnFail(f, e.Err)
+		}
+	}
+}
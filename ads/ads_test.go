@@ -0,0 +1,155 @@
+package ads
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestManager(config Config) (*Manager, *Mock) {
+	mock := NewMock()
+	mock.LoadDelay = 0
+	mock.Duration = time.Hour
+	return NewManager(mock, config), mock
+}
+
+// handleUntil passes the events of the provider to the manager until
+// the given one is handled.
+func handleUntil(t *testing.T, m *Manager, format Format, kind EventKind) {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-m.Events():
+			m.Handle(e)
+			if e.Format == format && e.Kind == kind {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no %s %s event", format, kind)
+		}
+	}
+}
+
+// showAndClose shows an interstitial and closes it.
+func showAndClose(t *testing.T, m *Manager, mock *Mock) {
+	if !m.ShowInterstitial() {
+		t.Fatal("the interstitial wasn't shown")
+	}
+	handleUntil(t, m, Interstitial, Shown)
+	if !mock.Close() {
+		t.Fatal("the mock isn't showing the interstitial")
+	}
+	handleUntil(t, m, Interstitial, Closed)
+}
+
+func TestLoadThenShow(t *testing.T) {
+	m, mock := newTestManager(Config{})
+	var loaded, shown []Format
+	m.OnLoad = func(f Format) { loaded = append(loaded, f) }
+	m.OnShow = func(f Format) { shown = append(shown, f) }
+
+	if !m.ShowInterstitial() {
+		t.Fatal("the interstitial wasn't requested")
+	}
+	if mock.Showing(Interstitial) {
+		t.Error("the interstitial was shown before loading")
+	}
+	if m.ShowInterstitial() {
+		t.Error("a second interstitial was requested while loading the first")
+	}
+	handleUntil(t, m, Interstitial, Shown)
+	if !mock.Showing(Interstitial) {
+		t.Error("the interstitial wasn't shown once loaded")
+	}
+	if len(loaded) != 1 || len(shown) != 1 || m.Impressions() != 1 {
+		t.Errorf("got %d loads, %d shows and %d impressions, want 1 each", len(loaded), len(shown), m.Impressions())
+	}
+}
+
+func TestShowPreloaded(t *testing.T) {
+	m, mock := newTestManager(Config{})
+	m.Preload(Interstitial)
+	handleUntil(t, m, Interstitial, Loaded)
+	if mock.Showing(Interstitial) {
+		t.Fatal("a preloaded interstitial was shown before being requested")
+	}
+	m.ShowInterstitial()
+	if !mock.Showing(Interstitial) {
+		t.Error("a preloaded interstitial wasn't shown right away")
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	interval := 50 * time.Millisecond
+	m, mock := newTestManager(Config{MinInterval: interval})
+	showAndClose(t, m, mock)
+	if m.CanShowInterstitial() || m.ShowInterstitial() {
+		t.Error("an interstitial was allowed right after the previous one")
+	}
+	time.Sleep(interval + 10*time.Millisecond)
+	if !m.ShowInterstitial() {
+		t.Error("an interstitial wasn't allowed after the minimum interval")
+	}
+}
+
+func TestMaxPerSession(t *testing.T) {
+	m, mock := newTestManager(Config{MaxPerSession: 2})
+	showAndClose(t, m, mock)
+	showAndClose(t, m, mock)
+	if m.ShowInterstitial() {
+		t.Error("an interstitial was shown over the limit of the session")
+	}
+	if m.Impressions() != 2 || mock.Impressions(Interstitial) != 2 {
+		t.Errorf("got %d impressions, %d by the provider, want 2", m.Impressions(), mock.Impressions(Interstitial))
+	}
+}
+
+func TestNoAds(t *testing.T) {
+	m, mock := newTestManager(Config{})
+	m.ShowBanner()
+	handleUntil(t, m, Banner, Shown)
+
+	m.SetNoAds(true)
+	handleUntil(t, m, Banner, Closed)
+	if mock.Showing(Banner) {
+		t.Error("the banner is still shown with no ads")
+	}
+	if m.ShowInterstitial() {
+		t.Error("an interstitial was requested with no ads")
+	}
+	m.Preload(Interstitial)
+	m.ShowBanner()
+	select {
+	case e := <-m.Events():
+		t.Errorf("the provider got a request with no ads: %s %s", e.Format, e.Kind)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The banner requested comes back without the entitlement
+	m.SetNoAds(false)
+	handleUntil(t, m, Banner, Shown)
+	if !mock.Showing(Banner) {
+		t.Error("the banner wasn't shown again")
+	}
+}
+
+func TestFailure(t *testing.T) {
+	m, mock := newTestManager(Config{})
+	mock.Fail = true
+	var failures int
+	m.OnFail = func(f Format, err error) {
+		if err == nil {
+			t.Error("failed without an error")
+		}
+		failures++
+	}
+	m.ShowInterstitial()
+	handleUntil(t, m, Interstitial, Failed)
+	if failures != 1 || m.Impressions() != 0 {
+		t.Errorf("got %d failures and %d impressions, want 1 and 0", failures, m.Impressions())
+	}
+	mock.Fail = false
+	if !m.ShowInterstitial() {
+		t.Error("the interstitial can't be requested again after a failure")
+	}
+	handleUntil(t, m, Interstitial, Shown)
+}
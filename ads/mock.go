@@ -0,0 +1,122 @@
+package ads
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/remogatto/mandala"
+)
+
+// The number of events the providers buffer
+const eventBufferSize = 16
+
+var errMockFailure = errors.New("ads: mock failure")
+
+// Mock is a provider showing no real ads, to test where and when
+// the application shows them without a device. It logs every
+// impression and lets the application draw a placeholder where the
+// ad would be.
+type Mock struct {
+	// How long loading an ad takes
+	LoadDelay time.Duration
+
+	// How long an interstitial stays on the screen before closing
+	// itself
+	Duration time.Duration
+
+	// Makes loading fail
+	Fail bool
+
+	events chan Event
+
+	mutex       sync.Mutex
+	showing     [numFormats]bool
+	impressions [numFormats]int
+	closeTimer  *time.Timer
+}
+
+// NewMock returns a mock loading ads in half a second and showing
+// interstitials for three seconds.
+func NewMock() *Mock {
+	return &Mock{
+		LoadDelay: 500 * time.Millisecond,
+		Duration:  3 * time.Second,
+		events:    make(chan Event, eventBufferSize),
+	}
+}
+
+// Events returns the results of the requests.
+func (m *Mock) Events() <-chan Event {
+	return m.events
+}
+
+// Load loads an ad after LoadDelay.
+func (m *Mock) Load(format Format) {
+	time.AfterFunc(m.LoadDelay, func() {
+		if m.Fail {
+			m.events <- Event{format, Failed, errMockFailure}
+		} else {
+			m.events <- Event{format, Loaded, nil}
+		}
+	})
+}
+
+// Show shows the placeholder of the ad.
+func (m *Mock) Show(format Format) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.showing[format] {
+		return
+	}
+	m.showing[format] = true
+	m.impressions[format]++
+	mandala.Logf("Mock %s ad impression #%d\n", format, m.impressions[format])
+	if format == Interstitial {
+		m.closeTimer = time.AfterFunc(m.Duration, func() { m.Hide(Interstitial) })
+	}
+	go m.send(Event{format, Shown, nil})
+}
+
+// Hide removes the placeholder of the ad.
+func (m *Mock) Hide(format Format) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.showing[format] {
+		return
+	}
+	m.showing[format] = false
+	if format == Interstitial && m.closeTimer != nil {
+		m.closeTimer.Stop()
+		m.closeTimer = nil
+	}
+	go m.send(Event{format, Closed, nil})
+}
+
+// Close closes the interstitial, as a tap on its close button would.
+// It returns false if no interstitial is shown.
+func (m *Mock) Close() bool {
+	if !m.Showing(Interstitial) {
+		return false
+	}
+	m.Hide(Interstitial)
+	return true
+}
+
+// Showing returns true while the placeholder of the ad is shown.
+func (m *Mock) Showing(format Format) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.showing[format]
+}
+
+// Impressions returns the number of ads of the format shown.
+func (m *Mock) Impressions(format Format) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.impressions[format]
+}
+
+func (m *Mock) send(e Event) {
+	m.events <- e
+}
@@ -0,0 +1,381 @@
+// Package analytics collects events about how the examples are
+// played and sends them in batches to a sink.
+//
+// Events are queued and sent from a goroutine, so tracking them
+// never blocks the render loop. The queue is saved to the storage of
+// the application, so events not sent yet survive restarts. Events
+// can be sampled by name and the user can opt out, which discards
+// the queue.
+package analytics
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/storage"
+)
+
+const (
+	// The keys of the queue and of the opt-out in the storage
+	queueKey      = "analytics.queue"
+	queueVersion  = 1
+	optOutKey     = "analytics.optout"
+	optOutVersion = 1
+
+	// The number of records waiting for the goroutine of the
+	// tracker before new ones are dropped
+	pendingSize = 256
+)
+
+// Record is an event as sent to the sinks.
+type Record struct {
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"`
+
+	// The probability the event had to be kept, if sampled. Each
+	// record stands for 1/SampleRate events.
+	SampleRate float64 `json:"sampleRate,omitempty"`
+
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Config configures the queue.
+type Config struct {
+	// The number of records sent together
+	BatchSize int
+
+	// How often the queue is saved and sent, even if shorter than
+	// a batch
+	FlushInterval time.Duration
+
+	// The maximum number of records queued, the oldest are dropped
+	// when the sink can't keep up
+	MaxQueue int
+
+	// The probability of keeping each event, by name. Events
+	// missing from the map are all kept.
+	Sampling map[string]float64
+}
+
+// DefaultConfig returns batches of 50 records sent at least every 30
+// seconds and a queue of at most 10000 records.
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:     50,
+		FlushInterval: 30 * time.Second,
+		MaxQueue:      10000,
+	}
+}
+
+// Tracker queues the events and sends them to a sink. Its methods
+// can be called from any goroutine and do nothing on a nil Tracker.
+type Tracker struct {
+	sink   Sink
+	store  *storage.Store
+	config Config
+
+	pending    chan Record
+	flush      chan chan error
+	flushLater chan bool
+	clear      chan bool
+	stop       chan chan error
+
+	// Closed when the goroutine of the tracker returns
+	done chan bool
+
+	mutex        sync.Mutex
+	optOut       bool
+	session      string
+	sessionStart time.Time
+	sessionOpen  bool
+}
+
+// New starts a tracker sending to sink. The queue and the opt-out
+// are saved in store, if not nil.
+func New(sink Sink, store *storage.Store, config Config) *Tracker {
+	t := &Tracker{
+		sink:       sink,
+		store:      store,
+		config:     config,
+		pending:    make(chan Record, pendingSize),
+		flush:      make(chan chan error),
+		flushLater: make(chan bool, 1),
+		clear:      make(chan bool),
+		stop:       make(chan chan error),
+		done:       make(chan bool),
+	}
+	var queue []Record
+	if store != nil {
+		if store.Has(optOutKey) {
+			if err := store.Get(optOutKey, optOutVersion, &t.optOut); err != nil {
+				mandala.Logf("Can't read the analytics opt-out: %s\n", err.Error())
+			}
+		}
+		if store.Has(queueKey) {
+			if err := store.Get(queueKey, queueVersion, &queue); err != nil {
+				mandala.Logf("Can't read the analytics queue: %s\n", err.Error())
+			}
+		}
+	}
+	if t.optOut {
+		queue = nil
+	}
+	t.StartSession()
+	go t.run(queue)
+	return t
+}
+
+// StartSession starts a new session, identified by a random ID.
+func (t *Tracker) StartSession() {
+	if t == nil {
+		return
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	t.mutex.Lock()
+	t.session = hex.EncodeToString(id)
+	t.sessionStart = time.Now()
+	t.sessionOpen = true
+	t.mutex.Unlock()
+}
+
+// EndSession tracks the length of the session, if not ended yet, and
+// asks the tracker to save and send the queue. It doesn't wait for
+// it.
+func (t *Tracker) EndSession() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	open := t.sessionOpen
+	t.sessionOpen = false
+	length := time.Since(t.sessionStart)
+	t.mutex.Unlock()
+	if !open {
+		return
+	}
+	t.Track(SessionLength{length.Seconds()})
+	select {
+	case t.flushLater <- true:
+	default:
+		// A flush is already requested
+	}
+}
+
+// SetOptOut stops or restarts tracking. Opting out discards the
+// events not sent yet. The choice is saved.
+func (t *Tracker) SetOptOut(optOut bool) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	t.optOut = optOut
+	t.mutex.Unlock()
+	if t.store != nil {
+		if err := t.store.Put(optOutKey, optOutVersion, optOut); err != nil {
+			mandala.Logf("Can't save the analytics opt-out: %s\n", err.Error())
+		}
+	}
+	if optOut {
+		select {
+		case t.clear <- true:
+		case <-t.done:
+		}
+	}
+}
+
+// OptedOut returns true if the user opted out.
+func (t *Tracker) OptedOut() bool {
+	if t == nil {
+		return true
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.optOut
+}
+
+// Track queues an event, unless the user opted out or the event is
+// left out by sampling.
+func (t *Tracker) Track(e Event) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	optOut, session := t.optOut, t.session
+	t.mutex.Unlock()
+	if optOut {
+		return
+	}
+	r := Record{Name: e.Name(), Time: time.Now(), Session: session}
+	if rate, ok := t.config.Sampling[r.Name]; ok && rate < 1 {
+		if mathrand.Float64() >= rate {
+			return
+		}
+		r.SampleRate = rate
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	r.Data = data
+	select {
+	case t.pending <- r:
+	default:
+		// The tracker can't keep up, drop the event
+	}
+}
+
+// Flush saves the queue and sends it, waiting for the sink. It does
+// nothing once the tracker is closed.
+func (t *Tracker) Flush() error {
+	if t == nil {
+		return nil
+	}
+	reply := make(chan error)
+	select {
+	case t.flush <- reply:
+		return <-reply
+	case <-t.done:
+		return nil
+	}
+}
+
+// Close saves the queue and stops the tracker, without waiting for
+// the sink: the records not sent yet are sent by the next tracker
+// using the same storage. Without a storage they are sent before
+// returning. Closing a closed tracker does nothing.
+func (t *Tracker) Close() error {
+	if t == nil {
+		return nil
+	}
+	reply := make(chan error)
+	select {
+	case t.stop <- reply:
+		return <-reply
+	case <-t.done:
+		return nil
+	}
+}
+
+// run owns the queue.
+func (t *Tracker) run(queue []Record) {
+	ticker := time.NewTicker(t.config.FlushInterval)
+	defer ticker.Stop()
+	defer close(t.done)
+	dirty := false
+
+	// After a failure the sink is tried again at the next tick
+	// only, not at each batch
+	failed := false
+
+	add := func(r Record) {
+		queue = append(queue, r)
+		if len(queue) > t.config.MaxQueue {
+			queue = queue[len(queue)-t.config.MaxQueue:]
+		}
+		dirty = true
+	}
+	drain := func() {
+		for {
+			select {
+			case r := <-t.pending:
+				add(r)
+			default:
+				return
+			}
+		}
+	}
+	// flush saves the queue first, so that the records survive
+	// a sink that hangs until the process is killed
+	flush := func() error {
+		drain()
+		if dirty {
+			t.save(queue)
+		}
+		var err error
+		queue, err = t.send(queue)
+		t.save(queue)
+		dirty = false
+		failed = err != nil
+		return err
+	}
+
+	for {
+		select {
+		case r := <-t.pending:
+			add(r)
+			if len(queue) >= t.config.BatchSize && !failed {
+				var err error
+				if queue, err = t.send(queue); err == nil {
+					t.save(queue)
+				}
+				failed = err != nil
+			}
+		case <-ticker.C:
+			if len(queue) > 0 {
+				flush()
+			}
+		case reply := <-t.flush:
+			reply <- flush()
+		case <-t.flushLater:
+			flush()
+		case <-t.clear:
+			drain()
+			queue = queue[:0]
+			t.save(queue)
+			dirty = false
+		case reply := <-t.stop:
+			drain()
+			if t.store == nil {
+				_, err := t.send(queue)
+				reply <- err
+				return
+			}
+			if dirty {
+				t.save(queue)
+			}
+			reply <- nil
+			return
+		}
+	}
+}
+
+// send sends the queue in batches, stopping at the first error. It
+// returns the records not sent.
+func (t *Tracker) send(queue []Record) ([]Record, error) {
+	for len(queue) > 0 {
+		n := t.config.BatchSize
+		if n > len(queue) || n <= 0 {
+			n = len(queue)
+		}
+		if err := t.sink.Send(queue[:n]); err != nil {
+			mandala.Logf("Can't send the analytics: %s\n", err.Error())
+			return queue, err
+		}
+		// Move the rest to the front to reuse the memory
+		queue = queue[:copy(queue, queue[n:])]
+	}
+	return queue, nil
+}
+
+// save saves the queue in the storage.
+func (t *Tracker) save(queue []Record) {
+	if t.store == nil {
+		return
+	}
+	var err error
+	if len(queue) == 0 {
+		err = t.store.Delete(queueKey)
+	} else {
+		err = t.store.Put(queueKey, queueVersion, queue)
+	}
+	if err != nil {
+		mandala.Logf("Can't save the analytics queue: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,327 @@
+package analytics
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/remogatto/mandala-examples/storage"
+)
+
+// collector is a test server recording the batches received. It
+// answers 500 to the first failures requests.
+type collector struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	failures int
+	requests int
+	batches  [][]Record
+}
+
+func newCollector(failures int) *collector {
+	c := &collector{failures: failures}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+func (c *collector) serve(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requests++
+	if c.failures > 0 {
+		c.failures--
+		http.Error(w, "try again later", http.StatusInternalServerError)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		http.Error(w, "unexpected content type "+ct, http.StatusBadRequest)
+		return
+	}
+	var batch []Record
+	decoder := json.NewDecoder(r.Body)
+	for {
+		var record Record
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batch = append(batch, record)
+	}
+	c.batches = append(c.batches, batch)
+}
+
+// state returns the number of requests and the sizes of the batches
+// received.
+func (c *collector) state() (requests int, sizes []int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, b := range c.batches {
+		sizes = append(sizes, len(b))
+	}
+	return c.requests, sizes
+}
+
+// records returns all the records received.
+func (c *collector) records() []Record {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var records []Record
+	for _, b := range c.batches {
+		records = append(records, b...)
+	}
+	return records
+}
+
+// waitRequests waits until the collector got n requests.
+func (c *collector) waitRequests(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if requests, _ := c.state(); requests >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("the collector didn't get %d requests", n)
+}
+
+func testConfig(batchSize int) Config {
+	config := DefaultConfig()
+	config.BatchSize = batchSize
+	config.FlushInterval = time.Hour
+	return config
+}
+
+func openStore(t *testing.T) *storage.Store {
+	store, err := storage.OpenDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func equalSizes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBatching(t *testing.T) {
+	c := newCollector(0)
+	defer c.Close()
+	tracker := New(NewHTTPSink(c.URL), nil, testConfig(3))
+	defer tracker.Close()
+
+	for i := 0; i < 7; i++ {
+		tracker.Track(Tap{float32(i), 0})
+	}
+	c.waitRequests(t, 2)
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, sizes := c.state(); !equalSizes(sizes, []int{3, 3, 1}) {
+		t.Errorf("got batches of %v records, want [3 3 1]", sizes)
+	}
+	for i, r := range c.records() {
+		var tap Tap
+		if err := json.Unmarshal(r.Data, &tap); err != nil {
+			t.Fatal(err)
+		}
+		if r.Name != "tap" || r.Session == "" || tap.X != float32(i) {
+			t.Errorf("record %d is %+v, want the tap at %d", i, r, i)
+		}
+	}
+}
+
+func TestRetryAfterServerError(t *testing.T) {
+	c := newCollector(2)
+	defer c.Close()
+	tracker := New(NewHTTPSink(c.URL), nil, testConfig(2))
+	defer tracker.Close()
+
+	tracker.Track(Tap{0, 0})
+	tracker.Track(Tap{1, 0})
+	c.waitRequests(t, 1)
+
+	// After a failure the batches wait for the next flush
+	tracker.Track(Tap{2, 0})
+	tracker.Track(Tap{3, 0})
+	time.Sleep(20 * time.Millisecond)
+	if requests, _ := c.state(); requests != 1 {
+		t.Fatalf("got %d requests, want no retry before the next flush", requests)
+	}
+
+	if err := tracker.Flush(); err == nil {
+		t.Error("a flush answered with 500 succeeded")
+	}
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	requests, sizes := c.state()
+	if requests != 4 || !equalSizes(sizes, []int{2, 2}) {
+		t.Errorf("got %d requests and batches of %v records, want 4 and [2 2]", requests, sizes)
+	}
+	for i, r := range c.records() {
+		var tap Tap
+		json.Unmarshal(r.Data, &tap)
+		if tap.X != float32(i) {
+			t.Errorf("record %d is the tap at %g, the order was lost", i, tap.X)
+		}
+	}
+}
+
+func TestQueueSavedOnClose(t *testing.T) {
+	c := newCollector(0)
+	defer c.Close()
+	store := openStore(t)
+	tracker := New(NewHTTPSink(c.URL), store, testConfig(10))
+	for i := 0; i < 3; i++ {
+		tracker.Track(Tap{float32(i), 0})
+	}
+	if err := tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if requests, _ := c.state(); requests != 0 {
+		t.Errorf("closing sent %d requests, want the queue saved only", requests)
+	}
+
+	tracker = New(NewHTTPSink(c.URL), store, testConfig(10))
+	defer tracker.Close()
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, sizes := c.state(); !equalSizes(sizes, []int{3}) {
+		t.Errorf("got batches of %v records, want the 3 records saved", sizes)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	c := newCollector(0)
+	defer c.Close()
+	config := testConfig(1000)
+	config.Sampling = map[string]float64{"tap": 0, "explosion": 0.5}
+	tracker := New(NewHTTPSink(c.URL), nil, config)
+	defer tracker.Close()
+
+	tracker.Track(LevelStart{"raw/world.svg"})
+	for i := 0; i < 10; i++ {
+		tracker.Track(Tap{})
+	}
+	for i := 0; i < 200; i++ {
+		tracker.Track(Explosion{})
+	}
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, r := range c.records() {
+		counts[r.Name]++
+		switch r.Name {
+		case "levelStart":
+			if r.SampleRate != 0 {
+				t.Errorf("an event not sampled has rate %g", r.SampleRate)
+			}
+		case "explosion":
+			if r.SampleRate != 0.5 {
+				t.Errorf("a sampled event has rate %g, want 0.5", r.SampleRate)
+			}
+		}
+	}
+	if counts["levelStart"] != 1 || counts["tap"] != 0 {
+		t.Errorf("got %d level starts and %d taps, want 1 and 0", counts["levelStart"], counts["tap"])
+	}
+	if n := counts["explosion"]; n < 60 || n > 140 {
+		t.Errorf("kept %d explosions out of 200 at rate 0.5", n)
+	}
+}
+
+func TestOptOut(t *testing.T) {
+	c := newCollector(0)
+	defer c.Close()
+	store := openStore(t)
+	tracker := New(NewHTTPSink(c.URL), store, testConfig(10))
+	tracker.Track(Tap{})
+	tracker.SetOptOut(true)
+	tracker.Track(Tap{})
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if requests, _ := c.state(); requests != 0 {
+		t.Fatalf("got %d requests after opting out", requests)
+	}
+	tracker.Close()
+
+	// The choice is saved
+	tracker = New(NewHTTPSink(c.URL), store, testConfig(10))
+	defer tracker.Close()
+	if !tracker.OptedOut() {
+		t.Fatal("the opt-out wasn't saved")
+	}
+	tracker.Track(Tap{})
+	tracker.SetOptOut(false)
+	tracker.Track(Tap{1, 1})
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	records := c.records()
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want only the one tracked after opting in", len(records))
+	}
+}
+
+func TestSessionEndedOnce(t *testing.T) {
+	c := newCollector(0)
+	defer c.Close()
+	tracker := New(NewHTTPSink(c.URL), nil, testConfig(10))
+	tracker.EndSession()
+	tracker.EndSession()
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	tracker.StartSession()
+	tracker.EndSession()
+	if err := tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sessions := make(map[string]bool)
+	for _, r := range c.records() {
+		if r.Name != "sessionLength" || sessions[r.Session] {
+			t.Errorf("unexpected record %+v", r)
+		}
+		sessions[r.Session] = true
+	}
+	if len(sessions) != 2 {
+		t.Errorf("got the length of %d sessions, want 2", len(sessions))
+	}
+}
+
+func TestUseAfterClose(t *testing.T) {
+	tracker := New(NewFileSink(t.TempDir()+"/analytics.jsonl"), nil, testConfig(10))
+	tracker.Close()
+	done := make(chan bool)
+	go func() {
+		tracker.Track(Tap{})
+		tracker.EndSession()
+		tracker.SetOptOut(true)
+		tracker.Flush()
+		tracker.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a closed tracker blocked")
+	}
+}
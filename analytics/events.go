@@ -0,0 +1,56 @@
+package analytics
+
+// Event is something worth counting. Events are encoded as JSON in
+// the data of their records.
+type Event interface {
+	// The name of the kind of event, like "tap"
+	Name() string
+}
+
+// LevelStart is tracked when a level is loaded.
+type LevelStart struct {
+	Level string `json:"level"`
+}
+
+func (LevelStart) Name() string { return "levelStart" }
+
+// LevelEnd is tracked when the player leaves a level.
+type LevelEnd struct {
+	Level string `json:"level"`
+
+	// The time spent in the level
+	Seconds float64 `json:"seconds"`
+
+	// Why the level ended, like "reset" or "quit"
+	Reason string `json:"reason"`
+}
+
+func (LevelEnd) Name() string { return "levelEnd" }
+
+// Tap is tracked when the player taps the screen, in window
+// coordinates.
+type Tap struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+func (Tap) Name() string { return "tap" }
+
+// Explosion is tracked when the player makes an explosion, in world
+// coordinates.
+type Explosion struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+
+	// The number of bodies in the world
+	Bodies int `json:"bodies"`
+}
+
+func (Explosion) Name() string { return "explosion" }
+
+// SessionLength is tracked when a session ends.
+type SessionLength struct {
+	Seconds float64 `json:"seconds"`
+}
+
+func (SessionLength) Name() string { return "sessionLength" }
@@ -0,0 +1,87 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Sink receives the records in batches. Send is called from the
+// goroutine of the tracker: a batch that fails to be sent is sent
+// again later.
+type Sink interface {
+	Send(records []Record) error
+}
+
+// FileSink appends the records to a file, one JSON object per line.
+type FileSink struct {
+	Path string
+}
+
+// NewFileSink returns a sink appending to the given file.
+func NewFileSink(path string) *FileSink {
+	return &FileSink{Path: path}
+}
+
+func (s *FileSink) Send(records []Record) error {
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := encodeLines(&buf, records); err != nil {
+		file.Close()
+		return err
+	}
+	// A single write keeps the lines of a batch together
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// HTTPSink posts the records to a collector, as JSON lines with the
+// content type application/x-ndjson. Any 2xx status is a success.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSink returns a sink posting to url with a timeout of ten
+// seconds.
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *HTTPSink) Send(records []Record) error {
+	var buf bytes.Buffer
+	if err := encodeLines(&buf, records); err != nil {
+		return err
+	}
+	response, err := s.Client.Post(s.URL, "application/x-ndjson", &buf)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("analytics: %s answered %s", s.URL, response.Status)
+	}
+	return nil
+}
+
+func encodeLines(buf *bytes.Buffer, records []Record) error {
+	encoder := json.NewEncoder(buf)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Command stub is a local collector for the HTTP sink of the
+// analytics package. It prints the records it receives to the
+// standard output, one JSON object per line:
+//
+//	stub -addr localhost:8090
+//	chipmunk -analytics-url http://localhost:8090/
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8090", "listen on the given address")
+	fail := flag.Bool("fail", false, "answer 503 to every batch, to test retries")
+	flag.Parse()
+
+	var mutex sync.Mutex
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if *fail {
+			http.Error(w, "failing on purpose", http.StatusServiceUnavailable)
+			return
+		}
+		mutex.Lock()
+		_, err := io.Copy(os.Stdout, r.Body)
+		mutex.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	log.Printf("Listening on %s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
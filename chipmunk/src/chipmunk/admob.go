@@ -2,8 +2,39 @@
 
 package main
 
-import "unsafe"
+import (
+	"unsafe"
 
-func ShowAdPopup(activity unsafe.Pointer) {
-	// do nothing on desktop
+	"github.com/remogatto/mandala-examples/ads"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/remogatto/mandala-examples/gesture"
+)
+
+// mockAds shows placeholders instead of the ads on desktop.
+var mockAds *ads.Mock
+
+func newAdProvider(activity unsafe.Pointer) ads.Provider {
+	if mockAds == nil {
+		mockAds = ads.NewMock()
+	}
+	return mockAds
+}
+
+// updateAdPlaceholders draws a placeholder where the ads shown
+// would be.
+func updateAdPlaceholders(state *lib.GameState) {
+	state.ShowAdPlaceholder(ads.Interstitial, mockAds.Showing(ads.Interstitial))
+	state.ShowAdPlaceholder(ads.Banner, mockAds.Showing(ads.Banner))
+}
+
+// adBlocksGesture returns true if the gesture is consumed by the
+// interstitial shown. A tap closes it.
+func adBlocksGesture(g gesture.Gesture) bool {
+	if mockAds == nil || !mockAds.Showing(ads.Interstitial) {
+		return false
+	}
+	if g.Kind == gesture.Tap {
+		mockAds.Close()
+	}
+	return true
 }
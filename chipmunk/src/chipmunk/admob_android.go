@@ -5,8 +5,69 @@ package main
 // #include <android/native_activity.h>
 // #include "admob_android.h"
 import "C"
-import "unsafe"
+import (
+	"unsafe"
 
-func ShowAdPopup(activity unsafe.Pointer) {
-	C.showAdPopup((*C.ANativeActivity)(activity))
+	"github.com/remogatto/mandala-examples/ads"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/remogatto/mandala-examples/gesture"
+)
+
+// admob shows the AdMob popup of the Java activity as an
+// interstitial. The popup loads its ad by itself and its closing
+// isn't reported, so loading always succeeds and the interstitial
+// is reported closed as soon as it's shown. Banners aren't
+// supported.
+type admob struct {
+	activity unsafe.Pointer
+	events   chan ads.Event
+}
+
+var admobProvider *admob
+
+func newAdProvider(activity unsafe.Pointer) ads.Provider {
+	if admobProvider == nil {
+		admobProvider = &admob{events: make(chan ads.Event, 16)}
+	}
+	// The activity is created again after being destroyed
+	admobProvider.activity = activity
+	return admobProvider
+}
+
+func (a *admob) Events() <-chan ads.Event {
+	return a.events
+}
+
+func (a *admob) Load(format ads.Format) {
+	if format != ads.Interstitial {
+		go a.send(ads.Event{format, ads.Failed, ads.ErrUnsupported})
+		return
+	}
+	go a.send(ads.Event{format, ads.Loaded, nil})
+}
+
+func (a *admob) Show(format ads.Format) {
+	if format != ads.Interstitial {
+		go a.send(ads.Event{format, ads.Failed, ads.ErrUnsupported})
+		return
+	}
+	C.showAdPopup((*C.ANativeActivity)(a.activity))
+	go func() {
+		a.send(ads.Event{format, ads.Shown, nil})
+		a.send(ads.Event{format, ads.Closed, nil})
+	}()
+}
+
+func (a *admob) Hide(format ads.Format) {}
+
+func (a *admob) send(e ads.Event) {
+	a.events <- e
+}
+
+// updateAdPlaceholders does nothing, the ads are real on Android.
+func updateAdPlaceholders(state *lib.GameState) {}
+
+// adBlocksGesture returns false, the popup is another activity.
+func adBlocksGesture(g gesture.Gesture) bool {
+	return false
 }
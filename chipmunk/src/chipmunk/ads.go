@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/ads"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+)
+
+var (
+	// adManager decides when the ads are shown. It lives as long
+	// as the application so that the frequency cap holds across
+	// pauses.
+	adManager *ads.Manager
+
+	// adEvents receives the results of the ad requests. It's nil
+	// until the first window is created.
+	adEvents <-chan ads.Event
+)
+
+// initAds creates the ad manager, once, and applies the
+// configuration.
+func initAds(activity unsafe.Pointer, config *lib.Config) {
+	provider := newAdProvider(activity)
+	if adManager == nil {
+		adManager = ads.NewManager(provider, ads.Config{
+			MinInterval:   time.Duration(config.Ads.MinInterval * float32(time.Second)),
+			MaxPerSession: config.Ads.MaxPerSession,
+		})
+		adManager.OnFail = func(format ads.Format, err error) {
+			mandala.Logf("Can't show the %s ad: %s\n", format, err.Error())
+		}
+		adEvents = adManager.Events()
+	}
+	adManager.SetNoAds(config.Ads.NoAds)
+	if config.Ads.Banner {
+		adManager.ShowBanner()
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/analytics"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+)
+
+// The file the events are appended to when no URL is configured
+const analyticsFilename = "analytics.jsonl"
+
+var (
+	// eventTracker sends the events of the player. It lives as
+	// long as the application, a session lasts from a window
+	// creation to the next pause.
+	eventTracker *analytics.Tracker
+
+	// analyticsOptOut, if not nil, changes the choice of the user
+	// saved in the data directory
+	analyticsOptOut *bool
+)
+
+// initAnalytics creates the tracker, once, and starts a session.
+func initAnalytics(config *lib.Config) {
+	if eventTracker == nil {
+		var sink analytics.Sink
+		if config.Analytics.URL != "" {
+			sink = analytics.NewHTTPSink(config.Analytics.URL)
+		} else {
+			sink = analytics.NewFileSink(dataPath(analyticsFilename))
+		}
+		eventTracker = analytics.New(sink, store, analytics.Config{
+			BatchSize:     config.Analytics.BatchSize,
+			FlushInterval: time.Duration(config.Analytics.FlushInterval * float32(time.Second)),
+			MaxQueue:      analytics.DefaultConfig().MaxQueue,
+			Sampling:      config.Analytics.Sampling,
+		})
+		if analyticsOptOut != nil {
+			eventTracker.SetOptOut(*analyticsOptOut)
+		}
+		if eventTracker.OptedOut() {
+			mandala.Logf("Analytics disabled\n")
+		}
+	} else {
+		eventTracker.StartSession()
+	}
+}
+
+// closeAnalytics ends the session, if not ended by a pause, and saves
+// the events queued. They are sent at the next start.
+func closeAnalytics() {
+	if eventTracker == nil {
+		return
+	}
+	eventTracker.EndSession()
+	if err := eventTracker.Close(); err != nil {
+		mandala.Logf("Can't send the analytics: %s\n", err.Error())
+	}
+	eventTracker = nil
+}
@@ -0,0 +1,182 @@
+// +build !android
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	glfw "github.com/go-gl/glfw3"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/remogatto/mandala-examples/input"
+)
+
+// The names of the keys that can be bound, letters and digits are
+// added by init
+var keyNames = map[string]glfw.Key{
+	"Space":       glfw.KeySpace,
+	"Escape":      glfw.KeyEscape,
+	"Enter":       glfw.KeyEnter,
+	"Tab":         glfw.KeyTab,
+	"Backspace":   glfw.KeyBackspace,
+	"Delete":      glfw.KeyDelete,
+	"Period":      glfw.KeyPeriod,
+	"PrintScreen": glfw.KeyPrintScreen,
+	"F1":          glfw.KeyF1,
+	"F2":          glfw.KeyF2,
+	"F3":          glfw.KeyF3,
+	"F4":          glfw.KeyF4,
+	"F5":          glfw.KeyF5,
+	"F6":          glfw.KeyF6,
+	"F7":          glfw.KeyF7,
+	"F8":          glfw.KeyF8,
+	"F9":          glfw.KeyF9,
+	"F10":         glfw.KeyF10,
+	"F11":         glfw.KeyF11,
+	"F12":         glfw.KeyF12,
+}
+
+// The names of the mouse buttons that can be bound
+var buttonNames = map[string]glfw.MouseButton{
+	"MouseLeft":   glfw.MouseButtonLeft,
+	"MouseRight":  glfw.MouseButtonRight,
+	"MouseMiddle": glfw.MouseButtonMiddle,
+}
+
+// The names of the modifiers
+var modifierNames = map[string]glfw.ModifierKey{
+	"Shift": glfw.ModShift,
+	"Ctrl":  glfw.ModControl,
+	"Alt":   glfw.ModAlt,
+	"Super": glfw.ModSuper,
+}
+
+// The modifiers compared when matching a binding
+const boundModifiers = glfw.ModShift | glfw.ModControl | glfw.ModAlt | glfw.ModSuper
+
+func init() {
+	letters := []glfw.Key{
+		glfw.KeyA, glfw.KeyB, glfw.KeyC, glfw.KeyD, glfw.KeyE, glfw.KeyF,
+		glfw.KeyG, glfw.KeyH, glfw.KeyI, glfw.KeyJ, glfw.KeyK, glfw.KeyL,
+		glfw.KeyM, glfw.KeyN, glfw.KeyO, glfw.KeyP, glfw.KeyQ, glfw.KeyR,
+		glfw.KeyS, glfw.KeyT, glfw.KeyU, glfw.KeyV, glfw.KeyW, glfw.KeyX,
+		glfw.KeyY, glfw.KeyZ,
+	}
+	for i, key := range letters {
+		keyNames[string('A'+rune(i))] = key
+	}
+	digits := []glfw.Key{
+		glfw.Key0, glfw.Key1, glfw.Key2, glfw.Key3, glfw.Key4,
+		glfw.Key5, glfw.Key6, glfw.Key7, glfw.Key8, glfw.Key9,
+	}
+	for i, key := range digits {
+		keyNames[string('0'+rune(i))] = key
+	}
+}
+
+// binding is a key or a mouse button pressed with some modifiers.
+type binding struct {
+	mouse  bool
+	key    glfw.Key
+	button glfw.MouseButton
+	mods   glfw.ModifierKey
+}
+
+// parseBinding parses a binding like "Ctrl+S" or "Shift+MouseLeft".
+func parseBinding(s string) (binding, error) {
+	var b binding
+	parts := strings.Split(s, "+")
+	for _, name := range parts[:len(parts)-1] {
+		mod, ok := modifierNames[strings.TrimSpace(name)]
+		if !ok {
+			return b, fmt.Errorf("unknown modifier %q in %q", name, s)
+		}
+		b.mods |= mod
+	}
+	name := strings.TrimSpace(parts[len(parts)-1])
+	if button, ok := buttonNames[name]; ok {
+		b.mouse, b.button = true, button
+		return b, nil
+	}
+	key, ok := keyNames[strings.ToUpper(name)]
+	if !ok {
+		key, ok = keyNames[name]
+	}
+	if !ok {
+		return b, fmt.Errorf("unknown key %q in %q", name, s)
+	}
+	b.key = key
+	return b, nil
+}
+
+// bindings maps the keys and the mouse buttons of a window to
+// actions.
+type bindings struct {
+	actions map[binding]lib.Action
+	mouse   *input.Mouse
+}
+
+// newBindings parses the bindings of the configuration. Mouse
+// buttons not bound to an action keep emulating fingers through
+// mouse.
+func newBindings(config map[string][]string, mouse *input.Mouse) (*bindings, error) {
+	b := &bindings{
+		actions: make(map[binding]lib.Action),
+		mouse:   mouse,
+	}
+	for name, inputs := range config {
+		action, err := lib.ParseAction(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range inputs {
+			binding, err := parseBinding(s)
+			if err != nil {
+				return nil, fmt.Errorf("bindings: %s", err.Error())
+			}
+			if other, ok := b.actions[binding]; ok && other != action {
+				return nil, fmt.Errorf("bindings: %q is bound to both %s and %s", s, other, action)
+			}
+			b.actions[binding] = action
+		}
+	}
+	return b, nil
+}
+
+// install sets the key and the mouse button callbacks of the window.
+func (b *bindings) install(window *glfw.Window) {
+	window.SetKeyCallback(b.keyCallback)
+	window.SetMouseButtonCallback(b.buttonCallback)
+}
+
+func (b *bindings) keyCallback(window *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action != glfw.Press {
+		return
+	}
+	b.trigger(window, binding{key: key, mods: mods & boundModifiers})
+}
+
+func (b *bindings) buttonCallback(window *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+	if action == glfw.Press && b.trigger(window, binding{mouse: true, button: button, mods: mods & boundModifiers}) {
+		return
+	}
+	if b.mouse != nil {
+		b.mouse.Button(window, button, action, mods)
+	}
+}
+
+// trigger sends the action bound to the given binding, if any, to
+// the render loop. It returns true if the binding was found.
+func (b *bindings) trigger(window *glfw.Window, binding binding) bool {
+	action, ok := b.actions[binding]
+	if !ok {
+		return false
+	}
+	x, y := window.GetCursorPosition()
+	select {
+	case actions <- actionEvent{action, float32(x), float32(y)}:
+	default:
+		// Drop the action if the render loop is lagging behind
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+// +build !android
+
+package main
+
+import glfw "github.com/go-gl/glfw3"
+
+// releaseContext detaches the OpenGL context from the calling
+// thread, so that another thread can make it current.
+func releaseContext() {
+	glfw.DetachCurrentContext()
+}
@@ -0,0 +1,15 @@
+// +build android
+
+#include <EGL/egl.h>
+
+void releaseContext(void)
+{
+  EGLDisplay display = eglGetCurrentDisplay();
+
+  if (display == EGL_NO_DISPLAY) {
+    // No context is current on this thread
+    return;
+  }
+
+  eglMakeCurrent(display, EGL_NO_SURFACE, EGL_NO_SURFACE, EGL_NO_CONTEXT);
+}
@@ -0,0 +1,14 @@
+// +build android
+
+package main
+
+// #cgo LDFLAGS: -lEGL
+// #include "context_android.h"
+import "C"
+
+// releaseContext makes no EGL context current on the calling
+// thread, so that another thread can make the context current.
+// Otherwise eglMakeCurrent fails there with EGL_BAD_ACCESS.
+func releaseContext() {
+	C.releaseContext()
+}
@@ -0,0 +1,3 @@
+// +build android
+
+extern void releaseContext(void);
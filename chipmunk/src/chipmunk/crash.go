@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/remogatto/mandala"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/remogatto/mandala-examples/crash"
+	"github.com/remogatto/mandala-examples/storage"
+)
+
+// The version of the application written in the crash reports. Keep
+// it in sync with versionName in android/AndroidManifest.xml.
+const version = "1.1.0"
+
+// crashReporter saves a report when a loop panics, nil until
+// initCrashReporter is called.
+var crashReporter *crash.Reporter
+
+// initCrashReporter opens the data directory and starts keeping the
+// lines logged for the reports. It must be called before starting
+// the loops.
+func initCrashReporter() {
+	openStore()
+	crashReporter = crash.New(store, version)
+	crashReporter.CaptureLog()
+	if report, _ := crashReporter.Pending(); report != nil {
+		mandala.Logf("Crash report of %s found: %s\n", report.Time, report.Reason)
+	}
+}
+
+// snapshotOnCrash saves the world of state in the crash reports, as
+// the progress saved when pausing. After a panic of the render loop
+// state is read from its goroutine; after a panic of the event loop
+// the render loop may still be running and the snapshot may be
+// inconsistent.
+func snapshotOnCrash(state **lib.GameState) {
+	crashReporter.SetSnapshot(func() interface{} {
+		if *state == nil {
+			return nil
+		}
+		return &progress{config.Level, (*state).World.Snapshot()}
+	})
+}
+
+// reportCrash saves the report of a panic. It must be called from
+// the goroutine that panicked.
+func reportCrash(reason interface{}) {
+	report, err := crashReporter.Report(reason, mandala.Stacktrace())
+	if err != nil {
+		mandala.Logf("Can't save the crash report: %s\n", err.Error())
+		return
+	}
+	mandala.Logf("Crash report saved, %d lines of log\n", len(report.Log))
+}
+
+// offerCrashReport lets the player export the report of the
+// previous crash, if any, to the shared storage, or discard it.
+func offerCrashReport(state *lib.GameState) {
+	report, err := crashReporter.Pending()
+	if err != nil {
+		mandala.Logf("Can't read the crash report: %s\n", err.Error())
+		return
+	}
+	if report == nil {
+		return
+	}
+	export := func() (string, error) {
+		dir, err := storage.SharedDir(appName)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		filename := filepath.Join(dir, fmt.Sprintf("crash-%s.json", report.Time.Format("20060102-150405")))
+		return filename, crashReporter.Export(filename)
+	}
+	state.OfferCrashReport(export, crashReporter.Discard)
+}
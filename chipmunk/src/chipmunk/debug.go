@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/remogatto/mandala"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/remogatto/mandala-examples/debugserver"
+)
+
+var (
+	// debugServer is the debug server, nil if disabled.
+	debugServer *debugserver.Server
+
+	// debugRequests receives the commands of the debug
+	// server. It's nil, and never ready, if the server is
+	// disabled.
+	debugRequests <-chan *debugserver.Request
+)
+
+var errNoState = errors.New("the game isn't running")
+
+// startDebugServer starts the debug server on the configured
+// address, once.
+func startDebugServer(config *lib.Config) {
+	if config.DebugServer == "" || debugServer != nil {
+		return
+	}
+	server := debugserver.New(config.DebugServer)
+	if err := server.Start(); err != nil {
+		mandala.Logf("Can't start the debug server: %s\n", err.Error())
+		return
+	}
+	mandala.Logf("Debug server listening on %s\n", config.DebugServer)
+	debugServer = server
+	debugRequests = server.Requests()
+}
+
+// stopDebugServer stops the debug server, if running.
+func stopDebugServer() {
+	if debugServer == nil {
+		return
+	}
+	debugServer.Stop()
+	debugServer = nil
+	debugRequests = nil
+}
+
+// publishStats sends the statistics of the last frame to the
+// clients of the debug server.
+func publishStats(state *lib.GameState) {
+	if debugServer != nil && state != nil {
+		debugServer.Publish("stats", state.Stats())
+	}
+}
+
+// handleDebugRequest runs a command of the debug server. Positions
+// are in world coordinates.
+func handleDebugRequest(state *lib.GameState, req *debugserver.Request) {
+	if state == nil {
+		req.Reply(nil, errNoState)
+		return
+	}
+	var err error
+	switch req.Command {
+	case debugserver.StateCommand:
+		req.Reply(state.Inspect(), nil)
+		return
+	case "pause":
+		args := struct{ Paused *bool }{}
+		if err = req.Decode(&args); err == nil {
+			if args.Paused != nil {
+				state.SetPaused(*args.Paused)
+			} else {
+				state.SetPaused(!state.Paused())
+			}
+		}
+	case "step":
+		state.Step()
+	case "explode":
+		args := struct{ X, Y float32 }{}
+		if err = req.Decode(&args); err == nil {
+			state.ExplodeAt(args.X, args.Y)
+		}
+	case "spawn":
+		// The size of the boxes dropped by the player by default
+		args := struct{ X, Y, Width, Height float32 }{Width: 20, Height: 20}
+		if err = req.Decode(&args); err == nil {
+			if args.Width <= 0 || args.Height <= 0 {
+				err = fmt.Errorf("the size of the box must be positive, got %gx%g", args.Width, args.Height)
+			} else {
+				state.SpawnBox(args.X, args.Y, args.Width, args.Height)
+			}
+		}
+	case "gravity":
+		args := struct{ X, Y float32 }{}
+		args.X, args.Y = state.World.Gravity()
+		if err = req.Decode(&args); err == nil {
+			state.World.SetGravity(args.X, args.Y)
+		}
+	case "reload":
+		state.Reset()
+	default:
+		err = fmt.Errorf("unknown command %q", req.Command)
+	}
+	if err != nil {
+		req.Reply(nil, err)
+		return
+	}
+	req.Reply(state.Inspect(), nil)
+}
@@ -1,39 +1,157 @@
 package main
 
 import (
+	"fmt"
+	"image/png"
+	"os"
 	"runtime"
 	"time"
 	"unsafe"
 
 	"github.com/remogatto/mandala"
 	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
-	gl "github.com/remogatto/opengles2"
+	"github.com/remogatto/mandala-examples/gesture"
+	"github.com/remogatto/mandala-examples/input"
 	"github.com/tideland/goas/v2/loop"
 )
 
-const (
-	FramesPerSecond = 30
-	NumOfBoxes      = 50
+var (
+	// config is the runtime configuration. If nil it's loaded
+	// from the resources when the window is created.
+	config *lib.Config
+
+	// debugDraw enables the physics debug overlay.
+	debugDraw bool
+
+	// tracker tracks the fingers on the screen.
+	tracker = input.NewTracker(input.DefaultBufferSize)
+
+	// gestures recognizes the gestures of the fingers tracked.
+	gestures = gesture.NewRecognizer(gesture.DefaultConfig())
+
+	// panning is true from the first pan of a finger until it
+	// goes up.
+	panning bool
+
+	// actions receives the actions triggered by the keys and the
+	// mouse buttons.
+	actions = make(chan actionEvent, 16)
 )
 
+// actionEvent is an action triggered at the given window
+// coordinates.
+type actionEvent struct {
+	action lib.Action
+	x, y   float32
+}
+
 type initData struct {
 	window   mandala.Window
 	activity unsafe.Pointer
 }
 
+type viewportSize struct {
+	width, height int
+}
+
+// The channels of renderLoopControl are buffered, so that the event
+// loop doesn't block while the render loop restarts. stopped is
+// closed when the render loop gives up after too many panics, then
+// the events sent to it are dropped and the pauses acked.
 type renderLoopControl struct {
-	pause    chan mandala.PauseEvent
-	resume   chan bool
-	init     chan initData
-	tapEvent chan [2]float32
+	resizeViewport chan viewportSize
+	pause          chan mandala.PauseEvent
+	resume         chan bool
+	init           chan initData
+	stopped        chan bool
+	supervisor     *renderSupervisor
 }
 
 func newRenderLoopControl() *renderLoopControl {
 	return &renderLoopControl{
-		make(chan mandala.PauseEvent),
-		make(chan bool),
+		make(chan viewportSize, 4),
+		make(chan mandala.PauseEvent, 1),
+		make(chan bool, 1),
 		make(chan initData, 1),
-		make(chan [2]float32),
+		make(chan bool),
+		new(renderSupervisor),
+	}
+}
+
+// recoverFunc returns the function recovering the render loop, see
+// renderSupervisor.recoverFunc. Once the loop gives up, the pause
+// sent to it, if any, is acked.
+func (c *renderLoopControl) recoverFunc(giveUp func(reason interface{})) loop.RecoverFunc {
+	return c.supervisor.recoverFunc(func(reason interface{}) {
+		close(c.stopped)
+		c.ackPendingPause()
+		giveUp(reason)
+	})
+}
+
+// running returns false once the render loop gave up.
+func (c *renderLoopControl) running() bool {
+	select {
+	case <-c.stopped:
+		return false
+	default:
+		return true
+	}
+}
+
+// sendInit passes a new window to the render loop. It's dropped if
+// the loop stopped.
+func (c *renderLoopControl) sendInit(init initData) {
+	select {
+	case c.init <- init:
+	case <-c.stopped:
+	}
+}
+
+// sendResize passes the new size of the window to the render loop
+// without blocking. It's dropped if the loop stopped or is behind.
+func (c *renderLoopControl) sendResize(size viewportSize) {
+	select {
+	case c.resizeViewport <- size:
+	default:
+		mandala.Logf("Resize to %dx%d dropped, the render loop isn't receiving\n", size.width, size.height)
+	}
+}
+
+// sendPause passes a pause to the render loop without blocking. The
+// pause is acked right away if the loop stopped or if another pause
+// is pending, which pauses the loop already.
+func (c *renderLoopControl) sendPause(event mandala.PauseEvent) {
+	if !c.running() {
+		event.Paused <- true
+		return
+	}
+	select {
+	case c.pause <- event:
+		// The loop may have given up before receiving it
+		if !c.running() {
+			c.ackPendingPause()
+		}
+	default:
+		event.Paused <- true
+	}
+}
+
+// sendResume passes a resume to the render loop without blocking.
+func (c *renderLoopControl) sendResume() {
+	select {
+	case c.resume <- true:
+	default:
+	}
+}
+
+// ackPendingPause acks the pause not received by the render loop,
+// if any.
+func (c *renderLoopControl) ackPendingPause() {
+	select {
+	case event := <-c.pause:
+		event.Paused <- true
+	default:
 	}
 }
 
@@ -43,69 +161,287 @@ func renderLoopFunc(control *renderLoopControl) loop.LoopFunc {
 	return func(loop loop.Loop) error {
 
 		var state *lib.GameState
+		snapshotOnCrash(&state)
+
+		// Set when a screenshot of the next frame is requested
+		screenshot := false
 
 		// Lock/unlock the loop to the current OS thread. This is
 		// necessary because OpenGL functions should be called from
 		// the same thread.
+		// The context is released before unlocking, even after
+		// a panic: the loop restarts on another thread, where
+		// the context can't be made current while still current
+		// on this one.
 		runtime.LockOSThread()
-		defer runtime.UnlockOSThread()
+		defer func() {
+			releaseContext()
+			runtime.UnlockOSThread()
+		}()
 
 		// Create an instance of ticker and immediately stop
 		// it because we don't want to swap buffers before
 		// initializing a rendering state.
-		ticker := time.NewTicker(time.Duration(1e9 / int(FramesPerSecond)))
+		ticker := time.NewTicker(time.Second)
 		ticker.Stop()
 
 		fpsTicker := time.NewTicker(time.Duration(time.Second))
 		fpsTicker.Stop()
 
+		// Stop the tickers of this run if it panics
+		defer func() {
+			ticker.Stop()
+			fpsTicker.Stop()
+		}()
+
+		// start creates the state drawing on the window of
+		// init. After a panic the world is restored from
+		// snapshot, if any, instead of the progress saved.
+		start := func(init initData, restart bool, snapshot *lib.Snapshot) {
+			ticker.Stop()
+
+			// A panic creating the state starts it again
+			control.supervisor.running(&init, nil)
+
+			if config == nil {
+				config = loadConfig()
+			}
+			openStore()
+			config.Editor.Path = dataPath(config.Editor.Path)
+			useEditedLevel(config)
+			state = lib.NewGameState(init.window, config)
+			if snapshot != nil {
+				state.World.Restore(snapshot)
+			} else {
+				restoreProgress(state)
+			}
+			if !restart {
+				offerCrashReport(state)
+				initAnalytics(config)
+			}
+			state.SetTracker(eventTracker)
+			if debugDraw {
+				state.World.EnableDebugDraw()
+			}
+			if config.Profiler.Enabled {
+				state.EnableProfiler()
+			}
+			startDebugServer(config)
+
+			// Show an interstitial each time the game
+			// starts, as often as the cap allows
+			initAds(init.activity, config)
+			updateAdPlaceholders(state)
+			if !restart {
+				adManager.ShowInterstitial()
+			}
+			control.supervisor.running(&init, state)
+
+			ticker = time.NewTicker(time.Duration(time.Second / time.Duration(config.FramesPerSecond)))
+			fpsTicker = time.NewTicker(time.Duration(time.Second))
+		}
+
+		// After a panic throw away the state of the previous
+		// run and draw again on its window, if any
+		if init, old, snapshot := control.supervisor.restart(); init != nil {
+			if old != nil {
+				// The context was released by the
+				// thread of the previous run
+				init.window.MakeContextCurrent()
+				destroyQuietly(old)
+			}
+			panning = false
+			start(*init, true, snapshot)
+		}
+
 		for {
 			select {
 			case init := <-control.init:
-				window := init.window
-				activity := init.activity
-
-				ticker.Stop()
+				start(init, false, nil)
 
-				state = lib.NewGameState(window)
+			case viewport := <-control.resizeViewport:
+				if state != nil {
+					mandala.Logf("Resize native window W:%v H:%v\n", viewport.width, viewport.height)
+					state.Resize(viewport.width, viewport.height)
+				}
 
-				width, height := window.GetSize()
-				gl.Viewport(0, 0, gl.Sizei(width), gl.Sizei(height))
+			case event := <-tracker.Events():
+				handleGestures(state, gestures.Feed(event))
 
-				ShowAdPopup(activity)
+			case event := <-actions:
+				if state == nil {
+					break
+				}
+				if event.action == lib.ScreenshotAction {
+					screenshot = true
+				} else {
+					state.Do(event.action, event.x, event.y)
+				}
 
-				ticker = time.NewTicker(time.Duration(time.Second / time.Duration(FramesPerSecond)))
-				fpsTicker = time.NewTicker(time.Duration(time.Second))
+			case event := <-adEvents:
+				adManager.Handle(event)
+				if state != nil {
+					updateAdPlaceholders(state)
+				}
 
-			case tap := <-control.tapEvent:
-				state.World.Remove(tap[0], tap[1])
+			case req := <-debugRequests:
+				handleDebugRequest(state, req)
 
 			// At each tick render a frame and swap buffers.
 			case <-ticker.C:
+				// A tick may still be pending after pausing
+				if state == nil {
+					break
+				}
+				handleGestures(state, gestures.Update(time.Now()))
 				state.Frames++
 				state.Draw()
+				if screenshot {
+					screenshot = false
+					saveScreenshot(state)
+				}
 				state.SwapBuffers()
+				control.supervisor.frameDone(state)
 
 			case <-fpsTicker.C:
+				if state == nil {
+					break
+				}
 				state.Fps = state.Frames
 				state.Frames = 0
+				publishStats(state)
 
 			case event := <-control.pause:
 				ticker.Stop()
 				fpsTicker.Stop()
-				state.World.Destroy()
+				// A pause may arrive before the first window
+				// or right after a restart
+				if state != nil {
+					writeProfile(state)
+					saveProgress(state)
+					state.TrackLevelEnd("quit")
+					state.Destroy()
+					eventTracker.EndSession()
+				}
+				// Debug requests received until the next
+				// window is created fail
+				state = nil
+				control.supervisor.running(nil, nil)
 				event.Paused <- true
 
 			case <-control.resume:
 
 			case <-loop.ShallStop():
 				ticker.Stop()
+				writeProfile(state)
+				saveProgress(state)
+				if state != nil {
+					state.TrackLevelEnd("quit")
+				}
+				closeAnalytics()
+				stopDebugServer()
 				return nil
 			}
 		}
 	}
 }
 
+// handleGestures lets the user play with the world. A tap removes a
+// box or presses a HUD button, a double tap makes an explosion, a
+// long press drops a box, panning drags a box or moves the camera
+// and pinching zooms and pans the camera. While editing the gestures
+// go to the level editor.
+func handleGestures(state *lib.GameState, gestures []gesture.Gesture) {
+	if state == nil {
+		return
+	}
+	for _, g := range gestures {
+		if adBlocksGesture(g) {
+			continue
+		}
+		if g.Kind == gesture.Tap && state.HUD.Tap(g.X, g.Y) {
+			continue
+		}
+		if state.Editing() {
+			state.Editor().HandleGesture(g)
+			continue
+		}
+		switch g.Kind {
+		case gesture.Tap:
+			state.TrackTap(g.X, g.Y)
+			state.Remove(g.X, g.Y)
+		case gesture.DoubleTap:
+			state.Explode(g.X, g.Y)
+		case gesture.LongPress:
+			state.DropBox(g.X, g.Y)
+		case gesture.Pan:
+			if !panning {
+				// Drag the box where the pan started, if any
+				panning = true
+				state.BeginDrag(g.X-g.DX, g.Y-g.DY)
+			}
+			if state.Dragging() {
+				state.DragTo(g.X, g.Y)
+			} else {
+				state.World.Pan(g.DX, g.DY)
+			}
+		case gesture.PanEnd:
+			panning = false
+			state.EndDrag()
+		case gesture.Pinch:
+			state.World.Zoom(g.Scale, g.X-g.DX, g.Y-g.DY)
+			state.World.Pan(g.DX, g.DY)
+		}
+	}
+}
+
+// loadConfig loads the configuration from the resources. A
+// configuration with invalid values is a fatal error.
+func loadConfig() *lib.Config {
+	config, err := lib.LoadConfig(lib.ConfigFilename)
+	if err != nil {
+		mandala.Fatalf("%s\n", err.Error())
+	}
+	return config
+}
+
+// writeProfile writes the samples collected by the profiler to the
+// configured file, if any.
+func writeProfile(state *lib.GameState) {
+	if state == nil || state.Profiler() == nil || config.Profiler.Output == "" {
+		return
+	}
+	filename := dataPath(config.Profiler.Output)
+	file, err := os.Create(filename)
+	if err != nil {
+		mandala.Logf("Can't write the profile: %s\n", err.Error())
+		return
+	}
+	defer file.Close()
+	if err := state.Profiler().WriteCSV(file); err != nil {
+		mandala.Logf("Can't write the profile: %s\n", err.Error())
+		return
+	}
+	mandala.Logf("Profile written to %s\n", filename)
+}
+
+// saveScreenshot writes the frame drawn to a PNG file in the data
+// directory.
+func saveScreenshot(state *lib.GameState) {
+	filename := dataPath(fmt.Sprintf("chipmunk-%s.png", time.Now().Format("20060102-150405")))
+	file, err := os.Create(filename)
+	if err != nil {
+		mandala.Logf("Can't save the screenshot: %s\n", err.Error())
+		return
+	}
+	defer file.Close()
+	if err := png.Encode(file, state.Screenshot()); err != nil {
+		mandala.Logf("Can't save the screenshot: %s\n", err.Error())
+		return
+	}
+	mandala.Logf("Screenshot saved to %s\n", filename)
+}
+
 // eventLoopFunc listen to events originating from the
 // framework.
 func eventLoopFunc(renderLoopControl *renderLoopControl) loop.LoopFunc {
@@ -123,31 +459,30 @@ func eventLoopFunc(renderLoopControl *renderLoopControl) loop.LoopFunc {
 				// order to begin the
 				// rendering process.
 				case mandala.NativeWindowCreatedEvent:
-					renderLoopControl.init <- initData{event.Window, event.Activity}
-
-				// Finger down/up on the screen.
-				case mandala.ActionUpDownEvent:
-					if event.Down {
-						renderLoopControl.tapEvent <- [2]float32{event.X, event.Y}
-					}
+					renderLoopControl.sendInit(initData{event.Window, event.Activity})
 
-					// Finger is moving on the screen.
-				case mandala.ActionMoveEvent:
-					mandala.Logf("Finger is moving at coord %f %f", event.X, event.Y)
+				// Finger down/up or moving on the screen.
+				case mandala.ActionUpDownEvent, mandala.ActionMoveEvent:
+					tracker.Translate(event)
 
 				case mandala.DestroyEvent:
 					mandala.Logf("Quitting from application now...\n")
 					return nil
 
+				// The window was resized or the
+				// device was rotated.
 				case mandala.NativeWindowRedrawNeededEvent:
+					width, height := event.Window.GetSize()
+					renderLoopControl.sendResize(viewportSize{width, height})
 
 				case mandala.PauseEvent:
 					mandala.Logf("Application was paused. Stopping rendering ticker.")
-					renderLoopControl.pause <- event
+					tracker.Cancel(time.Now())
+					renderLoopControl.sendPause(event)
 
 				case mandala.ResumeEvent:
 					mandala.Logf("Application was resumed. Reactivating rendering ticker.")
-					renderLoopControl.resume <- true
+					renderLoopControl.sendResume()
 
 				}
 			}
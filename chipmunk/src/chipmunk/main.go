@@ -6,12 +6,16 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 
 	glfw "github.com/go-gl/glfw3"
 	"github.com/remogatto/mandala"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/remogatto/mandala-examples/debugserver"
+	"github.com/remogatto/mandala-examples/input"
 	"github.com/tideland/goas/v2/loop"
 )
 
@@ -20,8 +24,23 @@ func main() {
 	runtime.LockOSThread()
 
 	verbose := flag.Bool("verbose", false, "produce verbose output")
-	debug := flag.Bool("debug", false, "produce debug output")
+	debug := flag.Bool("debug", false, "produce debug output and draw the physics debug overlay")
+	profile := flag.String("profile", "", "draw the performance overlay and write the samples to the given CSV file on exit")
+
+	// Configuration overrides
 	size := flag.String("size", "480x320", "set the size of the window")
+	gravity := flag.String("gravity", "0,-900", "set the gravity vector")
+	iterations := flag.Int("iterations", lib.DefaultIterations, "set the number of iterations of the physics solver")
+	damping := flag.Float64("damping", 1, "set the fraction of velocity the bodies retain each second")
+	timestep := flag.Float64("timestep", 0, "set a fixed timestep in seconds, 0 to step by the frame duration")
+	level := flag.String("level", lib.DefaultLevel, "set the level loaded at startup")
+	fps := flag.Int("fps", lib.DefaultFps, "set the number of frames per second")
+	volume := flag.Float64("volume", 1, "set the volume of the sound effects, from 0 to 1")
+	follow := flag.Bool("follow", false, "make the camera follow the last box dropped or thrown")
+	noAds := flag.Bool("no-ads", false, "show no ads, as if the user paid for it")
+	analyticsURL := flag.String("analytics-url", "", "post the analytics to the given URL instead of appending them to a file")
+	noAnalytics := flag.Bool("no-analytics", false, "opt out of the analytics, -no-analytics=false opts in again")
+	debugServerAddr := flag.String("debug-server", debugserver.DefaultAddr, "start the debug server on the given localhost address")
 
 	flag.Parse()
 
@@ -31,16 +50,12 @@ func main() {
 
 	if *debug {
 		mandala.Debug = true
+		debugDraw = true
 	}
 
-	dims := strings.Split(strings.ToLower(*size), "x")
-	width, err := strconv.Atoi(dims[0])
-	if err != nil {
-		panic(err)
-	}
-	height, err := strconv.Atoi(dims[1])
+	width, height, err := parsePair(*size, "x")
 	if err != nil {
-		panic(err)
+		log.Fatalf("Invalid size %q: %s", *size, err.Error())
 	}
 
 	if !glfw.Init() {
@@ -58,25 +73,93 @@ func main() {
 
 	mandala.Init(window)
 
+	// Emulate the fingers with the mouse
+	mouse := input.EmulateTouch(window, tracker)
+
+	// Load the configuration, the values given on the command
+	// line take precedence.
+	config, err = lib.LoadConfig(lib.ConfigFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "size":
+			config.Window.Width, config.Window.Height = width, height
+		case "gravity":
+			x, y, err := parseFloatPair(*gravity, ",")
+			if err != nil {
+				log.Fatalf("Invalid gravity %q: %s", *gravity, err.Error())
+			}
+			config.Physics.Gravity = [2]float32{x, y}
+		case "iterations":
+			config.Physics.Iterations = *iterations
+		case "damping":
+			config.Physics.Damping = float32(*damping)
+		case "timestep":
+			config.Physics.Timestep = float32(*timestep)
+		case "level":
+			config.Level = *level
+		case "fps":
+			config.FramesPerSecond = *fps
+		case "volume":
+			config.Audio.Explosion = float32(*volume)
+			config.Audio.Impact = float32(*volume)
+			config.Audio.Break = float32(*volume)
+		case "follow":
+			config.Camera.Follow = *follow
+		case "no-ads":
+			config.Ads.NoAds = *noAds
+		case "analytics-url":
+			config.Analytics.URL = *analyticsURL
+		case "no-analytics":
+			analyticsOptOut = noAnalytics
+		case "debug-server":
+			config.DebugServer = *debugServerAddr
+		case "profile":
+			// The file is relative to the working
+			// directory, not to the data directory
+			output, err := filepath.Abs(*profile)
+			if err != nil {
+				log.Fatalf("Invalid profile %q: %s", *profile, err.Error())
+			}
+			config.Profiler = lib.ProfilerConfig{Enabled: true, Output: output}
+		}
+	})
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if config.Window.Width != width || config.Window.Height != height {
+		window.SetSize(config.Window.Width, config.Window.Height)
+	}
+
+	// Bind the keys and the mouse buttons to the actions
+	bindings, err := newBindings(config.Bindings, mouse)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bindings.install(window)
+
+	// Save a report if a loop panics
+	initCrashReporter()
+
 	// Create a rendering loop control struct containing a set of
 	// channels that control rendering.
 	renderLoopControl := newRenderLoopControl()
 
-	// Start the rendering loop
-	loop.GoRecoverable(
+	// Start the rendering loop, restarting it after a panic
+	renderLoop := loop.GoRecoverable(
 		renderLoopFunc(renderLoopControl),
-		func(rs loop.Recoverings) (loop.Recoverings, error) {
-			for _, r := range rs {
-				log.Fatalf("%s\n%s", r.Reason, mandala.Stacktrace())
-			}
-			return rs, fmt.Errorf("Unrecoverable loop\n")
-		},
+		renderLoopControl.recoverFunc(func(reason interface{}) {
+			log.Fatalf("%s\n%s", reason, mandala.Stacktrace())
+		}),
 	)
 	// Start the event loop
 	loop.GoRecoverable(
 		eventLoopFunc(renderLoopControl),
 		func(rs loop.Recoverings) (loop.Recoverings, error) {
 			for _, r := range rs {
+				reportCrash(r.Reason)
 				log.Fatalf("%s\n%s", r.Reason, mandala.Stacktrace())
 			}
 			return rs, fmt.Errorf("Unrecoverable loop\n")
@@ -87,4 +170,51 @@ func main() {
 		glfw.WaitEvents()
 	}
 
+	// Stop rendering, writing the profile if enabled
+	renderLoop.Stop()
+
+}
+
+// splitPair splits two values separated by sep, like 480x320.
+func splitPair(s, sep string) (string, string, error) {
+	values := strings.Split(strings.ToLower(s), sep)
+	if len(values) != 2 {
+		return "", "", fmt.Errorf("expected two values separated by %q", sep)
+	}
+	return strings.TrimSpace(values[0]), strings.TrimSpace(values[1]), nil
+}
+
+// parsePair parses two integers separated by sep, like 480x320.
+func parsePair(s, sep string) (int, int, error) {
+	x, y, err := splitPair(s, sep)
+	if err != nil {
+		return 0, 0, err
+	}
+	a, err := strconv.Atoi(x)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := strconv.Atoi(y)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+// parseFloatPair parses two numbers separated by sep, like
+// 0,-9.8.
+func parseFloatPair(s, sep string) (float32, float32, error) {
+	x, y, err := splitPair(s, sep)
+	if err != nil {
+		return 0, 0, err
+	}
+	a, err := strconv.ParseFloat(x, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := strconv.ParseFloat(y, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return float32(a), float32(b), nil
 }
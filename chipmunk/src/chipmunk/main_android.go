@@ -7,6 +7,7 @@ import (
 	"runtime"
 
 	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/input"
 	"github.com/tideland/goas/v2/loop"
 )
 
@@ -16,24 +17,28 @@ func main() {
 	mandala.Verbose = true
 	mandala.Debug = true
 
+	// Track every finger on the screen
+	input.TrackMotions(tracker)
+
+	// Save a report if a loop panics
+	initCrashReporter()
+
 	// Create rendering loop control channels
 	renderLoopControl := newRenderLoopControl()
-	// Start the rendering loop
+	// Start the rendering loop, restarting it after a panic
 	loop.GoRecoverable(
 		renderLoopFunc(renderLoopControl),
-		func(rs loop.Recoverings) (loop.Recoverings, error) {
-			for _, r := range rs {
-				mandala.Logf("%s", r.Reason)
-				mandala.Logf("%s", mandala.Stacktrace())
-			}
-			return rs, fmt.Errorf("Unrecoverable loop\n")
-		},
+		renderLoopControl.recoverFunc(func(reason interface{}) {
+			mandala.Logf("%s", reason)
+			mandala.Logf("%s", mandala.Stacktrace())
+		}),
 	)
 	// Start the event loop
 	loop.GoRecoverable(
 		eventLoopFunc(renderLoopControl),
 		func(rs loop.Recoverings) (loop.Recoverings, error) {
 			for _, r := range rs {
+				reportCrash(r.Reason)
 				mandala.Logf("%s", r.Reason)
 				mandala.Logf("%s", mandala.Stacktrace())
 			}
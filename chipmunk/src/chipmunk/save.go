@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/remogatto/mandala"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/remogatto/mandala-examples/storage"
+)
+
+const (
+	// The name of the data directory on desktop
+	appName = "chipmunk"
+
+	// The key and the version of the progress saved when the
+	// application is paused
+	progressKey     = "progress"
+	progressVersion = 1
+)
+
+// store holds the data of the application, nil if the data
+// directory isn't writable.
+var store *storage.Store
+
+// progress is the world saved when the application is paused and
+// restored when it's started again.
+type progress struct {
+	Level    string
+	Snapshot *lib.Snapshot
+}
+
+// openStore opens the data directory, once.
+func openStore() {
+	if store != nil {
+		return
+	}
+	var err error
+	if store, err = storage.Open(appName); err != nil {
+		mandala.Logf("Can't open the data directory: %s\n", err.Error())
+	}
+}
+
+// dataPath returns the path of a file in the data directory.
+// Absolute paths are returned as they are.
+func dataPath(name string) string {
+	if store == nil || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(store.Dir(), name)
+}
+
+// useEditedLevel makes the level saved by the editor, if any, the
+// level played. config.Editor.Path must be already resolved, it's
+// ignored if relative because the data directory isn't available.
+func useEditedLevel(config *lib.Config) {
+	if !filepath.IsAbs(config.Editor.Path) {
+		return
+	}
+	if _, err := os.Stat(config.Editor.Path); err == nil {
+		config.Level = config.Editor.Path
+	}
+}
+
+// saveProgress saves the boxes of the world.
+func saveProgress(state *lib.GameState) {
+	if store == nil || state == nil {
+		return
+	}
+	p := progress{config.Level, state.World.Snapshot()}
+	if err := store.Put(progressKey, progressVersion, &p); err != nil {
+		mandala.Logf("Can't save the progress: %s\n", err.Error())
+	}
+}
+
+// restoreProgress brings back the boxes saved, if they belong to
+// the level loaded.
+func restoreProgress(state *lib.GameState) {
+	if store == nil || !store.Has(progressKey) {
+		return
+	}
+	var p progress
+	if err := store.Get(progressKey, progressVersion, &p); err != nil {
+		mandala.Logf("Can't restore the progress: %s\n", err.Error())
+		return
+	}
+	if p.Level == config.Level && p.Snapshot != nil {
+		state.World.Restore(p.Snapshot)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/remogatto/mandala"
+	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
+	"github.com/tideland/goas/v2/loop"
+)
+
+const (
+	// The render loop is restarted at most maxRestarts times in
+	// restartPeriod, then a panic stops it
+	maxRestarts   = 3
+	restartPeriod = time.Minute
+
+	// How often the world is saved to restart from
+	snapshotInterval = time.Second
+)
+
+// renderSupervisor keeps what the render loop needs to start again
+// after a panic: the window it draws on, the state to throw away and
+// the last snapshot of the world taken after a good frame.
+type renderSupervisor struct {
+	mutex    sync.Mutex
+	init     *initData
+	state    *lib.GameState
+	snapshot *lib.Snapshot
+	taken    time.Time
+	restarts []time.Time
+}
+
+// running records the state drawn on the window of init. Both are
+// nil while paused, then the snapshot is forgotten too.
+func (s *renderSupervisor) running(init *initData, state *lib.GameState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.init, s.state = init, state
+	if init == nil {
+		s.snapshot = nil
+	}
+}
+
+// frameDone takes a snapshot of the world after a good frame, at
+// most every snapshotInterval.
+func (s *renderSupervisor) frameDone(state *lib.GameState) {
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now.Sub(s.taken) < snapshotInterval {
+		return
+	}
+	s.snapshot = state.World.Snapshot()
+	s.taken = now
+}
+
+// restart returns the window to draw on again, the state the loop
+// had before panicking and the last good snapshot. init is nil if
+// the loop wasn't drawing.
+func (s *renderSupervisor) restart() (init *initData, state *lib.GameState, snapshot *lib.Snapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	init, state, snapshot = s.init, s.state, s.snapshot
+	s.init, s.state = nil, nil
+	return
+}
+
+// recoverFunc returns the function recovering the render loop. Each
+// panic is reported and the loop is restarted, unless it panicked
+// too often: then giveUp is called and the loop stops.
+func (s *renderSupervisor) recoverFunc(giveUp func(reason interface{})) loop.RecoverFunc {
+	return func(rs loop.Recoverings) (loop.Recoverings, error) {
+		for _, r := range rs {
+			reportCrash(r.Reason)
+		}
+		reason := rs[len(rs)-1].Reason
+
+		now := time.Now()
+		s.mutex.Lock()
+		recent := s.restarts[:0]
+		for _, t := range s.restarts {
+			if now.Sub(t) < restartPeriod {
+				recent = append(recent, t)
+			}
+		}
+		s.restarts = recent
+		tooMany := len(s.restarts) >= maxRestarts
+		if !tooMany {
+			s.restarts = append(s.restarts, now)
+		}
+		s.mutex.Unlock()
+
+		if tooMany {
+			giveUp(reason)
+			return rs, fmt.Errorf("Unrecoverable loop\n")
+		}
+		mandala.Logf("Render loop panicked, restarting: %s\n%s", reason, mandala.Stacktrace())
+		return nil, nil
+	}
+}
+
+// destroyQuietly releases the state of a loop that panicked. The
+// state may be broken, so a panic releasing it is only logged.
+func destroyQuietly(state *lib.GameState) {
+	defer func() {
+		if reason := recover(); reason != nil {
+			mandala.Logf("Can't release the state after a panic: %s\n", reason)
+		}
+	}()
+	state.Destroy()
+}
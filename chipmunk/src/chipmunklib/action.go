@@ -0,0 +1,238 @@
+package chipmunklib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Action is something the player can do with a key or a mouse
+// button.
+type Action int
+
+const (
+	// Make an explosion at the cursor
+	ExplodeAction Action = iota
+
+	// Drop a box at the cursor
+	DropBoxAction
+
+	// Load the level again
+	ResetAction
+
+	// Pause or resume the simulation
+	PauseAction
+
+	// Advance the paused simulation by one step
+	StepAction
+
+	// Show or hide the physics debug overlay
+	DebugDrawAction
+
+	// Save the next frame to an image
+	ScreenshotAction
+
+	// Undo the last action of the player
+	UndoAction
+
+	// Redo the last action undone
+	RedoAction
+
+	// Enter or leave the level editor
+	EditAction
+
+	// Delete the body or the segment selected in the editor
+	DeleteAction
+
+	// Rotate the box selected in the editor
+	RotateAction
+
+	// Switch grid snapping on or off in the editor
+	SnapAction
+
+	// Run or stop the simulation in the editor
+	PlayAction
+
+	// Save the level edited
+	SaveAction
+
+	// Switch a layer of the physics debug overlay on or off,
+	// showing the overlay if hidden
+	DebugOutlinesAction
+	DebugAABBsAction
+	DebugContactsAction
+	DebugVelocitiesAction
+	DebugJointsAction
+	DebugSleepingAction
+)
+
+// The names of the actions in the configuration
+var actionNames = [...]string{
+	ExplodeAction:    "explode",
+	DropBoxAction:    "dropBox",
+	ResetAction:      "reset",
+	PauseAction:      "pause",
+	StepAction:       "step",
+	DebugDrawAction:  "debugDraw",
+	ScreenshotAction: "screenshot",
+	UndoAction:       "undo",
+	RedoAction:       "redo",
+	EditAction:       "edit",
+	DeleteAction:     "delete",
+	RotateAction:     "rotate",
+	SnapAction:       "snap",
+	PlayAction:       "play",
+	SaveAction:       "save",
+
+	DebugOutlinesAction:   "debugOutlines",
+	DebugAABBsAction:      "debugAABBs",
+	DebugContactsAction:   "debugContacts",
+	DebugVelocitiesAction: "debugVelocities",
+	DebugJointsAction:     "debugJoints",
+	DebugSleepingAction:   "debugSleeping",
+}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return "unknown"
+	}
+	return actionNames[a]
+}
+
+// ParseAction returns the action with the given name.
+func ParseAction(name string) (Action, error) {
+	for a, n := range actionNames {
+		if n == name {
+			return Action(a), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown action %q", name)
+}
+
+// DefaultBindings returns the keys and the mouse buttons bound to
+// each action by default. Modifiers are joined to keys and buttons
+// with a plus sign, like "Shift+MouseLeft".
+func DefaultBindings() map[string][]string {
+	return map[string][]string{
+		"explode":    {"E", "MouseMiddle"},
+		"dropBox":    {"B", "Shift+MouseLeft"},
+		"reset":      {"R"},
+		"pause":      {"P", "Space"},
+		"step":       {"N", "Period"},
+		"debugDraw":  {"D", "F1"},
+		"screenshot": {"F12"},
+		"undo":       {"Ctrl+Z"},
+		"redo":       {"Ctrl+Y", "Ctrl+Shift+Z"},
+		"edit":       {"Tab"},
+		"delete":     {"Delete", "Backspace"},
+		"rotate":     {"Q"},
+		"snap":       {"G"},
+		"play":       {"Enter"},
+		"save":       {"Ctrl+S"},
+
+		"debugOutlines":   {"F2"},
+		"debugAABBs":      {"F3"},
+		"debugContacts":   {"F4"},
+		"debugVelocities": {"F5"},
+		"debugJoints":     {"F6"},
+		"debugSleeping":   {"F7"},
+	}
+}
+
+// mergeBindings adds the default bindings of the actions missing
+// from bindings. A key or a button bound to an action in bindings is
+// removed from the defaults of the other actions, so that it can be
+// rebound without unbinding it first.
+func mergeBindings(defaults, bindings map[string][]string) map[string][]string {
+	merged := make(map[string][]string, len(defaults))
+	bound := make(map[string]bool)
+	for name, inputs := range bindings {
+		merged[name] = inputs
+		for _, s := range inputs {
+			bound[normalizeBinding(s)] = true
+		}
+	}
+	for name, inputs := range defaults {
+		if _, ok := merged[name]; ok {
+			continue
+		}
+		kept := make([]string, 0, len(inputs))
+		for _, s := range inputs {
+			if !bound[normalizeBinding(s)] {
+				kept = append(kept, s)
+			}
+		}
+		merged[name] = kept
+	}
+	return merged
+}
+
+// normalizeBinding returns the same string for the spellings of a
+// binding, like "ctrl+shift+z" and "Shift+Ctrl+Z".
+func normalizeBinding(s string) string {
+	parts := strings.Split(strings.ToUpper(s), "+")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	sort.Strings(parts[:len(parts)-1])
+	return strings.Join(parts, "+")
+}
+
+// Do performs the action at the given window coordinates. Taking
+// screenshots is left to the caller, see Screenshot. While editing
+// the actions of the player are ignored.
+func (s *GameState) Do(action Action, x, y float32) {
+	switch action {
+	case DebugDrawAction:
+		if s.World.DebugDraw() == nil {
+			s.World.EnableDebugDraw()
+		} else {
+			s.World.DisableDebugDraw()
+		}
+		return
+	case EditAction:
+		s.SetEditing(!s.editing)
+		return
+	}
+	if layer := debugLayer(action); layer != 0 {
+		if debug := s.World.DebugDraw(); debug != nil {
+			debug.Toggle(layer)
+		} else {
+			s.World.EnableDebugDraw().Layers |= layer
+		}
+		return
+	}
+
+	if s.editing {
+		switch action {
+		case DeleteAction:
+			s.editor.Delete()
+		case RotateAction:
+			s.editor.Rotate()
+		case SnapAction:
+			s.editor.ToggleSnap()
+		case PlayAction:
+			s.editor.TogglePlay()
+		case SaveAction:
+			s.editor.Save()
+		}
+		return
+	}
+
+	switch action {
+	case ExplodeAction:
+		s.Explode(x, y)
+	case DropBoxAction:
+		s.DropBox(x, y)
+	case ResetAction:
+		s.Reset()
+	case UndoAction:
+		s.Undo()
+	case RedoAction:
+		s.Redo()
+	case PauseAction:
+		s.SetPaused(!s.Paused())
+	case StepAction:
+		s.Step()
+	}
+}
@@ -0,0 +1,82 @@
+package chipmunklib
+
+import (
+	"image/color"
+
+	"github.com/remogatto/mandala-examples/ads"
+)
+
+// The height in pixels of the banner placeholder
+const adBannerHeight = 50
+
+var (
+	adInterstitialColor = rgba(color.RGBA{40, 40, 120, 220})
+	adBannerColor       = rgba(color.RGBA{120, 40, 40, 220})
+)
+
+// adPlaceholder marks where the ads would be when they are shown
+// by a mock provider.
+type adPlaceholder struct {
+	hud                  *HUD
+	quads                *batch
+	interstitial, banner *Label
+}
+
+func newAdPlaceholder(hud *HUD) *adPlaceholder {
+	p := &adPlaceholder{
+		hud:          hud,
+		quads:        newBatch(hud.world.renderer.flat.material),
+		interstitial: hud.NewLabel(Center, 0, 0),
+		banner:       hud.NewLabel(Bottom, 0, adBannerHeight/2),
+	}
+	p.interstitial.SetText(hud.world.messages.T("adInterstitial"))
+	p.interstitial.Visible = false
+	p.banner.SetText(hud.world.messages.T("adBanner"))
+	p.banner.Visible = false
+	return p
+}
+
+// ShowAdPlaceholder shows or hides the placeholder of an ad.
+func (s *GameState) ShowAdPlaceholder(format ads.Format, visible bool) {
+	switch format {
+	case ads.Interstitial:
+		s.ads.interstitial.Visible = visible
+	case ads.Banner:
+		s.ads.banner.Visible = visible
+	}
+}
+
+// draw fills the area of the ads shown. Their labels are drawn with
+// the others.
+func (p *adPlaceholder) draw() {
+	if !p.interstitial.Visible && !p.banner.Visible {
+		return
+	}
+	b := p.quads
+	b.begin()
+	w, h := p.hud.width, p.hud.height
+	if p.banner.Visible {
+		addRect(b, 0, 0, w, adBannerHeight, adBannerColor)
+	}
+	if p.interstitial.Visible {
+		addRect(b, 0, 0, w, h, adInterstitialColor)
+	}
+	p.hud.begin()
+	b.flush(&p.hud.projMatrix, &p.hud.viewMatrix)
+	p.hud.end()
+}
+
+func (p *adPlaceholder) release() {
+	p.quads.release()
+}
+
+// addRect adds an axis aligned rectangle to a batch drawing
+// gl.TRIANGLES.
+func addRect(b *batch, x0, y0, x1, y1 float32, c [4]byte) {
+	b.addVertex(x0, y0, c)
+	b.addVertex(x1, y0, c)
+	b.addVertex(x1, y1, c)
+	b.addVertex(x1, y1, c)
+	b.addVertex(x0, y1, c)
+	b.addVertex(x0, y0, c)
+}
@@ -0,0 +1,39 @@
+package chipmunklib
+
+import (
+	"time"
+
+	"github.com/remogatto/mandala-examples/analytics"
+)
+
+// SetTracker starts tracking the events of the player with t and
+// tracks the start of the level.
+func (s *GameState) SetTracker(t *analytics.Tracker) {
+	s.tracker = t
+	s.trackLevelStart()
+}
+
+// TrackTap tracks a tap at the given window coordinates.
+func (s *GameState) TrackTap(x, y float32) {
+	s.tracker.Track(analytics.Tap{X: x, Y: y})
+}
+
+func (s *GameState) trackLevelStart() {
+	s.levelStart = time.Now()
+	s.tracker.Track(analytics.LevelStart{Level: s.World.config.Level})
+}
+
+// TrackLevelEnd tracks the time spent in the level and why it ended,
+// like "reset" or "quit".
+func (s *GameState) TrackLevelEnd(reason string) {
+	s.tracker.Track(analytics.LevelEnd{
+		Level:   s.World.config.Level,
+		Seconds: time.Since(s.levelStart).Seconds(),
+		Reason:  reason,
+	})
+}
+
+// trackExplosion tracks an explosion at the given world coordinates.
+func (s *GameState) trackExplosion(x, y float32) {
+	s.tracker.Track(analytics.Explosion{X: x, Y: y, Bodies: len(s.World.boxes)})
+}
@@ -0,0 +1,227 @@
+package chipmunklib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"path/filepath"
+	"sort"
+
+	"github.com/remogatto/gltext"
+	"github.com/remogatto/mandala"
+)
+
+const (
+	// The manifest listing the sprites to pack in the atlas.
+	AtlasManifest = "drawable/sprites.json"
+
+	// The maximum size of the atlas texture. 2048 is the minimum
+	// supported by most of the OpenGL ES 2.0 devices.
+	maxAtlasSize = 2048
+
+	// The border around each region in the atlas, filled by
+	// extruding the edge pixels of the image, so that linear
+	// filtering near the edges doesn't sample the neighbours.
+	atlasPadding = 2
+)
+
+// The sprites in the manifest are described by the name used to
+// reference them from the level file, the PNG image in the drawable
+// folder and, optionally, the left, top, right and bottom borders
+// in pixels for 9-slice scaling.
+type atlasManifest struct {
+	Sprites []struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+		Slice [4]int `json:"slice"`
+	} `json:"sprites"`
+}
+
+// atlasRegion is a named rectangle in the atlas texture.
+type atlasRegion struct {
+	name  string
+	rect  image.Rectangle
+	slice [4]int
+
+	// Texture coordinates of the region
+	u0, v0, u1, v1 float32
+
+	// The size of a pixel in texture coordinates
+	du, dv float32
+
+	// The column and the row of a fragment of a sprite in a grid
+	// of cols x rows fragments, nil for the whole sprite
+	piece []int
+}
+
+// sliced returns true if the region has to be drawn using 9-slice
+// scaling.
+func (r *atlasRegion) sliced() bool {
+	return r.slice != [4]int{}
+}
+
+// fragment returns the part of the region drawn on the fragment in
+// column i and row j of a box shattered in cols x rows fragments.
+// Rows are counted from the bottom. The fragments of a sliced
+// region sample it unsliced.
+func (r *atlasRegion) fragment(i, j, cols, rows int) *atlasRegion {
+	f := *r
+	f.slice = [4]int{}
+	f.piece = []int{i, j, cols, rows}
+	w, h := (r.u1-r.u0)/float32(cols), (r.v1-r.v0)/float32(rows)
+	f.u0, f.u1 = r.u0+float32(i)*w, r.u0+float32(i+1)*w
+	f.v0, f.v1 = r.v1-float32(j+1)*h, r.v1-float32(j)*h
+	return &f
+}
+
+// textureAtlas holds many images packed in a single texture, so
+// that all the sprites can be drawn in one call.
+type textureAtlas struct {
+	texture gltext.Texture
+	regions map[string]*atlasRegion
+}
+
+// region returns the region with the given name.
+func (a *textureAtlas) region(name string) (*atlasRegion, error) {
+	r, ok := a.regions[name]
+	if !ok {
+		return nil, fmt.Errorf("Sprite %q not found in the atlas", name)
+	}
+	return r, nil
+}
+
+type atlasImage struct {
+	region *atlasRegion
+	img    image.Image
+}
+
+type byHeight []atlasImage
+
+func (s byHeight) Len() int      { return len(s) }
+func (s byHeight) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byHeight) Less(i, j int) bool {
+	return s[i].img.Bounds().Dy() > s[j].img.Bounds().Dy()
+}
+
+func readResource(filename string) ([]byte, error) {
+	responseCh := make(chan mandala.LoadResourceResponse)
+	mandala.ReadResource(filename, responseCh)
+	response := <-responseCh
+	return response.Buffer, response.Error
+}
+
+// loadAtlas reads the manifest, decodes the PNG images listed in it
+// and packs them into a texture atlas uploaded through the world.
+func loadAtlas(w *World, manifestFilename string) (*textureAtlas, error) {
+	var manifest atlasManifest
+
+	buf, err := readResource(manifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(manifestFilename)
+	images := make([]atlasImage, 0, len(manifest.Sprites))
+	for _, sprite := range manifest.Sprites {
+		buf, err := readResource(filepath.Join(dir, sprite.Image))
+		if err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(bytes.NewBuffer(buf))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", sprite.Image, err)
+		}
+		images = append(images, atlasImage{
+			region: &atlasRegion{name: sprite.Name, slice: sprite.Slice},
+			img:    img,
+		})
+	}
+
+	size, err := packAtlas(images)
+	if err != nil {
+		return nil, err
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, size, size))
+	atlas := &textureAtlas{regions: make(map[string]*atlasRegion)}
+	for _, i := range images {
+		r := i.region
+		draw.Draw(rgba, r.rect, i.img, i.img.Bounds().Min, draw.Src)
+		extrude(rgba, r.rect, atlasPadding)
+		r.du, r.dv = 1/float32(size), 1/float32(size)
+		r.u0, r.v0 = float32(r.rect.Min.X)*r.du, float32(r.rect.Min.Y)*r.dv
+		r.u1, r.v1 = float32(r.rect.Max.X)*r.du, float32(r.rect.Max.Y)*r.dv
+		atlas.regions[r.name] = r
+	}
+
+	if len(images) > 0 {
+		atlas.texture = w.UploadRGBAImage(rgba)
+	}
+
+	return atlas, nil
+}
+
+// packAtlas places the images on shelves, tallest first, and
+// returns the size of the smallest power of two square texture
+// containing them all.
+func packAtlas(images []atlasImage) (int, error) {
+	sort.Sort(byHeight(images))
+	for size := 64; size <= maxAtlasSize; size *= 2 {
+		if packShelves(images, size) {
+			return size, nil
+		}
+	}
+	return 0, fmt.Errorf("Sprites don't fit in a %dx%d atlas", maxAtlasSize, maxAtlasSize)
+}
+
+// packShelves places each image in a cell as large as the image and
+// its border.
+func packShelves(images []atlasImage, size int) bool {
+	x, y, shelfHeight := 0, 0, 0
+	for _, i := range images {
+		w, h := i.img.Bounds().Dx()+2*atlasPadding, i.img.Bounds().Dy()+2*atlasPadding
+		if x+w > size {
+			x, y = 0, y+shelfHeight
+			shelfHeight = 0
+		}
+		if x+w > size || y+h > size {
+			return false
+		}
+		i.region.rect = image.Rect(x+atlasPadding, y+atlasPadding, x+w-atlasPadding, y+h-atlasPadding)
+		x += w
+		if h > shelfHeight {
+			shelfHeight = h
+		}
+	}
+	return true
+}
+
+// extrude copies the edge pixels of the rectangle r of img outward
+// by n pixels, corners included.
+func extrude(img *image.RGBA, r image.Rectangle, n int) {
+	for y := r.Min.Y - n; y < r.Max.Y+n; y++ {
+		sy := clampInt(y, r.Min.Y, r.Max.Y-1)
+		for x := r.Min.X - n; x < r.Max.X+n; x++ {
+			if y >= r.Min.Y && y < r.Max.Y && x >= r.Min.X && x < r.Max.X {
+				continue
+			}
+			img.SetRGBA(x, y, img.RGBAAt(clampInt(x, r.Min.X, r.Max.X-1), sy))
+		}
+	}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,342 @@
+package chipmunklib
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/remogatto/gltext"
+	"github.com/remogatto/mathgl"
+	gl "github.com/remogatto/opengles2"
+	"github.com/remogatto/shaders"
+	"github.com/vova616/chipmunk"
+)
+
+const (
+	// The initial number of vertices a batch can hold before
+	// growing. Boxes take 6 vertices each.
+	batchCapacity = 6 * 1024
+
+	flatVS = `
+uniform mat4 projection;
+uniform mat4 view;
+attribute vec2 pos;
+attribute vec4 color;
+varying vec4 vColor;
+
+void main() {
+	gl_Position = projection*view*vec4(pos, 0.0, 1.0);
+	vColor = color;
+}
+`
+	flatFS = `
+precision mediump float;
+varying vec4 vColor;
+
+void main() {
+	gl_FragColor = vColor;
+}
+`
+	spriteVS = `
+uniform mat4 projection;
+uniform mat4 view;
+attribute vec2 pos;
+attribute vec2 texCoord;
+attribute vec4 color;
+varying vec2 vTexCoord;
+varying vec4 vColor;
+
+void main() {
+	gl_Position = projection*view*vec4(pos, 0.0, 1.0);
+	vTexCoord = texCoord;
+	vColor = color;
+}
+`
+	spriteFS = `
+precision mediump float;
+uniform sampler2D texture;
+varying vec2 vTexCoord;
+varying vec4 vColor;
+
+void main() {
+	gl_FragColor = texture2D(texture, vTexCoord)*vColor;
+}
+`
+)
+
+// drawCalls counts the draw calls issued since the start of the
+// frame. Frames are drawn by the thread of the GL context only.
+var drawCalls int
+
+// material holds the shader program, and its locations, used to
+// draw a batch. Textured materials also hold the texture to sample
+// from.
+type material struct {
+	program                        shaders.Program
+	attrPos, attrColor             uint32
+	uniformProjection, uniformView uint32
+
+	texture        gltext.Texture
+	attrTexCoord   uint32
+	uniformTexture uint32
+}
+
+func newMaterial(fsh shaders.FragmentShader, vsh shaders.VertexShader) *material {
+	m := new(material)
+	m.program = shaders.NewProgram(fsh, vsh)
+	m.program.Use()
+	m.attrPos = m.program.GetAttribute("pos")
+	m.attrColor = m.program.GetAttribute("color")
+	m.uniformProjection = m.program.GetUniform("projection")
+	m.uniformView = m.program.GetUniform("view")
+	return m
+}
+
+func newTexturedMaterial(fsh shaders.FragmentShader, vsh shaders.VertexShader, texture gltext.Texture) *material {
+	m := newMaterial(fsh, vsh)
+	m.texture = texture
+	m.attrTexCoord = m.program.GetAttribute("texCoord")
+	m.uniformTexture = m.program.GetUniform("texture")
+	return m
+}
+
+func (m *material) release() {
+	gl.DeleteProgram(uint32(m.program))
+}
+
+// batch collects the vertices of the shapes sharing a material,
+// already transformed in world coordinates, and draws them with a
+// single call. The vertex data are streamed to the GPU once per
+// frame.
+type batch struct {
+	material *material
+
+	// The primitive drawn, gl.TRIANGLES by default
+	mode gl.Enum
+
+	positions []float32
+	texCoords []float32
+	colors    []byte
+
+	positionBuffer, texCoordBuffer, colorBuffer uint32
+}
+
+func newBatch(m *material) *batch {
+	b := &batch{
+		material:  m,
+		mode:      gl.TRIANGLES,
+		positions: make([]float32, 0, 2*batchCapacity),
+		colors:    make([]byte, 0, 4*batchCapacity),
+	}
+	gl.GenBuffers(1, &b.positionBuffer)
+	gl.GenBuffers(1, &b.colorBuffer)
+	if m.texture != nil {
+		b.texCoords = make([]float32, 0, 2*batchCapacity)
+		gl.GenBuffers(1, &b.texCoordBuffer)
+	}
+	return b
+}
+
+// begin empties the batch keeping the allocated memory.
+func (b *batch) begin() {
+	b.positions = b.positions[:0]
+	b.texCoords = b.texCoords[:0]
+	b.colors = b.colors[:0]
+}
+
+func (b *batch) addVertex(x, y float32, c [4]byte) {
+	b.positions = append(b.positions, x, y)
+	b.colors = append(b.colors, c[0], c[1], c[2], c[3])
+}
+
+func (b *batch) addTexturedVertex(x, y, u, v float32, c [4]byte) {
+	b.addVertex(x, y, c)
+	b.texCoords = append(b.texCoords, u, v)
+}
+
+// addLine adds a segment to a batch drawing gl.LINES.
+func (b *batch) addLine(x0, y0, x1, y1 float32, c [4]byte) {
+	b.addVertex(x0, y0, c)
+	b.addVertex(x1, y1, c)
+}
+
+// addPolygon adds a convex polygon given its transformed vertices.
+func (b *batch) addPolygon(verts chipmunk.Vertices, c [4]byte) {
+	for i := 1; i < len(verts)-1; i++ {
+		b.addVertex(float32(verts[0].X), float32(verts[0].Y), c)
+		b.addVertex(float32(verts[i].X), float32(verts[i].Y), c)
+		b.addVertex(float32(verts[i+1].X), float32(verts[i+1].Y), c)
+	}
+}
+
+// addShape adds a box or a polygon shape. Other shapes are
+// ignored.
+func (b *batch) addShape(shape *chipmunk.Shape, c [4]byte) {
+	switch shape.ShapeClass.ShapeType() {
+	case chipmunk.ShapeType_Box:
+		b.addPolygon(shape.GetAsBox().Polygon.TVerts, c)
+	case chipmunk.ShapeType_Polygon:
+		b.addPolygon(shape.GetAsPolygon().TVerts, c)
+	}
+}
+
+// addSprite adds a sprite of the given size centered in (x, y) and
+// rotated by angle radians. Sliced regions keep their borders
+// unscaled and stretch the center, the borders shrink if they don't
+// fit in the sprite.
+func (b *batch) addSprite(r *atlasRegion, x, y, angle, width, height float32, c [4]byte) {
+	var xs, ys, us, vs [4]float32
+
+	left, top, right, bottom := float32(r.slice[0]), float32(r.slice[1]), float32(r.slice[2]), float32(r.slice[3])
+	if k := width / (left + right); k < 1 {
+		left, right = left*k, right*k
+	}
+	if k := height / (top + bottom); k < 1 {
+		top, bottom = top*k, bottom*k
+	}
+
+	xs = [4]float32{-width / 2, -width/2 + left, width/2 - right, width / 2}
+	ys = [4]float32{-height / 2, -height/2 + bottom, height/2 - top, height / 2}
+
+	// Image rows grow downward, so the bottom of the sprite
+	// samples from v1.
+	us = [4]float32{r.u0, r.u0 + float32(r.slice[0])*r.du, r.u1 - float32(r.slice[2])*r.du, r.u1}
+	vs = [4]float32{r.v1, r.v1 - float32(r.slice[3])*r.dv, r.v0 + float32(r.slice[1])*r.dv, r.v0}
+
+	sin, cos := math.Sincos(float64(angle))
+	sinA, cosA := float32(sin), float32(cos)
+	transform := func(lx, ly float32) (float32, float32) {
+		return x + lx*cosA - ly*sinA, y + lx*sinA + ly*cosA
+	}
+
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			if xs[i] == xs[i+1] || ys[j] == ys[j+1] {
+				continue
+			}
+			x0, y0 := transform(xs[i], ys[j])
+			x1, y1 := transform(xs[i+1], ys[j])
+			x2, y2 := transform(xs[i+1], ys[j+1])
+			x3, y3 := transform(xs[i], ys[j+1])
+			b.addTexturedVertex(x0, y0, us[i], vs[j], c)
+			b.addTexturedVertex(x1, y1, us[i+1], vs[j], c)
+			b.addTexturedVertex(x2, y2, us[i+1], vs[j+1], c)
+			b.addTexturedVertex(x2, y2, us[i+1], vs[j+1], c)
+			b.addTexturedVertex(x3, y3, us[i], vs[j+1], c)
+			b.addTexturedVertex(x0, y0, us[i], vs[j], c)
+		}
+	}
+}
+
+// flush uploads the collected vertices and draws them using the
+// given projection and view matrices.
+func (b *batch) flush(proj, view *mathgl.Mat4f) {
+	count := len(b.positions) / 2
+	if count == 0 {
+		return
+	}
+
+	m := b.material
+	m.program.Use()
+
+	gl.UniformMatrix4fv(int32(m.uniformProjection), 1, false, &proj[0])
+	gl.UniformMatrix4fv(int32(m.uniformView), 1, false, &view[0])
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, b.positionBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.SizeiPtr(len(b.positions)*4), gl.Void(&b.positions[0]), gl.STREAM_DRAW)
+	gl.EnableVertexAttribArray(m.attrPos)
+	gl.VertexAttribPointer(m.attrPos, 2, gl.FLOAT, false, 0, nil)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, b.colorBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.SizeiPtr(len(b.colors)), gl.Void(&b.colors[0]), gl.STREAM_DRAW)
+	gl.EnableVertexAttribArray(m.attrColor)
+	gl.VertexAttribPointer(m.attrColor, 4, gl.UNSIGNED_BYTE, true, 0, nil)
+
+	if m.texture != nil {
+		gl.BindBuffer(gl.ARRAY_BUFFER, b.texCoordBuffer)
+		gl.BufferData(gl.ARRAY_BUFFER, gl.SizeiPtr(len(b.texCoords)*4), gl.Void(&b.texCoords[0]), gl.STREAM_DRAW)
+		gl.EnableVertexAttribArray(m.attrTexCoord)
+		gl.VertexAttribPointer(m.attrTexCoord, 2, gl.FLOAT, false, 0, nil)
+
+		gl.ActiveTexture(gl.TEXTURE0)
+		gl.BindTexture(gl.TEXTURE_2D, m.texture.Id())
+		gl.Uniform1i(int32(m.uniformTexture), 0)
+	}
+
+	gl.DrawArrays(b.mode, 0, gl.Sizei(count))
+	drawCalls++
+
+	gl.DisableVertexAttribArray(m.attrPos)
+	gl.DisableVertexAttribArray(m.attrColor)
+	if m.texture != nil {
+		gl.DisableVertexAttribArray(m.attrTexCoord)
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+func (b *batch) release() {
+	gl.DeleteBuffers(1, &b.positionBuffer)
+	gl.DeleteBuffers(1, &b.colorBuffer)
+	if b.material.texture != nil {
+		gl.DeleteBuffers(1, &b.texCoordBuffer)
+	}
+}
+
+// batchRenderer draws the dynamic bodies of the world using a batch
+// per material.
+type batchRenderer struct {
+	world     *World
+	materials []*material
+	batches   []*batch
+
+	// The batch for flat colored shapes
+	flat *batch
+
+	// The batch for the sprites in the world's atlas, nil if the
+	// atlas is empty
+	sprites *batch
+}
+
+func newBatchRenderer(world *World) *batchRenderer {
+	r := &batchRenderer{world: world}
+	r.flat = r.addBatch(newMaterial(flatFS, flatVS))
+	if world.atlas.texture != nil {
+		r.sprites = r.addBatch(newTexturedMaterial(spriteFS, spriteVS, world.atlas.texture))
+	}
+	return r
+}
+
+func (r *batchRenderer) addBatch(m *material) *batch {
+	b := newBatch(m)
+	r.materials = append(r.materials, m)
+	r.batches = append(r.batches, b)
+	return b
+}
+
+// begin starts collecting a new frame.
+func (r *batchRenderer) begin() {
+	for _, b := range r.batches {
+		b.begin()
+	}
+}
+
+// flush draws all the batches, a draw call for each material.
+func (r *batchRenderer) flush() {
+	for _, b := range r.batches {
+		b.flush(&r.world.projMatrix, &r.world.viewMatrix)
+	}
+}
+
+func (r *batchRenderer) release() {
+	for _, b := range r.batches {
+		b.release()
+	}
+	for _, m := range r.materials {
+		m.release()
+	}
+}
+
+// rgba converts c to its 8 bit per channel representation.
+func rgba(c color.Color) [4]byte {
+	r, g, b, a := c.RGBA()
+	return [4]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8), byte(a >> 8)}
+}
@@ -1,12 +1,13 @@
 package chipmunklib
 
 import (
-	"github.com/remogatto/mandala"
-	"github.com/remogatto/shapes"
+	"image/color"
+
 	"github.com/vova616/chipmunk"
 	"github.com/vova616/chipmunk/vect"
 )
 
+// The default physical properties of the boxes
 const (
 	BoxMass       = 5.0
 	BoxElasticity = 0.6
@@ -17,32 +18,47 @@ const (
 
 type callbacks struct{}
 
-type impactUserData struct {
-	player       *mandala.AudioPlayer
-	impactBuffer []byte
-}
-
 type Box struct {
 	// Chipumunk stuff
 	physicsBody  *chipmunk.Body
 	physicsShape *chipmunk.Shape
 
-	// OpenGL stuff
-	openglShape *shapes.Box
+	// The color of the box, drawn by the world's batch renderer
+	color [4]byte
+
+	// The sprite drawn in place of the flat colored box, if any
+	sprite *atlasRegion
+
+	width, height float32
+
+	// The elasticity of the physics shape
+	elasticity float32
+
+	// The impulse that shatters the box into fragments, zero if
+	// the box is unbreakable
+	breakImpulse float32
+	fragments    int
+	broken       bool
 
 	world *World
 }
 
 func (c callbacks) CollisionEnter(arbiter *chipmunk.Arbiter) bool {
-	a := arbiter.BodyA
-	b := arbiter.BodyB
-	impact, ok := a.UserData.(impactUserData)
-	if ok {
-		impact.player.Play(impact.impactBuffer, nil)
+	var world *World
+	if box, ok := arbiter.BodyA.UserData.(*Box); ok {
+		world = box.world
 	}
-	impact, ok = b.UserData.(impactUserData)
-	if ok {
-		impact.player.Play(impact.impactBuffer, nil)
+	if box, ok := arbiter.BodyB.UserData.(*Box); ok {
+		world = box.world
+	}
+	if world == nil {
+		return true
+	}
+	world.impactPlayer.Play(world.impactBuffer, nil)
+	// Show the impact where the bodies touch
+	if len(arbiter.Contacts) > 0 {
+		pos := arbiter.Contacts[0].Position()
+		world.particles.emit("impact", float32(pos.X), float32(pos.Y))
 	}
 	return true
 }
@@ -51,12 +67,24 @@ func (c callbacks) CollisionPreSolve(arbiter *chipmunk.Arbiter) bool {
 	return true
 }
 
-func (c callbacks) CollisionPostSolve(arbiter *chipmunk.Arbiter) {}
+// CollisionPostSolve breaks the breakable boxes hit hard enough.
+// The space can't be changed while stepping, so the boxes are
+// shattered after the step.
+func (c callbacks) CollisionPostSolve(arbiter *chipmunk.Arbiter) {
+	impulse := float32(arbiter.TotalImpulse().Length())
+	if box, ok := arbiter.BodyA.UserData.(*Box); ok {
+		box.hit(impulse)
+	}
+	if box, ok := arbiter.BodyB.UserData.(*Box); ok {
+		box.hit(impulse)
+	}
+}
 
 func (c callbacks) CollisionExit(arbiter *chipmunk.Arbiter) {}
 
 func newBox(world *World, width, height float32) *Box {
 	box := new(Box)
+	box.width, box.height = width, height
 
 	// Chipmunk body
 
@@ -66,29 +94,85 @@ func newBox(world *World, width, height float32) *Box {
 		vect.Float(height),
 	)
 
-	box.physicsShape.SetElasticity(BoxElasticity)
-	box.physicsBody = chipmunk.NewBody(vect.Float(BoxMass), box.physicsShape.Moment(float32(BoxMass)))
+	mass := world.config.Box.Mass
+	box.setElasticity(world.config.Box.Elasticity)
+	box.physicsBody = chipmunk.NewBody(vect.Float(mass), box.physicsShape.Moment(mass))
 	box.physicsBody.AddShape(box.physicsShape)
 	box.physicsBody.CallbackHandler = callbacks{}
 
-	// OpenGL shape
-
-	box.openglShape = shapes.NewBox(world.boxProgramShader, width, height)
+	box.color = rgba(color.White)
 
 	return box
 }
 
-func (box *Box) draw() {
+// reset brings the body of a recycled box back to its initial
+// state.
+func (box *Box) reset() {
+	box.physicsBody.SetPosition(vect.Vect{0, 0})
+	box.physicsBody.SetAngle(0)
+	box.physicsBody.SetVelocity(0, 0)
+	box.physicsBody.SetAngularVelocity(0)
+	box.physicsBody.SetForce(0, 0)
+	mass := box.world.config.Box.Mass
+	box.physicsBody.SetMass(vect.Float(mass))
+	box.physicsBody.SetMoment(box.physicsShape.Moment(mass))
+	box.setElasticity(box.world.config.Box.Elasticity)
+	box.color = rgba(color.White)
+	box.sprite = nil
+	box.breakImpulse = 0
+	box.fragments = 0
+	box.broken = false
+}
+
+// release drops the references to the physics objects. The box
+// can't be used anymore after being released.
+func (box *Box) release() {
+	box.physicsBody.CallbackHandler = nil
+	box.physicsBody.UserData = nil
+	box.physicsBody = nil
+	box.physicsShape = nil
+	box.world = nil
+}
+
+func (box *Box) setElasticity(e float32) {
+	box.elasticity = e
+	box.physicsShape.SetElasticity(e)
+}
+
+func (box *Box) setColor(c color.Color) {
+	box.color = rgba(c)
+}
+
+// setSprite makes the box drawn using the given atlas region. The
+// color of the box is used to tint the sprite.
+func (box *Box) setSprite(r *atlasRegion) {
+	box.sprite = r
+	box.color = rgba(color.White)
+}
+
+// center returns the position of the box in world coordinates.
+func (box *Box) center() (float32, float32) {
 	pos := box.physicsBody.Position()
-	rot := box.physicsBody.Angle() * chipmunk.DegreeConst
-	box.openglShape.MoveTo(float32(pos.X), float32(pos.Y))
-	box.openglShape.Rotate(float32(rot))
-	box.openglShape.Draw()
+	return float32(pos.X), float32(pos.Y)
+}
+
+// draw adds the box to the world's batch. The batch is drawn at the
+// end of the frame.
+func (box *Box) draw() {
+	if box.sprite != nil {
+		x, y := box.center()
+		angle := float32(box.physicsBody.Angle())
+		box.world.renderer.sprites.addSprite(box.sprite, x, y, angle, box.width, box.height, box.color)
+		return
+	}
+	box.world.renderer.flat.addShape(box.physicsShape, box.color)
 }
 
+// inViewport returns false if the box fell off the horizontal
+// bounds of the level.
 func (box *Box) inViewport() bool {
 	pos := box.physicsBody.Position()
-	r := box.openglShape.Bounds()
-	width := float32(r.Dx())
-	return (float32(pos.X) > -width) && (float32(pos.X) < (width + float32(box.world.width)))
+	width := box.width
+	minX, _, maxX, _ := box.world.camera.Bounds()
+	return (float32(pos.X) > minX-width) && (float32(pos.X) < (maxX + width))
 }
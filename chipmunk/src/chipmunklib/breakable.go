@@ -0,0 +1,136 @@
+package chipmunklib
+
+import (
+	"math"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+const (
+	// The sound played when a box shatters
+	BreakSoundFilename = "raw/break.pcm"
+
+	// The number of fragments of a breakable box if not given
+	DefaultFragments = 4
+
+	// The impulse that shatters the boxes made breakable in the
+	// editor
+	DefaultBreakImpulse = 2000
+
+	// The maximum number of boxes shattered at each step, further
+	// boxes break at the next steps
+	maxBreaksPerStep = 16
+
+	// The smallest size in pixels of a fragment
+	minFragmentSize = 4
+)
+
+// SetBreakable makes the box shatter into the given number of
+// fragments when hit with an impulse greater than threshold. A zero
+// threshold makes the box unbreakable.
+func (box *Box) SetBreakable(threshold float32, fragments int) {
+	if fragments < 2 {
+		fragments = DefaultFragments
+	}
+	box.breakImpulse = threshold
+	box.fragments = fragments
+}
+
+// hit queues the box to be shattered if the impulse is strong
+// enough.
+func (box *Box) hit(impulse float32) {
+	if box.breakImpulse <= 0 || box.broken || impulse < box.breakImpulse {
+		return
+	}
+	w := box.world
+	if len(w.breaking) == cap(w.breaking) {
+		return
+	}
+	box.broken = true
+	w.breaking = append(w.breaking, box)
+}
+
+// shatterBoxes replaces the boxes broken during the last step with
+// their fragments.
+func (w *World) shatterBoxes() {
+	for i, box := range w.breaking {
+		w.shatter(box)
+		w.breaking[i] = nil
+	}
+	w.breaking = w.breaking[:0]
+}
+
+// fragmentGrid returns the number of columns and rows of the grid
+// of n fragments that best fits a box of the given size.
+func fragmentGrid(n int, width, height float32) (cols, rows int) {
+	cols, rows = n, 1
+	best := math.Inf(1)
+	for c := 1; c <= n; c++ {
+		if n%c != 0 {
+			continue
+		}
+		r := n / c
+		// Prefer fragments as square as possible
+		d := math.Abs(math.Log(float64(width/float32(c)) / float64(height/float32(r))))
+		if d < best {
+			best, cols, rows = d, c, r
+		}
+	}
+	return cols, rows
+}
+
+// shatter removes the box from the world and adds its fragments.
+// The fragments share the mass of the box and move as parts of it.
+func (w *World) shatter(box *Box) {
+	index := w.indexOf(box)
+	if index < 0 {
+		return
+	}
+
+	body := box.physicsBody
+	pos, vel := body.Position(), body.Velocity()
+	angle := body.Angle()
+	spin := body.AngularVelocity()
+	cols, rows := fragmentGrid(box.fragments, box.width, box.height)
+	fw, fh := box.width/float32(cols), box.height/float32(rows)
+	mass := float32(body.Mass()) / float32(cols*rows)
+	c := box.color
+	sprite := box.sprite
+
+	w.removeBox(box, index)
+
+	w.breakPlayer.Play(w.breakBuffer, nil)
+	w.particles.emit("debris", float32(pos.X), float32(pos.Y))
+
+	if fw < minFragmentSize || fh < minFragmentSize {
+		return
+	}
+
+	sin, cos := math.Sincos(float64(angle))
+	for i := 0; i < cols; i++ {
+		for j := 0; j < rows; j++ {
+			// The center of the fragment relative to the
+			// center of the box, rotated as the box
+			lx := (float32(i)+0.5)*fw - box.width/2
+			ly := (float32(j)+0.5)*fh - box.height/2
+			rx := lx*float32(cos) - ly*float32(sin)
+			ry := lx*float32(sin) + ly*float32(cos)
+
+			f := w.boxPool.get(w, fw, fh)
+			f.physicsBody.SetMass(vect.Float(mass))
+			f.physicsBody.SetMoment(f.physicsShape.Moment(mass))
+			f.physicsBody.SetPosition(vect.Vect{pos.X + vect.Float(rx), pos.Y + vect.Float(ry)})
+			f.physicsBody.SetAngle(angle)
+
+			// The velocity of the point of the box where the
+			// fragment was
+			f.physicsBody.SetVelocity(float32(vel.X)-spin*ry, float32(vel.Y)+spin*rx)
+			f.physicsBody.SetAngularVelocity(spin)
+			f.color = c
+			if sprite != nil {
+				f.sprite = sprite.fragment(i, j, cols, rows)
+			}
+			w.addBox(f)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package chipmunklib
+
+import (
+	"math"
+
+	"github.com/remogatto/mathgl"
+	"github.com/vova616/chipmunk"
+)
+
+const (
+	DefaultMinZoom = 0.25
+	DefaultMaxZoom = 4.0
+
+	// How fast the camera reaches the followed body. Higher is
+	// faster.
+	DefaultFollowSpeed = 5.0
+)
+
+// Camera looks at the world from a position, with a zoom factor and
+// a rotation. The position is the point of the world shown at the
+// center of the screen.
+type Camera struct {
+	X, Y     float32
+	Zoom     float32
+	Rotation float32 // in radians
+
+	MinZoom, MaxZoom float32
+	FollowSpeed      float32
+
+	// The size of the viewport in pixels
+	width, height float32
+
+	// The region of the world the camera can't look beyond
+	minX, minY, maxX, maxY float32
+	bounded                bool
+
+	target *chipmunk.Body
+}
+
+// NewCamera returns a camera for a viewport of the given size,
+// looking at its center.
+func NewCamera(width, height int) *Camera {
+	return &Camera{
+		X:           float32(width) / 2,
+		Y:           float32(height) / 2,
+		Zoom:        1,
+		MinZoom:     DefaultMinZoom,
+		MaxZoom:     DefaultMaxZoom,
+		FollowSpeed: DefaultFollowSpeed,
+		width:       float32(width),
+		height:      float32(height),
+	}
+}
+
+// SetViewport changes the size of the viewport.
+func (c *Camera) SetViewport(width, height int) {
+	c.width, c.height = float32(width), float32(height)
+	c.clamp()
+}
+
+// SetBounds limits the camera to show only the given region of the
+// world.
+func (c *Camera) SetBounds(minX, minY, maxX, maxY float32) {
+	c.minX, c.minY, c.maxX, c.maxY = minX, minY, maxX, maxY
+	c.bounded = true
+	c.clamp()
+}
+
+// Bounds returns the region of the world the camera is limited to.
+func (c *Camera) Bounds() (minX, minY, maxX, maxY float32) {
+	return c.minX, c.minY, c.maxX, c.maxY
+}
+
+// MoveTo moves the camera to look at the given world coordinates.
+func (c *Camera) MoveTo(x, y float32) {
+	c.X, c.Y = x, y
+	c.clamp()
+}
+
+// Pan moves the camera by the given amount of screen pixels. Screen
+// y grows downward.
+func (c *Camera) Pan(dx, dy float32) {
+	sin, cos := c.sincos()
+	dx, dy = dx/c.Zoom, -dy/c.Zoom
+	c.MoveTo(c.X-(cos*dx-sin*dy), c.Y-(sin*dx+cos*dy))
+}
+
+// ZoomTo sets the zoom factor keeping it within MinZoom and MaxZoom.
+func (c *Camera) ZoomTo(zoom float32) {
+	if zoom < c.MinZoom {
+		zoom = c.MinZoom
+	}
+	if zoom > c.MaxZoom {
+		zoom = c.MaxZoom
+	}
+	c.Zoom = zoom
+	c.clamp()
+}
+
+// ZoomAt multiplies the zoom by factor keeping the world point under
+// the given screen coordinates still.
+func (c *Camera) ZoomAt(factor, sx, sy float32) {
+	wx, wy := c.ScreenToWorld(sx, sy)
+	c.ZoomTo(c.Zoom * factor)
+	nx, ny := c.ScreenToWorld(sx, sy)
+	c.MoveTo(c.X+wx-nx, c.Y+wy-ny)
+}
+
+// RotateTo sets the rotation of the camera.
+func (c *Camera) RotateTo(angle float32) {
+	c.Rotation = angle
+}
+
+// Pinch zooms and pans the camera following two fingers moving on
+// the screen from (x0, y0), (x1, y1) to (nx0, ny0), (nx1, ny1). The
+// zoom changes with the distance between the fingers, and the
+// camera pans with their midpoint.
+func (c *Camera) Pinch(x0, y0, x1, y1, nx0, ny0, nx1, ny1 float32) {
+	d := float32(math.Hypot(float64(x1-x0), float64(y1-y0)))
+	nd := float32(math.Hypot(float64(nx1-nx0), float64(ny1-ny0)))
+	mx, my := (x0+x1)/2, (y0+y1)/2
+	nmx, nmy := (nx0+nx1)/2, (ny0+ny1)/2
+	if d > 0 && nd > 0 {
+		c.ZoomAt(nd/d, mx, my)
+	}
+	c.Pan(nmx-mx, nmy-my)
+}
+
+// Follow makes the camera smoothly follow the given body. Pass nil
+// to stop following.
+func (c *Camera) Follow(body *chipmunk.Body) {
+	c.target = body
+}
+
+// Following returns the body followed, nil if none.
+func (c *Camera) Following() *chipmunk.Body {
+	return c.target
+}
+
+// update moves the camera towards the followed body.
+func (c *Camera) update(dt float32) {
+	if c.target == nil {
+		return
+	}
+	pos := c.target.Position()
+	k := c.FollowSpeed * dt
+	if k > 1 {
+		k = 1
+	}
+	c.MoveTo(c.X+(float32(pos.X)-c.X)*k, c.Y+(float32(pos.Y)-c.Y)*k)
+}
+
+// clamp keeps the visible region within the bounds. If the bounds
+// are smaller than the visible region the camera looks at their
+// center.
+func (c *Camera) clamp() {
+	if !c.bounded {
+		return
+	}
+	hw, hh := c.width/(2*c.Zoom), c.height/(2*c.Zoom)
+	c.X = clampAxis(c.X, c.minX+hw, c.maxX-hw)
+	c.Y = clampAxis(c.Y, c.minY+hh, c.maxY-hh)
+}
+
+func clampAxis(v, min, max float32) float32 {
+	switch {
+	case min > max:
+		return (min + max) / 2
+	case v < min:
+		return min
+	case v > max:
+		return max
+	}
+	return v
+}
+
+func (c *Camera) sincos() (float32, float32) {
+	sin, cos := math.Sincos(float64(c.Rotation))
+	return float32(sin), float32(cos)
+}
+
+// View returns the view matrix of the camera.
+func (c *Camera) View() mathgl.Mat4f {
+	sin, cos := c.sincos()
+	// Rotate the world by the opposite of the camera rotation
+	cs, sn := cos*c.Zoom, -sin*c.Zoom
+	cx, cy := c.width/2, c.height/2
+	return mathgl.Mat4f{
+		cs, sn, 0, 0,
+		-sn, cs, 0, 0,
+		0, 0, 1, 0,
+		cx - cs*c.X + sn*c.Y, cy - sn*c.X - cs*c.Y, 0, 1,
+	}
+}
+
+// ScreenToWorld converts screen coordinates, with y growing
+// downward as in the touch events, to world coordinates.
+func (c *Camera) ScreenToWorld(sx, sy float32) (float32, float32) {
+	sin, cos := c.sincos()
+	dx, dy := (sx-c.width/2)/c.Zoom, (c.height-sy-c.height/2)/c.Zoom
+	return c.X + cos*dx - sin*dy, c.Y + sin*dx + cos*dy
+}
+
+// WorldToScreen converts world coordinates to screen coordinates.
+func (c *Camera) WorldToScreen(wx, wy float32) (float32, float32) {
+	sin, cos := c.sincos()
+	dx, dy := wx-c.X, wy-c.Y
+	rx, ry := (cos*dx+sin*dy)*c.Zoom, (-sin*dx+cos*dy)*c.Zoom
+	return rx + c.width/2, c.height - (ry + c.height/2)
+}
@@ -0,0 +1,295 @@
+package chipmunklib
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// The resource containing the runtime configuration
+	ConfigFilename = "raw/config.json"
+
+	// The level loaded at startup if not configured
+	DefaultLevel = "raw/world.svg"
+
+	// The number of iterations of the chipmunk solver if not
+	// configured
+	DefaultIterations = 10
+
+	// The file the profiler samples are written to if not
+	// configured
+	DefaultProfileOutput = "profile.csv"
+)
+
+// PhysicsConfig configures the simulation.
+type PhysicsConfig struct {
+	// The gravity vector in pixels/s²
+	Gravity [2]float32 `json:"gravity"`
+
+	// The number of iterations of the impulse solver
+	Iterations int `json:"iterations"`
+
+	// The fraction of velocity the bodies retain each second,
+	// 1 means no damping
+	Damping float32 `json:"damping"`
+
+	// The fixed duration of a step in seconds. If zero the
+	// simulation advances by the duration of a frame.
+	Timestep float32 `json:"timestep"`
+}
+
+// BoxConfig configures the boxes.
+type BoxConfig struct {
+	Mass       float32 `json:"mass"`
+	Elasticity float32 `json:"elasticity"`
+
+	// The distance in pixels within which a tap removes a box
+	PickRadius float32 `json:"pickRadius"`
+}
+
+// CameraConfig configures the camera.
+type CameraConfig struct {
+	// Whether the camera follows the last box dropped or thrown,
+	// until the player pans
+	Follow bool `json:"follow"`
+
+	// How fast the camera reaches the box followed. Higher is
+	// faster.
+	FollowSpeed float32 `json:"followSpeed"`
+}
+
+// AudioConfig holds the volume of the sound effects, from 0 (mute)
+// to 1.
+type AudioConfig struct {
+	Explosion float32 `json:"explosion"`
+	Impact    float32 `json:"impact"`
+	Break     float32 `json:"break"`
+}
+
+// WindowConfig holds the size of the window. It's used only on
+// desktop.
+type WindowConfig struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// EditorConfig configures the level editor.
+type EditorConfig struct {
+	// The size in pixels of the grid positions and sizes snap to
+	GridSize float32 `json:"gridSize"`
+
+	// The file the edited level is saved to. Relative paths are
+	// relative to the data directory of the application.
+	Path string `json:"path"`
+}
+
+// AdsConfig configures the ads.
+type AdsConfig struct {
+	// The entitlement to no ads
+	NoAds bool `json:"noAds"`
+
+	// Whether the banner is shown at the bottom of the screen
+	Banner bool `json:"banner"`
+
+	// The minimum number of seconds between two interstitials
+	MinInterval float32 `json:"minInterval"`
+
+	// The maximum number of interstitials per session, 0 means no
+	// limit
+	MaxPerSession int `json:"maxPerSession"`
+}
+
+// AnalyticsConfig configures the analytics.
+type AnalyticsConfig struct {
+	// The URL the events are posted to. Empty means they are
+	// appended to analytics.jsonl in the data directory.
+	URL string `json:"url"`
+
+	// The number of events sent together
+	BatchSize int `json:"batchSize"`
+
+	// How often in seconds the events are sent, even if shorter
+	// than a batch
+	FlushInterval float32 `json:"flushInterval"`
+
+	// The probability of keeping each event, by name, like
+	// {"tap": 0.1}. Events missing from the map are all kept.
+	Sampling map[string]float64 `json:"sampling"`
+}
+
+// ProfilerConfig configures the performance overlay.
+type ProfilerConfig struct {
+	// Whether the overlay is drawn
+	Enabled bool `json:"enabled"`
+
+	// The CSV file the samples are written to when rendering
+	// stops, relative to the data directory of the application.
+	// Empty means they aren't written.
+	Output string `json:"output"`
+}
+
+// Config is the runtime configuration of the application.
+type Config struct {
+	Physics   PhysicsConfig   `json:"physics"`
+	Box       BoxConfig       `json:"box"`
+	Audio     AudioConfig     `json:"audio"`
+	Camera    CameraConfig    `json:"camera"`
+	Window    WindowConfig    `json:"window"`
+	Editor    EditorConfig    `json:"editor"`
+	Ads       AdsConfig       `json:"ads"`
+	Analytics AnalyticsConfig `json:"analytics"`
+	Profiler  ProfilerConfig  `json:"profiler"`
+
+	// The level loaded at startup
+	Level string `json:"level"`
+
+	// The number of frames rendered per second
+	FramesPerSecond int `json:"fps"`
+
+	// The locale of the text shown, like "it" or "pt-BR". Empty
+	// means the locale of the device.
+	Locale string `json:"locale"`
+
+	// The memory in bytes the undo history can use
+	HistorySize int `json:"historySize"`
+
+	// The keys and the mouse buttons bound to each action on
+	// desktop. Actions missing from the configuration file keep
+	// their default bindings.
+	Bindings map[string][]string `json:"bindings"`
+
+	// The localhost address the debug server listens on, like
+	// "localhost:6060". Empty disables the server.
+	DebugServer string `json:"debugServer"`
+}
+
+// ConfigError lists the invalid values of a configuration.
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+// DefaultConfig returns the values of the settings missing from the
+// configuration file. The file itself is required: LoadConfig fails
+// if it can't be read.
+func DefaultConfig() *Config {
+	return &Config{
+		Physics: PhysicsConfig{
+			Gravity:    [2]float32{0, Gravity},
+			Iterations: DefaultIterations,
+			Damping:    1,
+		},
+		Box: BoxConfig{
+			Mass:       BoxMass,
+			Elasticity: BoxElasticity,
+			PickRadius: float32(math.Sqrt(BoxSize)),
+		},
+		Audio: AudioConfig{
+			Explosion: 1,
+			Impact:    1,
+			Break:     1,
+		},
+		Camera: CameraConfig{
+			FollowSpeed: DefaultFollowSpeed,
+		},
+		Window: WindowConfig{
+			Width:  480,
+			Height: 320,
+		},
+		Editor: EditorConfig{
+			GridSize: DefaultGridSize,
+			Path:     DefaultLevelPath,
+		},
+		Ads: AdsConfig{
+			MinInterval:   180,
+			MaxPerSession: 5,
+		},
+		Analytics: AnalyticsConfig{
+			BatchSize:     50,
+			FlushInterval: 30,
+		},
+		Profiler: ProfilerConfig{
+			Output: DefaultProfileOutput,
+		},
+		Level:           DefaultLevel,
+		FramesPerSecond: DefaultFps,
+		HistorySize:     DefaultHistorySize,
+		Bindings:        DefaultBindings(),
+	}
+}
+
+// ParseConfig decodes a JSON configuration. Values missing from data
+// keep their default.
+func ParseConfig(data []byte) (*Config, error) {
+	config := DefaultConfig()
+	defaults := config.Bindings
+	config.Bindings = nil
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %s", err.Error())
+	}
+	config.Bindings = mergeBindings(defaults, config.Bindings)
+	return config, config.Validate()
+}
+
+// LoadConfig reads and validates the configuration in the given
+// resource.
+func LoadConfig(filename string) (*Config, error) {
+	buf, err := readResource(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(buf)
+}
+
+// Validate checks that all the values are within their range.
+func (c *Config) Validate() error {
+	var errs ConfigError
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Physics.Iterations > 0, "physics.iterations must be positive, got %d", c.Physics.Iterations)
+	check(c.Physics.Damping > 0 && c.Physics.Damping <= 1, "physics.damping must be in (0, 1], got %g", c.Physics.Damping)
+	check(c.Physics.Timestep >= 0 && c.Physics.Timestep <= 1, "physics.timestep must be in [0, 1] seconds, got %g", c.Physics.Timestep)
+	check(c.Box.Mass > 0, "box.mass must be positive, got %g", c.Box.Mass)
+	check(c.Box.Elasticity >= 0 && c.Box.Elasticity <= 1, "box.elasticity must be in [0, 1], got %g", c.Box.Elasticity)
+	check(c.Box.PickRadius >= 0, "box.pickRadius can't be negative, got %g", c.Box.PickRadius)
+	check(c.Audio.Explosion >= 0 && c.Audio.Explosion <= 1, "audio.explosion must be in [0, 1], got %g", c.Audio.Explosion)
+	check(c.Audio.Impact >= 0 && c.Audio.Impact <= 1, "audio.impact must be in [0, 1], got %g", c.Audio.Impact)
+	check(c.Audio.Break >= 0 && c.Audio.Break <= 1, "audio.break must be in [0, 1], got %g", c.Audio.Break)
+	check(c.Camera.FollowSpeed > 0, "camera.followSpeed must be positive, got %g", c.Camera.FollowSpeed)
+	check(c.Window.Width > 0 && c.Window.Height > 0, "window size must be positive, got %dx%d", c.Window.Width, c.Window.Height)
+	check(c.Editor.GridSize > 0, "editor.gridSize must be positive, got %g", c.Editor.GridSize)
+	check(c.Editor.Path != "", "editor.path can't be empty")
+	check(c.Ads.MinInterval >= 0, "ads.minInterval can't be negative, got %g", c.Ads.MinInterval)
+	check(c.Ads.MaxPerSession >= 0, "ads.maxPerSession can't be negative, got %d", c.Ads.MaxPerSession)
+	check(c.Analytics.BatchSize > 0, "analytics.batchSize must be positive, got %d", c.Analytics.BatchSize)
+	check(c.Analytics.FlushInterval > 0, "analytics.flushInterval must be positive, got %g", c.Analytics.FlushInterval)
+	for name, rate := range c.Analytics.Sampling {
+		check(rate >= 0 && rate <= 1, "analytics.sampling.%s must be in [0, 1], got %g", name, rate)
+	}
+	check(c.Level != "", "level can't be empty")
+	check(c.FramesPerSecond > 0, "fps must be positive, got %d", c.FramesPerSecond)
+	check(c.HistorySize > 0, "historySize must be positive, got %d", c.HistorySize)
+	for name := range c.Bindings {
+		_, err := ParseAction(name)
+		check(err == nil, "bindings: unknown action %q", name)
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// volumeLevel converts a volume from 0 to 1 to the millibels
+// expected by the audio players, below their maximum level.
+func volumeLevel(volume float32, max int) int {
+	if volume <= 0 {
+		return math.MinInt16
+	}
+	return max + int(2000*math.Log10(float64(volume)))
+}
@@ -0,0 +1,45 @@
+package chipmunklib
+
+import "github.com/remogatto/mandala"
+
+// OfferCrashReport tells the player the game crashed in the previous
+// run and shows a button to export the report and one to discard
+// it. export saves the report and returns the file it was saved to.
+// The buttons are hidden while editing.
+func (s *GameState) OfferCrashReport(export func() (string, error), discard func() error) {
+	messages := s.World.messages
+	s.crashButtons = []*ButtonWidget{
+		s.HUD.NewButtonWidget(TopRight, DefaultMargin, DefaultMargin, messages.T("exportCrash"), func() {
+			filename, err := export()
+			if err != nil {
+				mandala.Logf("Can't export the crash report: %s\n", err.Error())
+				s.message.Show(messages.T("exportCrashFailed"), 2)
+				return
+			}
+			s.dismissCrashReport()
+			s.message.Show(messages.T("savedTo", filename), 2)
+		}),
+		s.HUD.NewButtonWidget(TopRight, DefaultMargin, DefaultMargin+editorButtonSpacing, messages.T("discardCrash"), func() {
+			if err := discard(); err != nil {
+				mandala.Logf("Can't discard the crash report: %s\n", err.Error())
+			}
+			s.dismissCrashReport()
+		}),
+	}
+	s.showCrashReport(!s.editing)
+	s.message.Show(messages.T("crashed"), 5)
+}
+
+// dismissCrashReport hides the buttons of the crash report for good.
+func (s *GameState) dismissCrashReport() {
+	s.showCrashReport(false)
+	s.crashButtons = nil
+}
+
+// showCrashReport shows or hides the buttons of the crash report, if
+// not dismissed.
+func (s *GameState) showCrashReport(visible bool) {
+	for _, b := range s.crashButtons {
+		b.Visible = visible
+	}
+}
@@ -0,0 +1,279 @@
+package chipmunklib
+
+import (
+	"image/color"
+	"math"
+	"reflect"
+
+	gl "github.com/remogatto/opengles2"
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// DebugLayer identifies a layer of the physics debug overlay.
+type DebugLayer uint
+
+const (
+	// The true outlines of the physics shapes
+	DebugOutlines DebugLayer = 1 << iota
+
+	// The bounding boxes of the shapes
+	DebugAABBs
+
+	// Contact points and normals
+	DebugContacts
+
+	// Linear velocity vectors
+	DebugVelocities
+
+	// The anchor points of the joints and the bodies they
+	// connect
+	DebugJoints
+
+	// Sleeping bodies drawn in a different tint
+	DebugSleeping
+
+	DebugAll = DebugOutlines | DebugAABBs | DebugContacts | DebugVelocities | DebugJoints | DebugSleeping
+)
+
+const (
+	// The length of the contact normals in pixels
+	debugNormalLength = 10
+
+	// The scale factor of the velocity vectors
+	debugVelocityScale = 0.1
+
+	// The number of segments used to draw circles
+	debugCircleSegments = 16
+
+	// The half size of the marks of the joint anchors in pixels
+	debugAnchorSize = 3
+)
+
+// The names of the anchor fields of the joints, in body coordinates,
+// as called by the different joints
+var jointAnchorFields = [][2]string{
+	{"Anchor1", "Anchor2"},
+	{"AnchorA", "AnchorB"},
+	{"Anchr1", "Anchr2"},
+}
+
+// The layers in the order of their actions, from DebugOutlinesAction
+var debugLayers = [...]DebugLayer{
+	DebugOutlines,
+	DebugAABBs,
+	DebugContacts,
+	DebugVelocities,
+	DebugJoints,
+	DebugSleeping,
+}
+
+var (
+	debugOutlineColor  = rgba(color.RGBA{0, 255, 0, 255})
+	debugSleepingColor = rgba(color.RGBA{80, 80, 255, 255})
+	debugStaticColor   = rgba(color.RGBA{255, 255, 255, 255})
+	debugAABBColor     = rgba(color.RGBA{255, 255, 0, 128})
+	debugContactColor  = rgba(color.RGBA{255, 0, 0, 255})
+	debugVelocityColor = rgba(color.RGBA{0, 255, 255, 255})
+	debugJointColor    = rgba(color.RGBA{255, 0, 255, 255})
+)
+
+// DebugDraw draws the physics state of the world on top of the
+// scene. Each layer can be switched on and off at runtime.
+type DebugDraw struct {
+	Layers DebugLayer
+
+	world *World
+	lines *batch
+}
+
+func newDebugDraw(world *World, layers DebugLayer) *DebugDraw {
+	d := &DebugDraw{
+		Layers: layers,
+		world:  world,
+		lines:  newBatch(world.renderer.flat.material),
+	}
+	d.lines.mode = gl.LINES
+	return d
+}
+
+// Enabled returns true if the given layer is drawn.
+func (d *DebugDraw) Enabled(layer DebugLayer) bool {
+	return d.Layers&layer != 0
+}
+
+// Toggle switches the given layer on or off.
+func (d *DebugDraw) Toggle(layer DebugLayer) {
+	d.Layers ^= layer
+}
+
+// debugLayer returns the layer toggled by the given action, zero if
+// the action doesn't toggle a layer.
+func debugLayer(action Action) DebugLayer {
+	i := int(action - DebugOutlinesAction)
+	if i < 0 || i >= len(debugLayers) {
+		return 0
+	}
+	return debugLayers[i]
+}
+
+func (d *DebugDraw) drawShape(shape *chipmunk.Shape, c [4]byte) {
+	b := d.lines
+	switch shape.ShapeClass.ShapeType() {
+	case chipmunk.ShapeType_Box:
+		d.drawPolygon(shape.GetAsBox().Polygon.TVerts, c)
+	case chipmunk.ShapeType_Polygon:
+		d.drawPolygon(shape.GetAsPolygon().TVerts, c)
+	case chipmunk.ShapeType_Segment:
+		s := shape.GetAsSegment()
+		b.addLine(float32(s.Ta.X), float32(s.Ta.Y), float32(s.Tb.X), float32(s.Tb.Y), c)
+	case chipmunk.ShapeType_Circle:
+		circle := shape.GetAsCircle()
+		cx, cy, r := float32(circle.Tc.X), float32(circle.Tc.Y), float32(circle.Radius)
+		for i := 0; i < debugCircleSegments; i++ {
+			a0 := 2 * math.Pi * float64(i) / debugCircleSegments
+			a1 := 2 * math.Pi * float64(i+1) / debugCircleSegments
+			b.addLine(
+				cx+r*float32(math.Cos(a0)), cy+r*float32(math.Sin(a0)),
+				cx+r*float32(math.Cos(a1)), cy+r*float32(math.Sin(a1)),
+				c,
+			)
+		}
+		// Show the rotation of the circle
+		angle := float64(shape.Body.Angle())
+		b.addLine(cx, cy, cx+r*float32(math.Cos(angle)), cy+r*float32(math.Sin(angle)), c)
+	}
+}
+
+func (d *DebugDraw) drawPolygon(verts chipmunk.Vertices, c [4]byte) {
+	for i := range verts {
+		j := (i + 1) % len(verts)
+		d.lines.addLine(float32(verts[i].X), float32(verts[i].Y), float32(verts[j].X), float32(verts[j].Y), c)
+	}
+}
+
+func (d *DebugDraw) drawAABB(bb chipmunk.AABB) {
+	l, u := bb.Lower, bb.Upper
+	d.drawPolygon(chipmunk.Vertices{
+		l,
+		vect.Vect{u.X, l.Y},
+		u,
+		vect.Vect{l.X, u.Y},
+	}, debugAABBColor)
+}
+
+func (d *DebugDraw) drawBody(body *chipmunk.Body) {
+	c := debugOutlineColor
+	switch {
+	case body.IsStatic():
+		c = debugStaticColor
+	case d.Enabled(DebugSleeping) && body.IsSleeping():
+		c = debugSleepingColor
+	}
+	for _, shape := range body.Shapes {
+		if d.Enabled(DebugOutlines) {
+			d.drawShape(shape, c)
+		}
+		if d.Enabled(DebugAABBs) {
+			d.drawAABB(shape.BB)
+		}
+	}
+	if d.Enabled(DebugVelocities) && !body.IsStatic() {
+		pos, vel := body.Position(), body.Velocity()
+		d.lines.addLine(
+			float32(pos.X), float32(pos.Y),
+			float32(pos.X+vel.X*debugVelocityScale), float32(pos.Y+vel.Y*debugVelocityScale),
+			debugVelocityColor,
+		)
+	}
+}
+
+func (d *DebugDraw) drawContacts() {
+	for _, arbiter := range d.world.space.Arbiters {
+		for _, contact := range arbiter.Contacts {
+			p, n := contact.Position(), contact.Normal()
+			x, y := float32(p.X), float32(p.Y)
+			d.lines.addLine(x-2, y-2, x+2, y+2, debugContactColor)
+			d.lines.addLine(x-2, y+2, x+2, y-2, debugContactColor)
+			d.lines.addLine(x, y, x+float32(n.X)*debugNormalLength, y+float32(n.Y)*debugNormalLength, debugContactColor)
+		}
+	}
+}
+
+// drawJoints draws a cross on the anchor points of each joint, a
+// line from the center of each body to its anchor and a line between
+// the anchors, which is a point for pivot joints.
+func (d *DebugDraw) drawJoints() {
+	for _, joint := range d.world.space.Constraints {
+		c := joint.Constraint()
+		local1, local2 := jointAnchors(joint)
+		ax, ay := bodyToWorld(c.BodyA, local1)
+		bx, by := bodyToWorld(c.BodyB, local2)
+		pa, pb := c.BodyA.Position(), c.BodyB.Position()
+		d.lines.addLine(float32(pa.X), float32(pa.Y), ax, ay, debugJointColor)
+		d.lines.addLine(float32(pb.X), float32(pb.Y), bx, by, debugJointColor)
+		d.lines.addLine(ax, ay, bx, by, debugJointColor)
+		d.drawCross(ax, ay, debugJointColor)
+		d.drawCross(bx, by, debugJointColor)
+	}
+}
+
+func (d *DebugDraw) drawCross(x, y float32, c [4]byte) {
+	d.lines.addLine(x-debugAnchorSize, y-debugAnchorSize, x+debugAnchorSize, y+debugAnchorSize, c)
+	d.lines.addLine(x-debugAnchorSize, y+debugAnchorSize, x+debugAnchorSize, y-debugAnchorSize, c)
+}
+
+// jointAnchors returns the anchors of a joint in the coordinates of
+// its bodies. The joints without anchors are anchored at the centers.
+func jointAnchors(joint chipmunk.Constraint) (vect.Vect, vect.Vect) {
+	v := reflect.Indirect(reflect.ValueOf(joint))
+	if v.Kind() != reflect.Struct {
+		return vect.Vect{}, vect.Vect{}
+	}
+	for _, names := range jointAnchorFields {
+		a, b := v.FieldByName(names[0]), v.FieldByName(names[1])
+		if !a.IsValid() || !b.IsValid() {
+			continue
+		}
+		anchor1, ok1 := a.Interface().(vect.Vect)
+		anchor2, ok2 := b.Interface().(vect.Vect)
+		if ok1 && ok2 {
+			return anchor1, anchor2
+		}
+	}
+	return vect.Vect{}, vect.Vect{}
+}
+
+// bodyToWorld converts a point in the coordinates of body to world
+// coordinates.
+func bodyToWorld(body *chipmunk.Body, p vect.Vect) (float32, float32) {
+	pos := body.Position()
+	cos, sin := body.Rot()
+	x, y := float32(p.X), float32(p.Y)
+	return float32(pos.X) + x*cos - y*sin, float32(pos.Y) + x*sin + y*cos
+}
+
+// draw draws the enabled layers with a single call.
+func (d *DebugDraw) draw() {
+	d.lines.begin()
+	for _, segment := range d.world.segments {
+		d.drawBody(segment.physicsBody)
+	}
+	for _, t := range d.world.terrains {
+		d.drawBody(t.physicsBody)
+	}
+	for _, box := range d.world.boxes {
+		d.drawBody(box.physicsBody)
+	}
+	if d.Enabled(DebugContacts) {
+		d.drawContacts()
+	}
+	if d.Enabled(DebugJoints) {
+		d.drawJoints()
+	}
+	d.lines.flush(&d.world.projMatrix, &d.world.viewMatrix)
+}
+
+func (d *DebugDraw) release() {
+	d.lines.release()
+}
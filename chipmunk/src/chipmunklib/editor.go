@@ -0,0 +1,645 @@
+package chipmunklib
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/gesture"
+	"github.com/remogatto/mandala-examples/storage"
+	gl "github.com/remogatto/opengles2"
+	"github.com/vova616/chipmunk/vect"
+)
+
+const (
+	// The size in pixels of the grid the editor snaps to if not
+	// configured
+	DefaultGridSize = 10
+
+	// The file the editor saves the level to if not configured
+	DefaultLevelPath = "level.svg"
+
+	// The size of the boxes placed in the editor
+	editorBoxSize = 40
+
+	// The rotation step when snapping
+	editorAngleStep = math.Pi / 12
+
+	// How close in pixels a finger must be to a segment to pick
+	// it or one of its endpoints
+	editorPickRadius = 15
+
+	// The vertical distance in pixels between the editor buttons
+	editorButtonSpacing = 20
+)
+
+var (
+	editorGridColor      = rgba(color.RGBA{255, 255, 255, 32})
+	editorSelectionColor = rgba(color.RGBA{255, 200, 0, 255})
+	editorPreviewColor   = rgba(color.RGBA{0, 200, 255, 255})
+)
+
+// EditorTool is what touching the level does in the editor.
+type EditorTool int
+
+const (
+	// Select, move, rotate and resize bodies and segments
+	SelectTool EditorTool = iota
+
+	// Place boxes
+	BoxTool
+
+	// Draw segments
+	SegmentTool
+)
+
+// The keys of the names of the tools in the message catalog
+var toolNames = [...]string{
+	SelectTool:  "tool.select",
+	BoxTool:     "tool.box",
+	SegmentTool: "tool.segment",
+}
+
+// Editor edits the level while the simulation is paused. Boxes are
+// placed with a tap and segments are drawn dragging a finger.
+// Dragging moves the selection, pinching resizes the selected box
+// and twisting two fingers rotates it. Dragging an endpoint of a
+// segment moves it, rotating and resizing the segment.
+type Editor struct {
+	// Snap aligns positions and sizes to a grid of GridSize
+	// pixels and rotations to steps of 15 degrees.
+	Snap     bool
+	GridSize float32
+	Tool     EditorTool
+
+	// The file the level is saved to
+	Path string
+
+	state *GameState
+	world *World
+
+	// The selection, at most one of them is set
+	box     *Box
+	segment *Ground
+
+	// The drag in progress: the offset between the finger and
+	// the box, or the endpoints of the segment being drawn or
+	// edited in world coordinates
+	panning, dragging bool
+	handle            int
+	offsetX, offsetY  float32
+	x1, y1, x2, y2    float32
+	scale, angle      float32
+
+	// The state of the boxes when playing started
+	playing bool
+	stopped *Snapshot
+
+	lines   *batch
+	tools   [len(toolNames)]*ButtonWidget
+	buttons []*ButtonWidget
+	snap    *ButtonWidget
+	play    *ButtonWidget
+	info    *Label
+}
+
+// newEditor adds the editor buttons to the HUD, hidden until the
+// editor is shown.
+func newEditor(state *GameState, config *Config) *Editor {
+	e := &Editor{
+		Snap:     true,
+		GridSize: config.Editor.GridSize,
+		Path:     config.Editor.Path,
+		state:    state,
+		world:    state.World,
+		lines:    newBatch(state.World.renderer.flat.material),
+		scale:    1,
+	}
+	e.lines.mode = gl.LINES
+
+	hud := state.HUD
+	messages := state.World.messages
+	y := float32(3 * DefaultMargin)
+	button := func(anchor Anchor, text string, pressed func()) *ButtonWidget {
+		b := hud.NewButtonWidget(anchor, DefaultMargin, y, text, pressed)
+		e.buttons = append(e.buttons, b)
+		y += editorButtonSpacing
+		return b
+	}
+	for i := range e.tools {
+		tool := EditorTool(i)
+		e.tools[i] = button(TopLeft, "", func() { e.SetTool(tool) })
+	}
+	button(TopLeft, messages.T("delete"), e.Delete)
+	e.snap = button(TopLeft, "", e.ToggleSnap)
+	e.play = button(TopLeft, "", e.TogglePlay)
+	button(TopLeft, messages.T("save"), func() { e.Save() })
+
+	y = 3 * DefaultMargin
+	button(TopRight, messages.T("massDown"), func() { e.scaleMass(0.5) })
+	button(TopRight, messages.T("massUp"), func() { e.scaleMass(2) })
+	button(TopRight, messages.T("bounceDown"), func() { e.addElasticity(-0.1) })
+	button(TopRight, messages.T("bounceUp"), func() { e.addElasticity(0.1) })
+	button(TopRight, messages.T("breakable"), e.toggleBreakable)
+
+	e.info = hud.NewLabel(Bottom, 0, 3*DefaultMargin)
+	e.show(false)
+	return e
+}
+
+// show shows or hides the editor buttons.
+func (e *Editor) show(visible bool) {
+	for _, b := range e.buttons {
+		b.Visible = visible
+	}
+	e.info.Visible = visible
+	e.update()
+}
+
+// update refreshes the labels of the buttons and the properties of
+// the selection.
+func (e *Editor) update() {
+	messages := e.world.messages
+	for i, b := range e.tools {
+		if EditorTool(i) == e.Tool {
+			b.SetText(messages.T("selectedTool", messages.T(toolNames[i])))
+		} else {
+			b.SetText(messages.T(toolNames[i]))
+		}
+	}
+	if e.Snap {
+		e.snap.SetText(messages.T("snapOn"))
+	} else {
+		e.snap.SetText(messages.T("snapOff"))
+	}
+	if e.playing {
+		e.play.SetText(messages.T("stop"))
+	} else {
+		e.play.SetText(messages.T("play"))
+	}
+	switch {
+	case e.box != nil:
+		e.info.SetText(messages.T(
+			"boxInfo",
+			e.box.width, e.box.height,
+			float32(e.box.physicsBody.Mass()),
+			e.box.elasticity,
+			e.box.breakImpulse,
+		))
+	case e.segment != nil:
+		s := e.segment
+		e.info.SetText(messages.T("segmentInfo", s.x1, s.y1, s.x2, s.y2))
+	default:
+		e.info.SetText("")
+	}
+}
+
+// SetTool changes what touching the level does.
+func (e *Editor) SetTool(tool EditorTool) {
+	e.Tool = tool
+	e.selectBox(nil)
+	e.update()
+}
+
+// ToggleSnap switches grid snapping on or off.
+func (e *Editor) ToggleSnap() {
+	e.Snap = !e.Snap
+	e.update()
+}
+
+// TogglePlay runs the simulation from the edited level, or stops it
+// and brings the boxes back to where they were when it started.
+func (e *Editor) TogglePlay() {
+	e.cancelDrag()
+	if e.playing {
+		e.world.Restore(e.stopped)
+		e.stopped = nil
+		e.playing = false
+		e.state.SetPaused(true)
+	} else {
+		e.selectBox(nil)
+		e.stopped = e.world.Snapshot()
+		e.playing = true
+		e.state.SetPaused(false)
+	}
+	e.update()
+}
+
+// Playing returns true while the simulation runs in the editor.
+func (e *Editor) Playing() bool {
+	return e.playing
+}
+
+// Delete removes the selected box or segment.
+func (e *Editor) Delete() {
+	if e.playing {
+		return
+	}
+	e.cancelDrag()
+	if e.box != nil {
+		if i := e.world.indexOf(e.box); i >= 0 {
+			e.world.removeBox(e.box, i)
+		}
+	}
+	if e.segment != nil {
+		e.world.removeSegment(e.segment)
+	}
+	e.selectBox(nil)
+	e.update()
+}
+
+// Rotate rotates the selected box by a step of 15 degrees.
+func (e *Editor) Rotate() {
+	if e.box != nil && !e.playing {
+		body := e.box.physicsBody
+		body.SetAngle(vect.Float(snapf(float32(body.Angle())+editorAngleStep, editorAngleStep)))
+		e.update()
+	}
+}
+
+// Save writes the level to Path.
+func (e *Editor) Save() error {
+	e.cancelDrag()
+	var boxes *Snapshot
+	if e.playing {
+		// Save the level as edited, not as simulated
+		boxes = e.world.Snapshot()
+		e.world.Restore(e.stopped)
+	}
+	err := e.save()
+	if boxes != nil {
+		e.world.Restore(boxes)
+	}
+	if err != nil {
+		mandala.Logf("Can't save the level: %s\n", err.Error())
+		e.state.message.Show(e.world.messages.T("saveFailed"), 2)
+		return err
+	}
+	e.state.message.Show(e.world.messages.T("savedTo", e.Path), 2)
+	return nil
+}
+
+// save replaces the file atomically, so a failed save doesn't lose
+// the level saved before.
+func (e *Editor) save() error {
+	var buf bytes.Buffer
+	if err := e.world.SaveLevel(&buf); err != nil {
+		return err
+	}
+	return storage.WriteFile(e.Path, buf.Bytes(), 0644)
+}
+
+// leave stops playing and drops the selection.
+func (e *Editor) leave() {
+	if e.playing {
+		e.TogglePlay()
+	}
+	e.cancelDrag()
+	e.selectBox(nil)
+	e.show(false)
+}
+
+// selectBox selects a box, or nothing if box is nil.
+func (e *Editor) selectBox(box *Box) {
+	e.box, e.segment = box, nil
+}
+
+// selectSegment selects a segment.
+func (e *Editor) selectSegment(segment *Ground) {
+	e.box, e.segment = nil, segment
+}
+
+func (e *Editor) cancelDrag() {
+	e.panning, e.dragging = false, false
+	e.scale, e.angle = 1, 0
+}
+
+// snapf aligns a coordinate to the grid if snapping is enabled.
+func (e *Editor) snapf(v float32) float32 {
+	if !e.Snap {
+		return v
+	}
+	return snapf(v, e.GridSize)
+}
+
+func snapf(v, step float32) float32 {
+	return step * float32(math.Floor(float64(v/step)+0.5))
+}
+
+// HandleGesture edits the level following a gesture. Coordinates
+// are in window pixels.
+func (e *Editor) HandleGesture(g gesture.Gesture) {
+	if e.playing {
+		return
+	}
+	w := e.world
+	switch g.Kind {
+	case gesture.Tap:
+		x, y := w.screenToWorld(g.X, g.Y)
+		switch e.Tool {
+		case SelectTool:
+			e.pick(g.X, g.Y, x, y)
+		case BoxTool:
+			e.placeBox(e.snapf(x), e.snapf(y))
+		}
+
+	case gesture.Pan:
+		if !e.panning {
+			e.panning = true
+			e.beginDrag(w.screenToWorld(g.X-g.DX, g.Y-g.DY))
+		}
+		if e.dragging {
+			e.drag(w.screenToWorld(g.X, g.Y))
+		} else {
+			w.Pan(g.DX, g.DY)
+		}
+
+	case gesture.PanEnd:
+		e.panning = false
+		e.endDrag()
+
+	case gesture.Pinch:
+		if e.box == nil {
+			w.Zoom(g.Scale, g.X-g.DX, g.Y-g.DY)
+			w.Pan(g.DX, g.DY)
+			break
+		}
+		e.scale *= g.Scale
+		width, height := e.box.width*e.scale, e.box.height*e.scale
+		if e.Snap {
+			width, height = maxf(e.snapf(width), e.GridSize), maxf(e.snapf(height), e.GridSize)
+		}
+		if width != e.box.width || height != e.box.height {
+			e.resizeBox(width, height)
+			e.scale = 1
+		}
+
+	case gesture.Rotate:
+		if e.box == nil {
+			break
+		}
+		body := e.box.physicsBody
+		angle := float32(body.Angle())
+		if !e.Snap {
+			body.SetAngle(vect.Float(angle + g.Angle))
+			break
+		}
+		e.angle += g.Angle
+		if math.Abs(float64(e.angle)) >= editorAngleStep/2 {
+			body.SetAngle(vect.Float(snapf(angle+e.angle, editorAngleStep)))
+			e.angle = 0
+		}
+	}
+	e.update()
+}
+
+// pick selects the box or the segment at the given coordinates.
+func (e *Editor) pick(sx, sy, x, y float32) {
+	w := e.world
+	if i := w.boxAt(sx, sy); i >= 0 {
+		e.selectBox(w.boxes[i])
+		return
+	}
+	radius := editorPickRadius / (w.scale * w.camera.Zoom)
+	for _, s := range w.segments {
+		if distanceToSegment(x, y, s.x1, s.y1, s.x2, s.y2) < radius {
+			e.selectSegment(s)
+			return
+		}
+	}
+	e.selectBox(nil)
+}
+
+// placeBox adds a box at the given world coordinates and selects
+// it.
+func (e *Editor) placeBox(x, y float32) {
+	w := e.world
+	box := w.boxPool.get(w, editorBoxSize, editorBoxSize)
+	box.physicsBody.SetPosition(vect.Vect{vect.Float(x), vect.Float(y)})
+	box.setColor(colorful.HappyColor())
+	w.addBox(box)
+	e.selectBox(box)
+}
+
+// beginDrag starts moving the selection, moving an endpoint of the
+// selected segment or drawing a segment from the given world
+// coordinates. Starting from a body or a segment not selected
+// selects it.
+func (e *Editor) beginDrag(x, y float32) {
+	w := e.world
+	e.dragging = true
+	if e.Tool == SegmentTool {
+		e.selectBox(nil)
+		e.x1, e.y1 = e.snapf(x), e.snapf(y)
+		e.x2, e.y2 = e.x1, e.y1
+		return
+	}
+	radius := editorPickRadius / (w.scale * w.camera.Zoom)
+	if s := e.segment; s == nil || distanceToSegment(x, y, s.x1, s.y1, s.x2, s.y2) >= radius {
+		if i := w.boxAtWorld(x, y); i >= 0 {
+			e.selectBox(w.boxes[i])
+			bx, by := e.box.center()
+			e.offsetX, e.offsetY = bx-x, by-y
+			return
+		}
+		e.selectBox(nil)
+		for _, s := range w.segments {
+			if distanceToSegment(x, y, s.x1, s.y1, s.x2, s.y2) < radius {
+				e.selectSegment(s)
+				break
+			}
+		}
+	}
+	s := e.segment
+	if s == nil {
+		e.dragging = false
+		return
+	}
+	e.x1, e.y1, e.x2, e.y2 = s.x1, s.y1, s.x2, s.y2
+	switch {
+	case distance(x, y, s.x1, s.y1) < radius:
+		e.handle = 1
+	case distance(x, y, s.x2, s.y2) < radius:
+		e.handle = 2
+	default:
+		e.handle = 0
+	}
+	e.offsetX, e.offsetY = x, y
+}
+
+// drag follows the finger at the given world coordinates.
+func (e *Editor) drag(x, y float32) {
+	if !e.dragging {
+		return
+	}
+	switch {
+	case e.Tool == SegmentTool:
+		e.x2, e.y2 = e.snapf(x), e.snapf(y)
+	case e.segment != nil:
+		s := e.segment
+		dx, dy := x-e.offsetX, y-e.offsetY
+		switch e.handle {
+		case 0:
+			dx, dy = e.snapf(dx), e.snapf(dy)
+			e.x1, e.y1, e.x2, e.y2 = s.x1+dx, s.y1+dy, s.x2+dx, s.y2+dy
+		case 1:
+			e.x1, e.y1 = e.snapf(x), e.snapf(y)
+		case 2:
+			e.x2, e.y2 = e.snapf(x), e.snapf(y)
+		}
+	case e.box != nil:
+		body := e.box.physicsBody
+		body.SetPosition(vect.Vect{vect.Float(e.snapf(x + e.offsetX)), vect.Float(e.snapf(y + e.offsetY))})
+		body.SetVelocity(0, 0)
+		body.SetAngularVelocity(0)
+	}
+}
+
+// endDrag adds the segment drawn or moves the segment edited.
+func (e *Editor) endDrag() {
+	if !e.dragging {
+		return
+	}
+	e.dragging = false
+	if e.Tool != SegmentTool && e.segment == nil {
+		return
+	}
+	if distance(e.x1, e.y1, e.x2, e.y2) < 1 {
+		return
+	}
+	w := e.world
+	if e.segment != nil {
+		w.removeSegment(e.segment)
+	}
+	segment := newGround(e.x1, e.y1, e.x2, e.y2)
+	if w.ground == nil {
+		w.setGround(segment)
+	} else {
+		w.addSegment(segment)
+	}
+	e.selectSegment(segment)
+}
+
+// resizeBox replaces the selected box with a box of the given size
+// in the same state.
+func (e *Editor) resizeBox(width, height float32) {
+	w := e.world
+	old := e.box
+	i := w.indexOf(old)
+	if i < 0 {
+		return
+	}
+	body := old.physicsBody
+	mass := float32(body.Mass())
+	box := w.boxPool.get(w, width, height)
+	box.physicsBody.SetMass(vect.Float(mass))
+	box.physicsBody.SetMoment(box.physicsShape.Moment(mass))
+	box.physicsBody.SetPosition(body.Position())
+	box.physicsBody.SetAngle(body.Angle())
+	box.setElasticity(old.elasticity)
+	box.sprite, box.color = old.sprite, old.color
+	if old.breakImpulse > 0 {
+		box.SetBreakable(old.breakImpulse, old.fragments)
+	}
+	w.removeBox(old, i)
+	w.addBox(box)
+	e.selectBox(box)
+}
+
+func (e *Editor) scaleMass(factor float32) {
+	if e.box == nil || e.playing {
+		return
+	}
+	mass := float32(e.box.physicsBody.Mass()) * factor
+	e.box.physicsBody.SetMass(vect.Float(mass))
+	e.box.physicsBody.SetMoment(e.box.physicsShape.Moment(mass))
+	e.update()
+}
+
+func (e *Editor) addElasticity(delta float32) {
+	if e.box == nil || e.playing {
+		return
+	}
+	elasticity := float32(math.Floor(float64((e.box.elasticity+delta)*10)+0.5)) / 10
+	if elasticity < 0 {
+		elasticity = 0
+	}
+	if elasticity > 1 {
+		elasticity = 1
+	}
+	e.box.setElasticity(elasticity)
+	e.update()
+}
+
+func (e *Editor) toggleBreakable() {
+	if e.box == nil || e.playing {
+		return
+	}
+	if e.box.breakImpulse > 0 {
+		e.box.SetBreakable(0, 0)
+	} else {
+		e.box.SetBreakable(DefaultBreakImpulse, DefaultFragments)
+	}
+	e.update()
+}
+
+// draw draws the grid, the selection and the segment being drawn.
+func (e *Editor) draw() {
+	w := e.world
+	b := e.lines
+	b.begin()
+	if e.Snap && !e.playing {
+		// Draw the lines of the grid every 5 cells
+		step := 5 * e.GridSize
+		minX, minY, maxX, maxY := w.camera.Bounds()
+		for x := snapf(minX, step); x <= maxX; x += step {
+			b.addLine(x, minY, x, maxY, editorGridColor)
+		}
+		for y := snapf(minY, step); y <= maxY; y += step {
+			b.addLine(minX, y, maxX, y, editorGridColor)
+		}
+	}
+	if e.box != nil {
+		verts := e.box.physicsShape.GetAsBox().Polygon.TVerts
+		for i := range verts {
+			j := (i + 1) % len(verts)
+			b.addLine(float32(verts[i].X), float32(verts[i].Y), float32(verts[j].X), float32(verts[j].Y), editorSelectionColor)
+		}
+	}
+	if e.segment != nil {
+		s := e.segment
+		b.addLine(s.x1, s.y1, s.x2, s.y2, editorSelectionColor)
+	}
+	if e.dragging && (e.Tool == SegmentTool || e.segment != nil) {
+		b.addLine(e.x1, e.y1, e.x2, e.y2, editorPreviewColor)
+	}
+	b.flush(&w.projMatrix, &w.viewMatrix)
+}
+
+func (e *Editor) release() {
+	e.lines.release()
+}
+
+func distance(x1, y1, x2, y2 float32) float32 {
+	return float32(math.Hypot(float64(x2-x1), float64(y2-y1)))
+}
+
+// distanceToSegment returns the distance of the point (x, y) from
+// the segment between (x1, y1) and (x2, y2).
+func distanceToSegment(x, y, x1, y1, x2, y2 float32) float32 {
+	dx, dy := x2-x1, y2-y1
+	l := dx*dx + dy*dy
+	if l == 0 {
+		return distance(x, y, x1, y1)
+	}
+	t := ((x-x1)*dx + (y-y1)*dy) / l
+	if t < 0 {
+		t = 0
+	}
+	if t > 1 {
+		t = 1
+	}
+	return distance(x, y, x1+t*dx, y1+t*dy)
+}
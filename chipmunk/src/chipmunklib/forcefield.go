@@ -0,0 +1,289 @@
+package chipmunklib
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// FieldKind is the kind of a force field.
+type FieldKind int
+
+const (
+	// A constant acceleration within a rectangle
+	WindField FieldKind = iota
+
+	// An acceleration toward, or away from, the center of a
+	// circle, fading to zero at the border
+	RadialField
+
+	// A water volume within a rectangle whose top is the surface
+	WaterField
+)
+
+// The default properties of water fields
+const (
+	DefaultWaterDensity     = 1.5
+	DefaultWaterDrag        = 1.0
+	DefaultWaterAngularDrag = 1.0
+)
+
+const (
+	// The number of segments used to draw radial fields
+	fieldCircleSegments = 32
+
+	// The maximum number of vertices of a polygon clipped by the
+	// water surface
+	maxClippedVertices = 16
+)
+
+var fieldColors = map[FieldKind][4]byte{
+	WindField:   rgba(color.RGBA{255, 255, 255, 24}),
+	RadialField: rgba(color.RGBA{160, 80, 255, 48}),
+	WaterField:  rgba(color.RGBA{40, 110, 255, 96}),
+}
+
+// ForceField applies a force, at each step, to the boxes
+// overlapping its region.
+type ForceField struct {
+	Kind FieldKind
+
+	// The region of wind and water fields
+	MinX, MinY, MaxX, MaxY float32
+
+	// The center and the radius of radial fields
+	X, Y, Radius float32
+
+	// The acceleration of wind fields in pixels/s²
+	ForceX, ForceY float32
+
+	// The acceleration of radial fields at their center. Positive
+	// values attract the bodies, negative values repel them.
+	Strength float32
+
+	// The density of the water relative to the boxes. Boxes float
+	// if greater than 1.
+	Density float32
+
+	// The fraction of linear and angular velocity the submerged
+	// part of a box loses each second
+	Drag, AngularDrag float32
+
+	Color [4]byte
+}
+
+// NewWindField returns a field pushing the bodies in the rectangle
+// with the given acceleration.
+func NewWindField(minX, minY, maxX, maxY, forceX, forceY float32) *ForceField {
+	return &ForceField{
+		Kind:   WindField,
+		MinX:   minX,
+		MinY:   minY,
+		MaxX:   maxX,
+		MaxY:   maxY,
+		ForceX: forceX,
+		ForceY: forceY,
+		Color:  fieldColors[WindField],
+	}
+}
+
+// NewRadialField returns a field attracting, if strength is
+// positive, or repelling the bodies in the circle.
+func NewRadialField(x, y, radius, strength float32) *ForceField {
+	return &ForceField{
+		Kind:     RadialField,
+		X:        x,
+		Y:        y,
+		Radius:   radius,
+		Strength: strength,
+		Color:    fieldColors[RadialField],
+	}
+}
+
+// NewWaterField returns a water volume filling the rectangle.
+func NewWaterField(minX, minY, maxX, maxY, density, drag, angularDrag float32) *ForceField {
+	return &ForceField{
+		Kind:        WaterField,
+		MinX:        minX,
+		MinY:        minY,
+		MaxX:        maxX,
+		MaxY:        maxY,
+		Density:     density,
+		Drag:        drag,
+		AngularDrag: angularDrag,
+		Color:       fieldColors[WaterField],
+	}
+}
+
+// parseFieldKind returns the kind named in a level file.
+func parseFieldKind(name string) (FieldKind, error) {
+	switch name {
+	case "wind":
+		return WindField, nil
+	case "radial":
+		return RadialField, nil
+	case "water":
+		return WaterField, nil
+	}
+	return 0, fmt.Errorf("unknown force field %q", name)
+}
+
+// overlaps returns true if the bounding box overlaps the region of
+// the field.
+func (f *ForceField) overlaps(bb chipmunk.AABB) bool {
+	if f.Kind == RadialField {
+		dx := clampAxis(f.X, float32(bb.Lower.X), float32(bb.Upper.X)) - f.X
+		dy := clampAxis(f.Y, float32(bb.Lower.Y), float32(bb.Upper.Y)) - f.Y
+		return dx*dx+dy*dy < f.Radius*f.Radius
+	}
+	return float32(bb.Upper.X) > f.MinX && float32(bb.Lower.X) < f.MaxX &&
+		float32(bb.Upper.Y) > f.MinY && float32(bb.Lower.Y) < f.MaxY
+}
+
+// apply changes the velocity of the box for a step of dt seconds.
+func (f *ForceField) apply(box *Box, gravity vect.Vect, scratch *clipBuffer, dt float32) {
+	shape, body := box.physicsShape, box.physicsBody
+	if !f.overlaps(shape.BB) {
+		return
+	}
+	switch f.Kind {
+	case WindField:
+		fraction := f.coverage(shape.BB)
+		body.AddVelocity(f.ForceX*fraction*dt, f.ForceY*fraction*dt)
+
+	case RadialField:
+		pos := body.Position()
+		dx, dy := f.X-float32(pos.X), f.Y-float32(pos.Y)
+		d := float32(math.Hypot(float64(dx), float64(dy)))
+		if d == 0 || d >= f.Radius {
+			return
+		}
+		a := f.Strength * (1 - d/f.Radius) * dt / d
+		body.AddVelocity(dx*a, dy*a)
+
+	case WaterField:
+		fraction := scratch.submerged(shape, f.MaxY)
+		if fraction == 0 {
+			return
+		}
+		// Buoyancy opposes gravity, proportionally to the
+		// submerged part of the box
+		k := -f.Density * fraction * dt
+		body.AddVelocity(float32(gravity.X)*k, float32(gravity.Y)*k)
+
+		v := body.Velocity()
+		drag := clampAxis(1-f.Drag*fraction*dt, 0, 1)
+		body.SetVelocity(float32(v.X)*drag, float32(v.Y)*drag)
+		angularDrag := clampAxis(1-f.AngularDrag*fraction*dt, 0, 1)
+		body.SetAngularVelocity(float32(body.AngularVelocity()) * angularDrag)
+	}
+}
+
+// coverage returns the fraction of the bounding box within the
+// region of the field.
+func (f *ForceField) coverage(bb chipmunk.AABB) float32 {
+	w := float32(bb.Upper.X - bb.Lower.X)
+	h := float32(bb.Upper.Y - bb.Lower.Y)
+	if w <= 0 || h <= 0 {
+		return 1
+	}
+	ow := minf(float32(bb.Upper.X), f.MaxX) - maxf(float32(bb.Lower.X), f.MinX)
+	oh := minf(float32(bb.Upper.Y), f.MaxY) - maxf(float32(bb.Lower.Y), f.MinY)
+	return clampAxis(ow*oh/(w*h), 0, 1)
+}
+
+// draw adds the region of the field to the batch.
+func (f *ForceField) draw(b *batch) {
+	switch f.Kind {
+	case RadialField:
+		for i := 0; i < fieldCircleSegments; i++ {
+			a0 := 2 * math.Pi * float64(i) / fieldCircleSegments
+			a1 := 2 * math.Pi * float64(i+1) / fieldCircleSegments
+			b.addVertex(f.X, f.Y, f.Color)
+			b.addVertex(f.X+f.Radius*float32(math.Cos(a0)), f.Y+f.Radius*float32(math.Sin(a0)), f.Color)
+			b.addVertex(f.X+f.Radius*float32(math.Cos(a1)), f.Y+f.Radius*float32(math.Sin(a1)), f.Color)
+		}
+	default:
+		b.addVertex(f.MinX, f.MinY, f.Color)
+		b.addVertex(f.MaxX, f.MinY, f.Color)
+		b.addVertex(f.MaxX, f.MaxY, f.Color)
+		b.addVertex(f.MaxX, f.MaxY, f.Color)
+		b.addVertex(f.MinX, f.MaxY, f.Color)
+		b.addVertex(f.MinX, f.MinY, f.Color)
+	}
+}
+
+// clipBuffer holds the vertices of a polygon clipped by the water
+// surface, so that computing the submerged area doesn't allocate.
+type clipBuffer struct {
+	verts [maxClippedVertices]vect.Vect
+}
+
+// submerged returns the fraction of the area of the shape below the
+// given surface. Shapes other than boxes and polygons are measured
+// using their bounding box.
+func (c *clipBuffer) submerged(shape *chipmunk.Shape, surface float32) float32 {
+	var verts chipmunk.Vertices
+	switch shape.ShapeClass.ShapeType() {
+	case chipmunk.ShapeType_Box:
+		verts = shape.GetAsBox().Polygon.TVerts
+	case chipmunk.ShapeType_Polygon:
+		verts = shape.GetAsPolygon().TVerts
+	default:
+		bb := shape.BB
+		h := float32(bb.Upper.Y - bb.Lower.Y)
+		if h <= 0 {
+			return 0
+		}
+		return clampAxis((surface-float32(bb.Lower.Y))/h, 0, 1)
+	}
+
+	total := polygonArea(verts)
+	if total == 0 || len(verts) > maxClippedVertices/2 {
+		return 0
+	}
+
+	// Keep the part of the polygon below the surface
+	s := vect.Float(surface)
+	n := 0
+	for i := range verts {
+		a, b := verts[i], verts[(i+1)%len(verts)]
+		if a.Y <= s {
+			c.verts[n] = a
+			n++
+		}
+		if (a.Y <= s) != (b.Y <= s) {
+			t := (s - a.Y) / (b.Y - a.Y)
+			c.verts[n] = vect.Vect{a.X + (b.X-a.X)*t, s}
+			n++
+		}
+	}
+	return clampAxis(polygonArea(c.verts[:n])/total, 0, 1)
+}
+
+// polygonArea returns the area of a simple polygon.
+func polygonArea(verts []vect.Vect) float32 {
+	var area vect.Float
+	for i := range verts {
+		a, b := verts[i], verts[(i+1)%len(verts)]
+		area += a.X*b.Y - b.X*a.Y
+	}
+	return float32(math.Abs(float64(area))) / 2
+}
+
+func minf(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxf(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
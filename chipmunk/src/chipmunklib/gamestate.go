@@ -1,9 +1,12 @@
 package chipmunklib
 
 import (
+	"image"
+	"time"
+
 	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/analytics"
 	gl "github.com/remogatto/opengles2"
-	"github.com/vova616/chipmunk/vect"
 )
 
 const DefaultFps = 30
@@ -12,11 +15,44 @@ type GameState struct {
 	window      mandala.Window
 	World       *World
 	Fps, Frames int
+	HUD         *HUD
+
+	fps      *FPSWidget
+	message  *MessageWidget
+	pause    *Label
+	profiler *Profiler
+
+	history    *History
+	undo, redo *ButtonWidget
+	dragging   bool
+
+	editor  *Editor
+	edit    *ButtonWidget
+	editing bool
+
+	ads *adPlaceholder
+
+	// The buttons of the report of the previous crash, nil once
+	// exported or discarded
+	crashButtons []*ButtonWidget
+
+	// The events of the player are tracked since levelStart
+	tracker    *analytics.Tracker
+	levelStart time.Time
+
+	// While paused the simulation advances only when stepped
+	paused, stepping bool
+
+	// How long the last frame took to step and to draw
+	stepTime, drawTime time.Duration
+
+	// The draw calls issued by the last frame
+	drawCalls int
 }
 
 // NewGameState creates a new game state. It needs a window onto which
-// render the scene.
-func NewGameState(window mandala.Window) *GameState {
+// render the scene and the configuration of the game.
+func NewGameState(window mandala.Window, config *Config) *GameState {
 	s := new(GameState)
 	s.window = window
 
@@ -24,42 +60,74 @@ func NewGameState(window mandala.Window) *GameState {
 
 	w, h := window.GetSize()
 
-	s.World = NewWorld(w, h)
+	s.World = NewWorld(w, h, config)
 
-	s.Fps = DefaultFps
+	s.Fps = config.FramesPerSecond
+	s.HUD = NewHUD(s.World)
+	s.fps = s.HUD.NewFPSWidget(Top, 0, DefaultMargin)
+	s.message = s.HUD.NewMessageWidget(Bottom, 0, DefaultMargin)
+	s.pause = s.HUD.NewLabel(Center, 0, 0)
+	s.pause.SetText(s.World.messages.T("paused"))
+	s.pause.Visible = false
+
+	s.history = NewHistory(config.HistorySize)
+	messages := s.World.messages
+	s.undo = s.HUD.NewButtonWidget(BottomLeft, DefaultMargin, DefaultMargin, messages.T("undo"), s.Undo)
+	s.redo = s.HUD.NewButtonWidget(BottomLeft, 6*DefaultMargin, DefaultMargin, messages.T("redo"), s.Redo)
+
+	s.edit = s.HUD.NewButtonWidget(TopLeft, DefaultMargin, DefaultMargin, messages.T("edit"), func() { s.SetEditing(!s.editing) })
+	s.editor = newEditor(s, config)
+	s.ads = newAdPlaceholder(s.HUD)
 
 	// Uncomment the following lines to generate the world
 	// starting from a string (defined in world.go)
 
 	// s.World.CreateFromString(pyramid)
-	// s.World.setGround(newGround(s.World, 0, float32(10), float32(w), float32(10)))
+	// s.World.setGround(newGround(0, float32(10), float32(w), float32(10)))
 
-	s.World.CreateFromSvg("raw/world.svg")
+	s.World.CreateFromSvg(config.Level)
 
 	gl.Enable(gl.BLEND)
 	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
 
 	gl.ClearColor(0.0, 0.0, 0.0, 1.0)
-	gl.Clear(gl.COLOR_BUFFER_BIT)
+	s.World.clear()
 
 	return s
 }
 
-func (s *GameState) printFPS(x, y float32) {
-	text, err := s.World.font.Printf("Frames per second %d", s.Fps)
-	if err != nil {
-		panic(err)
+// Draw steps the simulation and renders a frame. Once the box pool
+// is warmed up, drawing a frame doesn't allocate unless a HUD label
+// changes.
+func (s *GameState) Draw() {
+	drawCalls = 0
+	s.World.clear()
+
+	// The duration of a frame and of a step of the simulation,
+	// which is zero while paused
+	frame := 1 / float32(s.Fps)
+	dt := frame
+	if timestep := s.World.config.Physics.Timestep; timestep > 0 {
+		dt = timestep
 	}
-	text.AttachToWorld(s.World)
-	text.MoveTo(x, y)
-	text.Draw()
-}
+	start := time.Now()
+	if s.paused && !s.stepping {
+		dt = 0
+	} else {
+		s.World.step(dt)
+		s.stepping = false
+	}
+	stepTime := time.Since(start)
 
-func (s *GameState) Draw() {
-	gl.Clear(gl.COLOR_BUFFER_BIT)
+	start = time.Now()
+	s.World.particles.update(dt)
+	s.World.updateCamera(frame)
 
-	s.World.space.Step(vect.Float(1 / float32(s.Fps)))
+	for _, t := range s.World.terrains {
+		t.draw()
+	}
 
+	s.World.renderer.begin()
 	for i := 0; i < len(s.World.boxes); i++ {
 		box := s.World.boxes[i]
 		if box.inViewport() {
@@ -69,12 +137,228 @@ func (s *GameState) Draw() {
 			i--
 		}
 	}
+	s.World.renderer.flush()
+	s.World.fieldBatch.flush(&s.World.projMatrix, &s.World.viewMatrix)
+	s.World.particles.draw()
+	s.World.drawSegments()
+
+	// The overlays go on top of the scene
+	if s.World.debug != nil {
+		s.World.debug.draw()
+	}
+	if s.editing {
+		s.editor.draw()
+	}
+
+	s.stepTime, s.drawTime = stepTime, time.Since(start)
+	if s.profiler != nil {
+		s.profiler.measure(ProfileStep, s.stepTime)
+		s.profiler.measure(ProfileDraw, s.drawTime)
+		s.profiler.update(frame)
+		s.profiler.draw()
+	}
+
+	s.fps.Set(s.Fps)
+	s.undo.Visible = !s.editing && s.history.CanUndo()
+	s.redo.Visible = !s.editing && s.history.CanRedo()
+	s.HUD.update(frame)
+	s.ads.draw()
+	s.HUD.draw()
+	s.drawCalls = drawCalls
+}
+
+// SetPaused pauses or resumes the simulation. The scene is still
+// drawn while paused.
+func (s *GameState) SetPaused(paused bool) {
+	s.paused = paused
+	s.pause.Visible = paused
+}
+
+// Paused returns true if the simulation is paused.
+func (s *GameState) Paused() bool {
+	return s.paused
+}
+
+// Step advances the paused simulation by one step at the next
+// frame.
+func (s *GameState) Step() {
+	if s.paused {
+		s.stepping = true
+	}
+}
+
+// SetEditing enters or leaves the level editor. The simulation is
+// paused while editing and the actions recorded are forgotten.
+func (s *GameState) SetEditing(editing bool) {
+	if editing == s.editing {
+		return
+	}
+	s.editing = editing
+	s.EndDrag()
+	if editing {
+		s.history.Clear()
+		s.SetPaused(true)
+		s.editor.show(true)
+		s.showCrashReport(false)
+		s.edit.SetText(s.World.messages.T("done"))
+	} else {
+		s.editor.leave()
+		s.SetPaused(false)
+		s.showCrashReport(true)
+		s.edit.SetText(s.World.messages.T("edit"))
+	}
+}
 
-	s.World.ground.draw()
+// Editing returns true while the level editor is shown.
+func (s *GameState) Editing() bool {
+	return s.editing
+}
 
-	s.printFPS(float32(s.World.width/2), float32(s.World.height)-25)
+// Editor returns the level editor.
+func (s *GameState) Editor() *Editor {
+	return s.editor
+}
+
+// Remove removes the box at the given window coordinates. It
+// returns false if there's no box there. The history is recorded only
+// if a box is removed, so that tapping the empty scene is cheap.
+func (s *GameState) Remove(x, y float32) bool {
+	id := s.World.boxAt(x, y)
+	if id < 0 {
+		return false
+	}
+	s.history.Record("remove", s.World.Snapshot())
+	s.World.removeBox(s.World.boxes[id], id)
+	return true
+}
+
+// Explode makes an explosion at the given window coordinates.
+func (s *GameState) Explode(x, y float32) {
+	s.history.Record("explode", s.World.Snapshot())
+	s.World.Explosion(x, y)
+	s.trackExplosion(s.World.screenToWorld(x, y))
+}
+
+// DropBox drops a box at the given window coordinates.
+func (s *GameState) DropBox(x, y float32) {
+	s.history.Record("drop", s.World.Snapshot())
+	s.World.DropBox(x, y)
+}
+
+// Reset loads the level again.
+func (s *GameState) Reset() {
+	s.EndDrag()
+	s.history.Record("reset", s.World.Snapshot())
+	s.World.Reset()
+	s.TrackLevelEnd("reset")
+	s.trackLevelStart()
+}
+
+// BeginDrag starts dragging the box at the given window
+// coordinates. It returns false if there's no box there.
+func (s *GameState) BeginDrag(x, y float32) bool {
+	snapshot := s.World.Snapshot()
+	if !s.World.Grab(x, y) {
+		return false
+	}
+	s.history.Record("drag", snapshot)
+	s.dragging = true
+	return true
+}
+
+// DragTo moves the box dragged to the given window coordinates.
+func (s *GameState) DragTo(x, y float32) {
+	if s.dragging {
+		s.World.DragTo(x, y)
+	}
+}
+
+// EndDrag drops the box dragged.
+func (s *GameState) EndDrag() {
+	s.dragging = false
+	s.World.Release()
+}
+
+// Dragging returns true while a box is dragged.
+func (s *GameState) Dragging() bool {
+	return s.dragging
+}
+
+// Undo undoes the last action of the player.
+func (s *GameState) Undo() {
+	s.EndDrag()
+	if name, ok := s.history.Undo(s.World); ok {
+		s.message.Show(s.World.messages.T("undoAction", s.World.messages.T("action."+name)), 1)
+	}
+}
+
+// Redo redoes the last action undone.
+func (s *GameState) Redo() {
+	s.EndDrag()
+	if name, ok := s.history.Redo(s.World); ok {
+		s.message.Show(s.World.messages.T("redoAction", s.World.messages.T("action."+name)), 1)
+	}
+}
+
+// History returns the actions of the player.
+func (s *GameState) History() *History {
+	return s.history
+}
+
+// EnableProfiler starts sampling the cost of each frame and drawing
+// the performance overlay. It returns the profiler.
+func (s *GameState) EnableProfiler() *Profiler {
+	if s.profiler == nil {
+		s.profiler = newProfiler(s.World, s.HUD)
+	}
+	return s.profiler
+}
+
+// Profiler returns the profiler, nil if it's not enabled.
+func (s *GameState) Profiler() *Profiler {
+	return s.profiler
+}
+
+// Resize adapts the game to the new size of the window.
+func (s *GameState) Resize(width, height int) {
+	s.World.Resize(width, height)
+	s.HUD.resize(width, height)
+}
+
+// Destroy releases the world, the editor and the profiler.
+func (s *GameState) Destroy() {
+	if s.profiler != nil {
+		s.profiler.release()
+	}
+	s.editor.release()
+	s.ads.release()
+	s.World.Destroy()
+}
+
+// Screenshot returns the frame drawn, it must be called before
+// swapping the buffers.
+func (s *GameState) Screenshot() *image.RGBA {
+	w, h := s.World.windowWidth, s.World.windowHeight
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	gl.ReadPixels(0, 0, gl.Sizei(w), gl.Sizei(h), gl.RGBA, gl.UNSIGNED_BYTE, gl.Void(&img.Pix[0]))
+
+	// OpenGL rows go upward
+	row := make([]byte, img.Stride)
+	for y := 0; y < h/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(h-1-y)*img.Stride : (h-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+	return img
 }
 
 func (s *GameState) SwapBuffers() {
+	start := time.Now()
 	s.window.SwapBuffers()
+	if s.profiler != nil {
+		s.profiler.measure(ProfileSwap, time.Since(start))
+		s.profiler.endFrame()
+	}
 }
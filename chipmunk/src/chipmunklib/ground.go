@@ -3,7 +3,6 @@ package chipmunklib
 import (
 	"image/color"
 
-	"github.com/remogatto/shapes"
 	"github.com/vova616/chipmunk"
 	"github.com/vova616/chipmunk/vect"
 )
@@ -12,14 +11,21 @@ const (
 	GroundRadius = 1.0
 )
 
+var groundColor = rgba(color.White)
+
+// Ground is a static segment of the level. Segments are drawn as
+// lines by the world's segment batch, so they own no OpenGL
+// resources.
 type Ground struct {
 	physicsShape *chipmunk.Shape
 	physicsBody  *chipmunk.Body
-	openglShape  *shapes.Segment
+
+	// The endpoints in world coordinates
+	x1, y1, x2, y2 float32
 }
 
-func newGround(world *World, x1, y1, x2, y2 float32) *Ground {
-	ground := new(Ground)
+func newGround(x1, y1, x2, y2 float32) *Ground {
+	ground := &Ground{x1: x1, y1: y1, x2: x2, y2: y2}
 
 	// Chipmunk body
 
@@ -32,14 +38,10 @@ func newGround(world *World, x1, y1, x2, y2 float32) *Ground {
 
 	ground.physicsBody.AddShape(ground.physicsShape)
 
-	// OpenGL shape
-
-	ground.openglShape = shapes.NewSegment(world.segmentProgramShader, x1, y1, x2, y2)
-	ground.openglShape.SetColor(color.White)
-
 	return ground
 }
 
-func (ground *Ground) draw() {
-	ground.openglShape.Draw()
+// draw adds the segment to the given batch of lines.
+func (ground *Ground) draw(b *batch) {
+	b.addLine(ground.x1, ground.y1, ground.x2, ground.y2, groundColor)
 }
@@ -0,0 +1,105 @@
+package chipmunklib
+
+const (
+	// The memory in bytes the snapshots of the history can use if
+	// not configured
+	DefaultHistorySize = 4 << 20
+)
+
+// historyEntry is the state of the world before an action.
+type historyEntry struct {
+	name     string
+	snapshot *Snapshot
+}
+
+// History records the actions of the player together with the
+// state of the world before each of them, so that they can be
+// undone and redone. When the snapshots use more than MaxSize bytes
+// the oldest actions are forgotten.
+type History struct {
+	MaxSize int
+
+	undo, redo []historyEntry
+	size       int
+}
+
+// NewHistory returns an empty history whose snapshots can use up to
+// maxSize bytes.
+func NewHistory(maxSize int) *History {
+	return &History{MaxSize: maxSize}
+}
+
+// Record adds an action to the history. The snapshot is the state
+// of the world before the action. Recording an action forgets the
+// actions undone.
+func (h *History) Record(name string, s *Snapshot) {
+	for _, e := range h.redo {
+		h.size -= e.snapshot.Size()
+	}
+	h.redo = h.redo[:0]
+	h.undo = append(h.undo, historyEntry{name, s})
+	h.size += s.Size()
+	h.trim()
+}
+
+// CanUndo returns true if there is an action to undo.
+func (h *History) CanUndo() bool {
+	return len(h.undo) > 0
+}
+
+// CanRedo returns true if there is an action to redo.
+func (h *History) CanRedo() bool {
+	return len(h.redo) > 0
+}
+
+// Undo restores the world as it was before the last action and
+// returns the name of the action, or false if there's nothing to
+// undo.
+func (h *History) Undo(w *World) (string, bool) {
+	return h.move(w, &h.undo, &h.redo)
+}
+
+// Redo performs again the last action undone and returns its name,
+// or false if there's nothing to redo.
+func (h *History) Redo(w *World) (string, bool) {
+	return h.move(w, &h.redo, &h.undo)
+}
+
+// Clear forgets all the actions.
+func (h *History) Clear() {
+	h.undo, h.redo, h.size = nil, nil, 0
+}
+
+// move restores the last snapshot of from, saving the current state
+// of the world in to.
+func (h *History) move(w *World, from, to *[]historyEntry) (string, bool) {
+	n := len(*from)
+	if n == 0 {
+		return "", false
+	}
+	e := (*from)[n-1]
+	(*from)[n-1] = historyEntry{}
+	*from = (*from)[:n-1]
+
+	current := w.Snapshot()
+	*to = append(*to, historyEntry{e.name, current})
+	h.size += current.Size() - e.snapshot.Size()
+	w.Restore(e.snapshot)
+	h.trim()
+	return e.name, true
+}
+
+// trim forgets the oldest actions until the snapshots fit in
+// MaxSize. The last action is always kept.
+func (h *History) trim() {
+	for h.size > h.MaxSize && len(h.undo)+len(h.redo) > 1 {
+		stack := &h.undo
+		if len(h.undo) == 0 {
+			stack = &h.redo
+		}
+		h.size -= (*stack)[0].snapshot.Size()
+		copy(*stack, (*stack)[1:])
+		(*stack)[len(*stack)-1] = historyEntry{}
+		*stack = (*stack)[:len(*stack)-1]
+	}
+}
@@ -0,0 +1,391 @@
+package chipmunklib
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/remogatto/gltext"
+	"github.com/remogatto/mathgl"
+	gl "github.com/remogatto/opengles2"
+)
+
+// Anchor is the point of the screen a label is attached to.
+type Anchor int
+
+const (
+	TopLeft Anchor = iota
+	Top
+	TopRight
+	Left
+	Center
+	Right
+	BottomLeft
+	Bottom
+	BottomRight
+)
+
+const (
+	// The default distance in pixels of the labels from the
+	// edges of the screen.
+	DefaultMargin = 10
+)
+
+// HUD draws retained text labels over the scene. Labels are
+// positioned in window coordinates, they don't move with the camera
+// and they are laid out again when the window is resized.
+type HUD struct {
+	world         *World
+	width, height float32
+	projMatrix    mathgl.Mat4f
+	viewMatrix    mathgl.Mat4f
+	labels        []*Label
+	widgets       []hudWidget
+	buttons       []*ButtonWidget
+}
+
+// hudWidget is implemented by the widgets that change over time.
+type hudWidget interface {
+	update(dt float32)
+}
+
+// NewHUD creates a HUD drawn using the font of the given world.
+func NewHUD(world *World) *HUD {
+	h := &HUD{world: world, viewMatrix: mathgl.Ident4f()}
+	h.resize(world.windowWidth, world.windowHeight)
+	return h
+}
+
+func (h *HUD) Projection() mathgl.Mat4f {
+	return h.projMatrix
+}
+
+func (h *HUD) View() mathgl.Mat4f {
+	return h.viewMatrix
+}
+
+func (h *HUD) UploadRGBAImage(img *image.RGBA) gltext.Texture {
+	return h.world.UploadRGBAImage(img)
+}
+
+func (h *HUD) resize(width, height int) {
+	h.width, h.height = float32(width), float32(height)
+	h.projMatrix = mathgl.Ortho2D(0, h.width, 0, h.height)
+}
+
+// NewLabel adds an empty label anchored to the given point of the
+// screen.
+func (h *HUD) NewLabel(anchor Anchor, marginX, marginY float32) *Label {
+	l := &Label{
+		Anchor:  anchor,
+		MarginX: marginX,
+		MarginY: marginY,
+		Visible: true,
+		hud:     h,
+	}
+	h.labels = append(h.labels, l)
+	return l
+}
+
+// update advances the widgets by dt seconds.
+func (h *HUD) update(dt float32) {
+	for _, w := range h.widgets {
+		w.update(dt)
+	}
+}
+
+// begin extends the drawing to the whole window, letterbox bars
+// included.
+func (h *HUD) begin() {
+	gl.Disable(gl.SCISSOR_TEST)
+	gl.Viewport(0, 0, gl.Sizei(h.width), gl.Sizei(h.height))
+}
+
+// end restricts the drawing to the world again.
+func (h *HUD) end() {
+	h.world.applyViewport()
+}
+
+// draw draws the labels.
+func (h *HUD) draw() {
+	h.begin()
+	for _, l := range h.labels {
+		if l.Visible && l.text != nil {
+			l.text.MoveTo(l.position())
+			l.text.Draw()
+			drawCalls++
+		}
+	}
+	h.end()
+}
+
+// Label is a retained text. The text is rendered again only when
+// its content changes, and the texture of the previous content is
+// released.
+type Label struct {
+	Anchor           Anchor
+	MarginX, MarginY float32
+	Visible          bool
+
+	hud  *HUD
+	str  string
+	text *gltext.Text
+
+	// The texture of text, nil if text belongs to a textPool
+	texture gltext.Texture
+}
+
+func (l *Label) Projection() mathgl.Mat4f {
+	return l.hud.projMatrix
+}
+
+func (l *Label) View() mathgl.Mat4f {
+	return l.hud.viewMatrix
+}
+
+// UploadRGBAImage uploads the texture of the text of the label,
+// keeping it to release it when the text changes.
+func (l *Label) UploadRGBAImage(img *image.RGBA) gltext.Texture {
+	l.texture = l.hud.world.UploadRGBAImage(img)
+	return l.texture
+}
+
+// SetText changes the content of the label.
+func (l *Label) SetText(s string) {
+	if s == l.str {
+		return
+	}
+	l.release()
+	l.str = s
+	if s == "" {
+		return
+	}
+	text, err := l.hud.world.font.Printf("%s", s)
+	if err != nil {
+		panic(err)
+	}
+	text.AttachToWorld(l)
+	l.text = text
+}
+
+// setPooledText shows a text owned by a textPool.
+func (l *Label) setPooledText(s string, text *gltext.Text) {
+	if s == l.str {
+		return
+	}
+	l.release()
+	l.str, l.text = s, text
+}
+
+// release releases the texture of the text, if owned by the label.
+func (l *Label) release() {
+	if l.texture != nil {
+		l.hud.world.DeleteTexture(l.texture)
+		l.texture = nil
+	}
+	l.text = nil
+}
+
+// Text returns the content of the label.
+func (l *Label) Text() string {
+	return l.str
+}
+
+// position returns the center of the label in window coordinates.
+func (l *Label) position() (float32, float32) {
+	r := l.text.Bounds()
+	hw, hh := float32(r.Dx())/2, float32(r.Dy())/2
+	w, h := l.hud.width, l.hud.height
+
+	var x, y float32
+	switch l.Anchor {
+	case TopLeft, Left, BottomLeft:
+		x = l.MarginX + hw
+	case Top, Center, Bottom:
+		x = w/2 + l.MarginX
+	case TopRight, Right, BottomRight:
+		x = w - l.MarginX - hw
+	}
+	switch l.Anchor {
+	case TopLeft, Top, TopRight:
+		y = h - l.MarginY - hh
+	case Left, Center, Right:
+		y = h/2 + l.MarginY
+	case BottomLeft, Bottom, BottomRight:
+		y = l.MarginY + hh
+	}
+	return x, y
+}
+
+// FPSWidget shows the frames per second. The texts of the values
+// shown are kept, so that the frame rate going back and forth
+// between a few values doesn't render nor allocate anything.
+type FPSWidget struct {
+	*Label
+	fps   int
+	texts *textPool
+}
+
+// NewFPSWidget adds a FPS counter to the HUD.
+func (h *HUD) NewFPSWidget(anchor Anchor, marginX, marginY float32) *FPSWidget {
+	w := &FPSWidget{Label: h.NewLabel(anchor, marginX, marginY), fps: -1}
+	w.texts = newTextPool(h, func(fps int) string {
+		return h.world.messages.N("fps", fps)
+	})
+	w.Set(0)
+	return w
+}
+
+// Set changes the FPS shown.
+func (w *FPSWidget) Set(fps int) {
+	if fps == w.fps {
+		return
+	}
+	w.fps = fps
+	w.setPooledText(w.texts.get(fps))
+}
+
+// ScoreWidget shows the score.
+type ScoreWidget struct {
+	*Label
+	score int
+}
+
+// NewScoreWidget adds a score counter to the HUD.
+func (h *HUD) NewScoreWidget(anchor Anchor, marginX, marginY float32) *ScoreWidget {
+	w := &ScoreWidget{Label: h.NewLabel(anchor, marginX, marginY), score: -1}
+	w.Set(0)
+	return w
+}
+
+// Set changes the score shown.
+func (w *ScoreWidget) Set(score int) {
+	if score == w.score {
+		return
+	}
+	w.score = score
+	w.SetText(w.hud.world.messages.T("score", score))
+}
+
+// Add adds points to the score.
+func (w *ScoreWidget) Add(points int) {
+	w.Set(w.score + points)
+}
+
+// Score returns the current score.
+func (w *ScoreWidget) Score() int {
+	return w.score
+}
+
+// TimerWidget shows the time elapsed since its creation, or since
+// the last reset, in minutes and seconds.
+type TimerWidget struct {
+	*Label
+	Running bool
+	elapsed float32
+	seconds int
+}
+
+// NewTimerWidget adds a running timer to the HUD.
+func (h *HUD) NewTimerWidget(anchor Anchor, marginX, marginY float32) *TimerWidget {
+	w := &TimerWidget{Label: h.NewLabel(anchor, marginX, marginY), Running: true}
+	w.Reset()
+	h.widgets = append(h.widgets, w)
+	return w
+}
+
+// Reset brings the timer back to zero.
+func (w *TimerWidget) Reset() {
+	w.elapsed = 0
+	w.seconds = -1
+	w.update(0)
+}
+
+// Elapsed returns the time measured in seconds.
+func (w *TimerWidget) Elapsed() float32 {
+	return w.elapsed
+}
+
+func (w *TimerWidget) update(dt float32) {
+	if w.Running {
+		w.elapsed += dt
+	}
+	if s := int(w.elapsed); s != w.seconds {
+		w.seconds = s
+		w.SetText(fmt.Sprintf("%02d:%02d", s/60, s%60))
+	}
+}
+
+// MessageWidget shows a message for a given time.
+type MessageWidget struct {
+	*Label
+	remaining float32
+}
+
+// NewMessageWidget adds an empty message to the HUD.
+func (h *HUD) NewMessageWidget(anchor Anchor, marginX, marginY float32) *MessageWidget {
+	w := &MessageWidget{Label: h.NewLabel(anchor, marginX, marginY)}
+	h.widgets = append(h.widgets, w)
+	return w
+}
+
+// Show shows the message for the given number of seconds. If
+// duration is zero the message stays until hidden.
+func (w *MessageWidget) Show(msg string, duration float32) {
+	w.SetText(msg)
+	w.remaining = duration
+}
+
+// Hide hides the message.
+func (w *MessageWidget) Hide() {
+	w.SetText("")
+	w.remaining = 0
+}
+
+func (w *MessageWidget) update(dt float32) {
+	if w.remaining <= 0 {
+		return
+	}
+	w.remaining -= dt
+	if w.remaining <= 0 {
+		w.Hide()
+	}
+}
+
+// ButtonWidget is a label that calls a function when tapped.
+type ButtonWidget struct {
+	*Label
+	pressed func()
+}
+
+// NewButtonWidget adds a button showing the given text to the HUD.
+func (h *HUD) NewButtonWidget(anchor Anchor, marginX, marginY float32, text string, pressed func()) *ButtonWidget {
+	w := &ButtonWidget{Label: h.NewLabel(anchor, marginX, marginY), pressed: pressed}
+	w.SetText(text)
+	h.buttons = append(h.buttons, w)
+	return w
+}
+
+// contains returns true if the label is visible at the given window
+// coordinates, with y growing downward.
+func (l *Label) contains(x, y float32) bool {
+	if !l.Visible || l.text == nil {
+		return false
+	}
+	cx, cy := l.position()
+	r := l.text.Bounds()
+	hw, hh := float32(r.Dx())/2, float32(r.Dy())/2
+	y = l.hud.height - y
+	return x >= cx-hw && x <= cx+hw && y >= cy-hh && y <= cy+hh
+}
+
+// Tap presses the button at the given window coordinates, with y
+// growing downward. It returns false if there's no button there.
+func (h *HUD) Tap(x, y float32) bool {
+	for _, b := range h.buttons {
+		if b.contains(x, y) {
+			b.pressed()
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package chipmunklib
+
+// BodyState is the state of a box as seen by the debug server.
+type BodyState struct {
+	BoxState
+	Sleeping bool
+}
+
+// ContactState is a contact point between two bodies, in world
+// coordinates.
+type ContactState struct {
+	X, Y   float32
+	NX, NY float32
+}
+
+// WorldState is the state of the simulation as seen by the debug
+// server.
+type WorldState struct {
+	Gravity  [2]float32
+	Paused   bool
+	Editing  bool
+	Bodies   []BodyState
+	Contacts []ContactState
+}
+
+// FrameStats are the statistics of the last frame.
+type FrameStats struct {
+	Fps      int
+	Bodies   int
+	Contacts int
+
+	// The number of particles alive
+	Particles int
+
+	// The draw calls issued by the frame
+	DrawCalls int
+
+	// The time spent stepping the simulation and drawing, in
+	// milliseconds
+	StepTime float32
+	DrawTime float32
+}
+
+// Inspect returns the current state of the simulation. It allocates
+// and isn't meant to be called every frame.
+func (s *GameState) Inspect() *WorldState {
+	state := &WorldState{
+		Paused:  s.paused,
+		Editing: s.editing,
+	}
+	state.Gravity[0], state.Gravity[1] = s.World.Gravity()
+	snapshot := s.World.Snapshot()
+	state.Bodies = make([]BodyState, len(snapshot.Boxes))
+	for i, box := range snapshot.Boxes {
+		state.Bodies[i] = BodyState{box, s.World.boxes[i].physicsBody.IsSleeping()}
+	}
+	state.Contacts = []ContactState{}
+	for _, arbiter := range s.World.space.Arbiters {
+		for _, contact := range arbiter.Contacts {
+			p, n := contact.Position(), contact.Normal()
+			state.Contacts = append(state.Contacts, ContactState{
+				float32(p.X), float32(p.Y),
+				float32(n.X), float32(n.Y),
+			})
+		}
+	}
+	return state
+}
+
+// Stats returns the statistics of the last frame.
+func (s *GameState) Stats() FrameStats {
+	contacts := 0
+	for _, arbiter := range s.World.space.Arbiters {
+		contacts += len(arbiter.Contacts)
+	}
+	return FrameStats{
+		Fps:       s.Fps,
+		Bodies:    len(s.World.boxes),
+		Contacts:  contacts,
+		Particles: s.World.particles.n,
+		DrawCalls: s.drawCalls,
+		StepTime:  float32(s.stepTime.Seconds() * 1000),
+		DrawTime:  float32(s.drawTime.Seconds() * 1000),
+	}
+}
+
+// ExplodeAt makes an explosion at the given world coordinates.
+func (s *GameState) ExplodeAt(x, y float32) {
+	s.history.Record("explode", s.World.Snapshot())
+	s.World.ExplosionAt(x, y)
+	s.trackExplosion(x, y)
+}
+
+// SpawnBox adds a box of the given size at the given world
+// coordinates.
+func (s *GameState) SpawnBox(x, y, width, height float32) {
+	s.history.Record("spawn", s.World.Snapshot())
+	s.World.SpawnBox(x, y, width, height)
+}
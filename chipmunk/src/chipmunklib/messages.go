@@ -0,0 +1,94 @@
+package chipmunklib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/i18n"
+)
+
+// The resources containing the translations, by locale in lower
+// case with underscores, like raw/messages_pt_br.json
+const MessagesFilename = "raw/messages_%s.json"
+
+// The English messages, used for the messages missing from the
+// translation
+const defaultMessages = `{
+    "locale": "en",
+    "messages": {
+        "fps": { "one": "{0} frame per second", "other": "{0} frames per second" },
+        "score": "Score {0}",
+        "paused": "Paused",
+        "undo": "Undo",
+        "redo": "Redo",
+        "undoAction": "Undo {0}",
+        "redoAction": "Redo {0}",
+        "action.remove": "remove",
+        "action.explode": "explosion",
+        "action.drop": "drop",
+        "action.spawn": "spawn",
+        "action.reset": "reset",
+        "action.drag": "drag",
+        "edit": "Edit",
+        "done": "Done",
+        "tool.select": "Select",
+        "tool.box": "Box",
+        "tool.segment": "Segment",
+        "selectedTool": "> {0}",
+        "delete": "Delete",
+        "snapOn": "Snap: on",
+        "snapOff": "Snap: off",
+        "play": "Play",
+        "stop": "Stop",
+        "save": "Save",
+        "massDown": "Mass -",
+        "massUp": "Mass +",
+        "bounceDown": "Bounce -",
+        "bounceUp": "Bounce +",
+        "breakable": "Breakable",
+        "boxInfo": "{0:%g}x{1:%g} mass {2:%g} elasticity {3:%.1f} breakable {4:%g}",
+        "segmentInfo": "segment {0:%g},{1:%g} {2:%g},{3:%g}",
+        "saveFailed": "Can't save the level",
+        "savedTo": "Saved to {0}",
+        "adInterstitial": "Interstitial ad, tap to close",
+        "adBanner": "Banner ad",
+        "crashed": "The game crashed last time",
+        "exportCrash": "Export crash report",
+        "exportCrashFailed": "Can't export the crash report",
+        "discardCrash": "Discard crash report"
+    }
+}`
+
+// loadMessages returns the catalog of the given locale, falling
+// back to English. If locale is empty the locale of the device is
+// used. A catalog needing more glyphs than the font can load is
+// replaced by the English one.
+func loadMessages(locale string) *i18n.Catalog {
+	defaults, err := i18n.Parse([]byte(defaultMessages))
+	if err != nil {
+		panic(err)
+	}
+	if locale == "" {
+		locale = i18n.DetectLocale()
+	}
+	for _, candidate := range i18n.Candidates(locale) {
+		name := strings.ToLower(strings.Replace(candidate, "-", "_", -1))
+		buf, err := readResource(fmt.Sprintf(MessagesFilename, name))
+		if err != nil {
+			continue
+		}
+		catalog, err := i18n.Parse(buf)
+		if err != nil {
+			mandala.Logf("Can't load the %s messages: %s\n", candidate, err.Error())
+			continue
+		}
+		catalog.SetFallback(defaults)
+		if _, _, err := catalog.GlyphRange(); err != nil {
+			mandala.Logf("Showing the English messages: %s\n", err.Error())
+			return defaults
+		}
+		return catalog
+	}
+	return defaults
+}
@@ -0,0 +1,447 @@
+package chipmunklib
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/remogatto/mandala"
+	gl "github.com/remogatto/opengles2"
+)
+
+const (
+	// The file containing the emitter definitions. Effects can be
+	// tuned editing it, without recompiling.
+	ParticlesFilename = "raw/particles.json"
+
+	// The maximum number of particles alive at the same
+	// time. Particles emitted when the system is full are
+	// dropped.
+	MaxParticles = 4096
+
+	// The maximum number of continuous emitters alive at the same
+	// time.
+	MaxEmitters = 32
+
+	particleVS = `
+uniform mat4 projection;
+uniform mat4 view;
+attribute vec2 pos;
+attribute float size;
+attribute vec4 color;
+varying vec4 vColor;
+
+void main() {
+	gl_Position = projection*view*vec4(pos, 0.0, 1.0);
+	gl_PointSize = size;
+	vColor = color;
+}
+`
+	particleFS = `
+precision mediump float;
+varying vec4 vColor;
+
+void main() {
+	float d = length(gl_PointCoord - vec2(0.5));
+	gl_FragColor = vec4(vColor.rgb, vColor.a*(1.0 - smoothstep(0.25, 0.5, d)));
+}
+`
+)
+
+// Emission modes
+const (
+	// A burst emits all the particles at once
+	burstMode = "burst"
+
+	// A continuous emitter emits particles at a given rate
+	continuousMode = "continuous"
+)
+
+// colorKey is a keyframe of a color-over-life curve. T is the
+// normalized age of the particle, from 0 (birth) to 1 (death).
+type colorKey struct {
+	T    float32    `json:"t"`
+	RGBA [4]float32 `json:"rgba"`
+}
+
+// sizeKey is a keyframe of a size-over-life curve. Size is in
+// pixels.
+type sizeKey struct {
+	T    float32 `json:"t"`
+	Size float32 `json:"size"`
+}
+
+// emitterDef defines how an effect emits particles and how the
+// particles evolve during their life.
+type emitterDef struct {
+	// "burst" or "continuous"
+	Mode string `json:"mode"`
+
+	// The number of particles of a burst
+	Count int `json:"count"`
+
+	// The particles emitted per second by a continuous emitter
+	// and how long it lasts in seconds
+	Rate     float32 `json:"rate"`
+	Duration float32 `json:"duration"`
+
+	// Min and max lifetime of the particles in seconds
+	Lifetime [2]float32 `json:"lifetime"`
+
+	// Min and max initial speed in pixels per second
+	Speed [2]float32 `json:"speed"`
+
+	// The direction of emission and the spread around it, both in
+	// degrees
+	Direction float32 `json:"direction"`
+	Spread    float32 `json:"spread"`
+
+	// The acceleration applied to the particles
+	Gravity [2]float32 `json:"gravity"`
+
+	Color []colorKey `json:"color"`
+	Size  []sizeKey  `json:"size"`
+}
+
+var defaultEmitterDefs = map[string]*emitterDef{
+	"explosion": &emitterDef{
+		Mode:     burstMode,
+		Count:    300,
+		Lifetime: [2]float32{0.4, 1.2},
+		Speed:    [2]float32{100, 500},
+		Spread:   360,
+		Gravity:  [2]float32{0, -200},
+		Color: []colorKey{
+			{0, [4]float32{1, 1, 0.6, 1}},
+			{0.3, [4]float32{1, 0.5, 0.1, 0.8}},
+			{1, [4]float32{0.3, 0.3, 0.3, 0}},
+		},
+		Size: []sizeKey{{0, 16}, {1, 4}},
+	},
+	"impact": &emitterDef{
+		Mode:      burstMode,
+		Count:     12,
+		Lifetime:  [2]float32{0.2, 0.5},
+		Speed:     [2]float32{40, 120},
+		Direction: 90,
+		Spread:    120,
+		Gravity:   [2]float32{0, Gravity},
+		Color: []colorKey{
+			{0, [4]float32{1, 1, 1, 0.8}},
+			{1, [4]float32{0.6, 0.6, 0.6, 0}},
+		},
+		Size: []sizeKey{{0, 6}, {1, 2}},
+	},
+	"debris": &emitterDef{
+		Mode:     burstMode,
+		Count:    40,
+		Lifetime: [2]float32{0.3, 0.9},
+		Speed:    [2]float32{60, 260},
+		Spread:   360,
+		Gravity:  [2]float32{0, Gravity},
+		Color: []colorKey{
+			{0, [4]float32{0.9, 0.9, 1, 1}},
+			{1, [4]float32{0.5, 0.5, 0.6, 0}},
+		},
+		Size: []sizeKey{{0, 5}, {1, 3}},
+	},
+}
+
+func (def *emitterDef) color(t float32) (c [4]float32) {
+	keys := def.Color
+	if len(keys) == 0 {
+		return [4]float32{1, 1, 1, 1}
+	}
+	if t <= keys[0].T {
+		return keys[0].RGBA
+	}
+	for i := 1; i < len(keys); i++ {
+		if t <= keys[i].T {
+			k := (t - keys[i-1].T) / (keys[i].T - keys[i-1].T)
+			for j := range c {
+				c[j] = keys[i-1].RGBA[j] + (keys[i].RGBA[j]-keys[i-1].RGBA[j])*k
+			}
+			return c
+		}
+	}
+	return keys[len(keys)-1].RGBA
+}
+
+func (def *emitterDef) size(t float32) float32 {
+	keys := def.Size
+	if len(keys) == 0 {
+		return 1
+	}
+	if t <= keys[0].T {
+		return keys[0].Size
+	}
+	for i := 1; i < len(keys); i++ {
+		if t <= keys[i].T {
+			k := (t - keys[i-1].T) / (keys[i].T - keys[i-1].T)
+			return keys[i-1].Size + (keys[i].Size-keys[i-1].Size)*k
+		}
+	}
+	return keys[len(keys)-1].Size
+}
+
+// validate returns an error if the definition can't be played: an
+// unknown mode, a continuous emitter that never ends, ranges with
+// the min greater than the max or keyframes out of order.
+func (def *emitterDef) validate() error {
+	switch def.Mode {
+	case burstMode:
+		if def.Count <= 0 {
+			return fmt.Errorf("count must be positive, got %d", def.Count)
+		}
+	case continuousMode:
+		if def.Rate <= 0 {
+			return fmt.Errorf("rate must be positive, got %g", def.Rate)
+		}
+		if def.Duration <= 0 {
+			return fmt.Errorf("duration must be positive, got %g", def.Duration)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q, want %q or %q", def.Mode, burstMode, continuousMode)
+	}
+	if def.Lifetime[0] <= 0 || def.Lifetime[0] > def.Lifetime[1] {
+		return fmt.Errorf("lifetime must be a positive [min, max] range, got %v", def.Lifetime)
+	}
+	if def.Speed[0] < 0 || def.Speed[0] > def.Speed[1] {
+		return fmt.Errorf("speed must be a [min, max] range, got %v", def.Speed)
+	}
+	// The curves are interpolated between consecutive keyframes,
+	// which can't share the same time
+	last := float32(-1)
+	for _, k := range def.Color {
+		if k.T < 0 || k.T > 1 || k.T <= last {
+			return fmt.Errorf("color keyframes must have increasing t from 0 to 1, got %g after %g", k.T, last)
+		}
+		last = k.T
+	}
+	last = -1
+	for _, k := range def.Size {
+		if k.T < 0 || k.T > 1 || k.T <= last {
+			return fmt.Errorf("size keyframes must have increasing t from 0 to 1, got %g after %g", k.T, last)
+		}
+		last = k.T
+	}
+	return nil
+}
+
+// emitter is a running continuous emitter.
+type emitter struct {
+	def         *emitterDef
+	x, y        float32
+	elapsed     float32
+	accumulator float32
+}
+
+// particleSystem simulates and draws the particles of all the
+// effects. Particles are stored in preallocated arrays and drawn as
+// point sprites with additive blending in a single call.
+type particleSystem struct {
+	world *World
+	defs  map[string]*emitterDef
+
+	// Particle state
+	n          int
+	x, y       [MaxParticles]float32
+	vx, vy     [MaxParticles]float32
+	age, life  [MaxParticles]float32
+	particleOf [MaxParticles]*emitterDef
+
+	emitters    [MaxEmitters]emitter
+	numEmitters int
+
+	// Vertex data
+	positions [2 * MaxParticles]float32
+	sizes     [MaxParticles]float32
+	colors    [4 * MaxParticles]byte
+
+	material                                *material
+	attrSize                                uint32
+	positionBuffer, sizeBuffer, colorBuffer uint32
+}
+
+// loadEmitterDefs reads the emitter definitions from the given
+// file. Definitions missing from the file fall back to the default
+// ones. If a definition is invalid only the default ones are
+// returned, with the error.
+func loadEmitterDefs(filename string) (map[string]*emitterDef, error) {
+	defs := make(map[string]*emitterDef)
+	for name, def := range defaultEmitterDefs {
+		defs[name] = def
+	}
+	buf, err := readResource(filename)
+	if err != nil {
+		return defs, err
+	}
+	loaded := make(map[string]*emitterDef)
+	if err := json.Unmarshal(buf, &loaded); err != nil {
+		return defs, err
+	}
+	for name, def := range loaded {
+		if err := def.validate(); err != nil {
+			return defs, fmt.Errorf("%s: effect %q: %s", filename, name, err.Error())
+		}
+	}
+	for name, def := range loaded {
+		defs[name] = def
+	}
+	return defs, nil
+}
+
+func newParticleSystem(world *World) *particleSystem {
+	p := &particleSystem{world: world}
+
+	var err error
+	p.defs, err = loadEmitterDefs(ParticlesFilename)
+	if err != nil {
+		mandala.Logf("Using default particle effects: %s\n", err.Error())
+	}
+
+	p.material = newMaterial(particleFS, particleVS)
+	p.attrSize = p.material.program.GetAttribute("size")
+
+	gl.GenBuffers(1, &p.positionBuffer)
+	gl.GenBuffers(1, &p.sizeBuffer)
+	gl.GenBuffers(1, &p.colorBuffer)
+
+	return p
+}
+
+// spawn adds count particles of the given effect in (x, y).
+func (p *particleSystem) spawn(def *emitterDef, x, y float32, count int) {
+	for i := 0; i < count && p.n < MaxParticles; i++ {
+		angle := (def.Direction + (rand.Float32()-0.5)*def.Spread) * math.Pi / 180
+		speed := def.Speed[0] + rand.Float32()*(def.Speed[1]-def.Speed[0])
+		sin, cos := math.Sincos(float64(angle))
+
+		p.x[p.n], p.y[p.n] = x, y
+		p.vx[p.n], p.vy[p.n] = float32(cos)*speed, float32(sin)*speed
+		p.age[p.n] = 0
+		p.life[p.n] = def.Lifetime[0] + rand.Float32()*(def.Lifetime[1]-def.Lifetime[0])
+		p.particleOf[p.n] = def
+		p.n++
+	}
+}
+
+// emit plays the effect with the given name in (x, y), expressed in
+// world coordinates. Bursts are emitted immediately, continuous
+// effects run for their duration. Continuous effects played while
+// MaxEmitters are running are dropped.
+func (p *particleSystem) emit(name string, x, y float32) {
+	def, ok := p.defs[name]
+	if !ok {
+		mandala.Logf("Unknown particle effect %q\n", name)
+		return
+	}
+	if def.Mode == burstMode {
+		p.spawn(def, x, y, def.Count)
+		return
+	}
+	if p.numEmitters == MaxEmitters {
+		return
+	}
+	p.emitters[p.numEmitters] = emitter{def: def, x: x, y: y}
+	p.numEmitters++
+}
+
+// update advances the simulation by dt seconds.
+func (p *particleSystem) update(dt float32) {
+	// Run the continuous emitters
+	for i := 0; i < p.numEmitters; i++ {
+		e := &p.emitters[i]
+		e.elapsed += dt
+		if e.elapsed > e.def.Duration {
+			p.numEmitters--
+			p.emitters[i] = p.emitters[p.numEmitters]
+			p.emitters[p.numEmitters] = emitter{}
+			i--
+			continue
+		}
+		e.accumulator += dt * e.def.Rate
+		count := int(e.accumulator)
+		e.accumulator -= float32(count)
+		p.spawn(e.def, e.x, e.y, count)
+	}
+
+	// Move the particles and kill the old ones, replacing them
+	// with the last one
+	for i := 0; i < p.n; i++ {
+		p.age[i] += dt
+		if p.age[i] >= p.life[i] {
+			p.n--
+			p.x[i], p.y[i] = p.x[p.n], p.y[p.n]
+			p.vx[i], p.vy[i] = p.vx[p.n], p.vy[p.n]
+			p.age[i], p.life[i] = p.age[p.n], p.life[p.n]
+			p.particleOf[i] = p.particleOf[p.n]
+			p.particleOf[p.n] = nil
+			i--
+			continue
+		}
+		def := p.particleOf[i]
+		p.vx[i] += def.Gravity[0] * dt
+		p.vy[i] += def.Gravity[1] * dt
+		p.x[i] += p.vx[i] * dt
+		p.y[i] += p.vy[i] * dt
+	}
+}
+
+// draw draws all the particles alive with a single call.
+func (p *particleSystem) draw() {
+	if p.n == 0 {
+		return
+	}
+
+	for i := 0; i < p.n; i++ {
+		def := p.particleOf[i]
+		t := p.age[i] / p.life[i]
+		c := def.color(t)
+		p.positions[2*i], p.positions[2*i+1] = p.x[i], p.y[i]
+		p.sizes[i] = def.size(t)
+		for j := 0; j < 4; j++ {
+			p.colors[4*i+j] = byte(c[j] * 255)
+		}
+	}
+
+	m := p.material
+	m.program.Use()
+
+	gl.UniformMatrix4fv(int32(m.uniformProjection), 1, false, &p.world.projMatrix[0])
+	gl.UniformMatrix4fv(int32(m.uniformView), 1, false, &p.world.viewMatrix[0])
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.positionBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.SizeiPtr(2*p.n*4), gl.Void(&p.positions[0]), gl.STREAM_DRAW)
+	gl.EnableVertexAttribArray(m.attrPos)
+	gl.VertexAttribPointer(m.attrPos, 2, gl.FLOAT, false, 0, nil)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.sizeBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.SizeiPtr(p.n*4), gl.Void(&p.sizes[0]), gl.STREAM_DRAW)
+	gl.EnableVertexAttribArray(p.attrSize)
+	gl.VertexAttribPointer(p.attrSize, 1, gl.FLOAT, false, 0, nil)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.colorBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.SizeiPtr(4*p.n), gl.Void(&p.colors[0]), gl.STREAM_DRAW)
+	gl.EnableVertexAttribArray(m.attrColor)
+	gl.VertexAttribPointer(m.attrColor, 4, gl.UNSIGNED_BYTE, true, 0, nil)
+
+	// Additive blending
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE)
+	gl.DrawArrays(gl.POINTS, 0, gl.Sizei(p.n))
+	drawCalls++
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+
+	gl.DisableVertexAttribArray(m.attrPos)
+	gl.DisableVertexAttribArray(p.attrSize)
+	gl.DisableVertexAttribArray(m.attrColor)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+func (p *particleSystem) release() {
+	gl.DeleteBuffers(1, &p.positionBuffer)
+	gl.DeleteBuffers(1, &p.sizeBuffer)
+	gl.DeleteBuffers(1, &p.colorBuffer)
+	p.material.release()
+}
@@ -0,0 +1,139 @@
+package chipmunklib
+
+import (
+	"image"
+
+	"github.com/remogatto/gltext"
+	"github.com/remogatto/mathgl"
+)
+
+const (
+	// The number of free boxes a pool bucket can hold before
+	// growing.
+	boxPoolCapacity = 64
+
+	// The number of texts a text pool holds before dropping them
+	// all.
+	textPoolCapacity = 256
+)
+
+type boxSize struct {
+	width, height float32
+}
+
+// boxPool recycles boxes so that removing and adding boxes during
+// the game doesn't allocate new chipmunk bodies and OpenGL
+// shapes. Boxes are bucketed by size because neither the physics
+// shape nor the OpenGL shape can be resized once created.
+type boxPool struct {
+	free map[boxSize][]*Box
+}
+
+func newBoxPool() *boxPool {
+	return &boxPool{make(map[boxSize][]*Box)}
+}
+
+// get returns a box of the given size, reusing a free one if
+// available. The returned box is at rest in the origin.
+func (p *boxPool) get(world *World, width, height float32) *Box {
+	size := boxSize{width, height}
+	free := p.free[size]
+	if len(free) == 0 {
+		return newBox(world, width, height)
+	}
+	box := free[len(free)-1]
+	free[len(free)-1] = nil
+	p.free[size] = free[:len(free)-1]
+	box.reset()
+	return box
+}
+
+// put gives back a box to the pool. The box must have already been
+// removed from the space.
+func (p *boxPool) put(box *Box) {
+	size := boxSize{box.width, box.height}
+	free := p.free[size]
+	if free == nil {
+		free = make([]*Box, 0, boxPoolCapacity)
+	}
+	p.free[size] = append(free, box)
+}
+
+// drain releases all the boxes held by the pool.
+func (p *boxPool) drain() {
+	for size, free := range p.free {
+		for i, box := range free {
+			box.release()
+			free[i] = nil
+		}
+		delete(p.free, size)
+	}
+}
+
+// textPool caches the text objects rendered for integer values using
+// a fixed format function. Printing a value that was already printed
+// doesn't allocate nor upload anything. The pool is bounded: when
+// full, its texts are dropped and their textures released.
+type textPool struct {
+	hud      *HUD
+	format   func(int) string
+	texts    map[int]pooledText
+	textures []gltext.Texture
+}
+
+type pooledText struct {
+	str  string
+	text *gltext.Text
+}
+
+func newTextPool(hud *HUD, format func(int) string) *textPool {
+	return &textPool{
+		hud:    hud,
+		format: format,
+		texts:  make(map[int]pooledText),
+	}
+}
+
+func (p *textPool) Projection() mathgl.Mat4f {
+	return p.hud.projMatrix
+}
+
+func (p *textPool) View() mathgl.Mat4f {
+	return p.hud.viewMatrix
+}
+
+func (p *textPool) UploadRGBAImage(img *image.RGBA) gltext.Texture {
+	t := p.hud.world.UploadRGBAImage(img)
+	p.textures = append(p.textures, t)
+	return t
+}
+
+// get returns the string and the text for the given value.
+func (p *textPool) get(value int) (string, *gltext.Text) {
+	if t, ok := p.texts[value]; ok {
+		return t.str, t.text
+	}
+	if len(p.texts) >= textPoolCapacity {
+		p.drain()
+	}
+	s := p.format(value)
+	text, err := p.hud.world.font.Printf("%s", s)
+	if err != nil {
+		panic(err)
+	}
+	text.AttachToWorld(p)
+	p.texts[value] = pooledText{s, text}
+	return s, text
+}
+
+// drain forgets all the cached texts and releases their textures.
+func (p *textPool) drain() {
+	for value := range p.texts {
+		delete(p.texts, value)
+	}
+	for i, t := range p.textures {
+		p.hud.world.DeleteTexture(t)
+		p.textures[i] = nil
+	}
+	p.textures = p.textures[:0]
+}
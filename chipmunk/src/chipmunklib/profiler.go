@@ -0,0 +1,293 @@
+package chipmunklib
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	gl "github.com/remogatto/opengles2"
+)
+
+// ProfileMetric identifies a quantity sampled by the profiler at
+// each frame.
+type ProfileMetric int
+
+const (
+	// The time spent stepping the physics space
+	ProfileStep ProfileMetric = iota
+
+	// The CPU time spent issuing the draw calls
+	ProfileDraw
+
+	// The time spent swapping the buffers
+	ProfileSwap
+
+	// The GC pauses occurred since the previous GC sample, taken
+	// once per profileGCInterval
+	ProfileGC
+
+	// The number of bodies in the space
+	ProfileBodies
+
+	// The number of contacts between shapes
+	ProfileContacts
+
+	// The number of draw calls issued by the frame
+	ProfileDrawCalls
+
+	numProfileMetrics
+)
+
+const (
+	// The number of frames shown in the graphs
+	ProfileHistory = 120
+
+	// The number of frames kept to be written as CSV, ten
+	// minutes at DefaultFps. Older frames are dropped.
+	ProfileCapacity = 10 * 60 * DefaultFps
+
+	// The size in pixels of each graph
+	profileGraphWidth  = ProfileHistory
+	profileGraphHeight = 24
+
+	// The vertical distance in pixels between the graphs
+	profileGraphSpacing = 6
+
+	// The time in milliseconds a frame can take at DefaultFps
+	profileFrameBudget = 1000 / float32(DefaultFps)
+
+	// How often the numbers are refreshed, in seconds
+	profileRefreshInterval = 1
+
+	// How often the GC statistics are read
+	profileGCInterval = time.Second
+)
+
+var (
+	profileMetricNames = [numProfileMetrics]string{
+		"step_ms", "draw_ms", "swap_ms", "gc_ms", "bodies", "contacts", "draw_calls",
+	}
+
+	profileFrameColor  = rgba(color.RGBA{255, 255, 255, 96})
+	profileBudgetColor = rgba(color.RGBA{255, 0, 0, 160})
+	profileGraphColors = [numProfileMetrics][4]byte{
+		rgba(color.RGBA{0, 255, 0, 255}),
+		rgba(color.RGBA{0, 255, 255, 255}),
+		rgba(color.RGBA{255, 255, 0, 255}),
+		rgba(color.RGBA{255, 0, 0, 255}),
+		rgba(color.RGBA{255, 0, 255, 255}),
+		rgba(color.RGBA{255, 128, 0, 255}),
+		rgba(color.RGBA{128, 128, 255, 255}),
+	}
+)
+
+type profileSample [numProfileMetrics]float32
+
+// Profiler samples the cost of each frame. It draws rolling graphs
+// with the min, average and 99th percentile of each metric over the
+// scene, and keeps the samples of the last ProfileCapacity frames to
+// be written as CSV.
+type Profiler struct {
+	world *World
+	hud   *HUD
+
+	current profileSample
+
+	// A ring buffer of samples, the sample of frame n is at
+	// n%ProfileCapacity
+	samples []profileSample
+	frames  int
+	recent  [ProfileHistory]profileSample
+
+	gcStats   debug.GCStats
+	numGC     int64
+	gcSampled time.Time
+
+	labels  [numProfileMetrics]*Label
+	lines   *batch
+	sorted  [ProfileHistory]float64
+	elapsed float32
+}
+
+func newProfiler(world *World, hud *HUD) *Profiler {
+	p := &Profiler{
+		world:   world,
+		hud:     hud,
+		samples: make([]profileSample, ProfileCapacity),
+		lines:   newBatch(world.renderer.flat.material),
+	}
+	p.lines.mode = gl.LINES
+	for i := range p.labels {
+		x, y := p.graphOrigin(ProfileMetric(i))
+		p.labels[i] = hud.NewLabel(BottomLeft, x+profileGraphWidth+DefaultMargin, y)
+	}
+	debug.ReadGCStats(&p.gcStats)
+	p.numGC = p.gcStats.NumGC
+	p.gcSampled = time.Now()
+	return p
+}
+
+// graphOrigin returns the bottom left corner of the graph of the
+// given metric.
+func (p *Profiler) graphOrigin(m ProfileMetric) (float32, float32) {
+	return DefaultMargin, DefaultMargin + float32(numProfileMetrics-1-m)*(profileGraphHeight+profileGraphSpacing)
+}
+
+// measure records the duration of a part of the current frame.
+func (p *Profiler) measure(m ProfileMetric, d time.Duration) {
+	p.current[m] = float32(d.Seconds() * 1000)
+}
+
+// endFrame completes the sample of the current frame.
+func (p *Profiler) endFrame() {
+	if now := time.Now(); now.Sub(p.gcSampled) >= profileGCInterval {
+		p.gcSampled = now
+		p.current[ProfileGC] = float32(p.gcPauses().Seconds() * 1000)
+	}
+
+	contacts := 0
+	for _, arbiter := range p.world.space.Arbiters {
+		contacts += len(arbiter.Contacts)
+	}
+	p.current[ProfileBodies] = float32(len(p.world.space.Bodies))
+	p.current[ProfileContacts] = float32(contacts)
+	p.current[ProfileDrawCalls] = float32(drawCalls)
+
+	p.samples[p.frames%ProfileCapacity] = p.current
+	p.frames++
+	p.current = profileSample{}
+}
+
+// gcPauses returns the time spent in the GC pauses occurred since
+// the previous call. Pauses older than the last 256 are lost.
+func (p *Profiler) gcPauses() time.Duration {
+	debug.ReadGCStats(&p.gcStats)
+	n := p.gcStats.NumGC - p.numGC
+	p.numGC = p.gcStats.NumGC
+	if n > int64(len(p.gcStats.Pause)) {
+		n = int64(len(p.gcStats.Pause))
+	}
+	var pause time.Duration
+	for _, d := range p.gcStats.Pause[:n] {
+		pause += d
+	}
+	return pause
+}
+
+// firstFrame returns the oldest frame still kept.
+func (p *Profiler) firstFrame() int {
+	if p.frames > ProfileCapacity {
+		return p.frames - ProfileCapacity
+	}
+	return 0
+}
+
+// history returns the samples shown in the graphs.
+func (p *Profiler) history() []profileSample {
+	n := p.frames
+	if n > ProfileHistory {
+		n = ProfileHistory
+	}
+	for i := 0; i < n; i++ {
+		p.recent[i] = p.samples[(p.frames-n+i)%ProfileCapacity]
+	}
+	return p.recent[:n]
+}
+
+// Stats returns the min, average and 99th percentile of the given
+// metric over the last ProfileHistory frames.
+func (p *Profiler) Stats(m ProfileMetric) (min, avg, p99 float32) {
+	h := p.history()
+	if len(h) == 0 {
+		return 0, 0, 0
+	}
+	var sum float64
+	for i, s := range h {
+		p.sorted[i] = float64(s[m])
+		sum += float64(s[m])
+	}
+	sorted := p.sorted[:len(h)]
+	sort.Float64s(sorted)
+	return float32(sorted[0]), float32(sum / float64(len(h))), float32(sorted[(len(sorted)-1)*99/100])
+}
+
+// update refreshes the numbers once per profileRefreshInterval.
+func (p *Profiler) update(dt float32) {
+	p.elapsed += dt
+	if p.elapsed < profileRefreshInterval {
+		return
+	}
+	p.elapsed = 0
+	for i, l := range p.labels {
+		min, avg, p99 := p.Stats(ProfileMetric(i))
+		l.SetText(fmt.Sprintf("%s min %.2f avg %.2f p99 %.2f", profileMetricNames[i], min, avg, p99))
+	}
+}
+
+// draw draws the graphs. Durations are scaled to the frame budget,
+// counts to their maximum.
+func (p *Profiler) draw() {
+	h := p.history()
+	b := p.lines
+	b.begin()
+	for m := ProfileMetric(0); m < numProfileMetrics; m++ {
+		x, y := p.graphOrigin(m)
+		w, gh := float32(profileGraphWidth), float32(profileGraphHeight)
+		b.addLine(x, y, x+w, y, profileFrameColor)
+		b.addLine(x, y, x, y+gh, profileFrameColor)
+
+		scale := gh / profileFrameBudget
+		if m >= ProfileBodies {
+			max := float32(1)
+			for _, s := range h {
+				if s[m] > max {
+					max = s[m]
+				}
+			}
+			scale = gh / max
+		} else {
+			b.addLine(x, y+gh, x+w, y+gh, profileBudgetColor)
+		}
+
+		for i := 1; i < len(h); i++ {
+			y0, y1 := h[i-1][m]*scale, h[i][m]*scale
+			if y0 > gh {
+				y0 = gh
+			}
+			if y1 > gh {
+				y1 = gh
+			}
+			b.addLine(x+float32(i-1), y+y0, x+float32(i), y+y1, profileGraphColors[m])
+		}
+	}
+	p.hud.begin()
+	b.flush(&p.hud.projMatrix, &p.hud.viewMatrix)
+	p.hud.end()
+}
+
+// WriteCSV writes the samples of the last ProfileCapacity frames, one
+// frame per line.
+func (p *Profiler) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "frame")
+	for _, name := range profileMetricNames {
+		fmt.Fprintf(bw, ",%s", name)
+	}
+	fmt.Fprintln(bw)
+	for i := p.firstFrame(); i < p.frames; i++ {
+		fmt.Fprintf(bw, "%d", i)
+		for _, v := range p.samples[i%ProfileCapacity] {
+			fmt.Fprintf(bw, ",%.3f", v)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+func (p *Profiler) release() {
+	p.lines.release()
+}
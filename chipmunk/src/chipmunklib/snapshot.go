@@ -0,0 +1,107 @@
+package chipmunklib
+
+import (
+	"unsafe"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// BoxState is the state of a box in a snapshot. Positions are in
+// world coordinates.
+type BoxState struct {
+	Width, Height           float32
+	X, Y, Angle             float32
+	VX, VY, AngularVelocity float32
+	Mass, Elasticity        float32
+	Color                   [4]byte
+
+	// The name of the sprite of the box, empty if the box is
+	// drawn with a flat color
+	Sprite string `json:",omitempty"`
+
+	// The column, the row and the size of the grid of the part of
+	// the sprite drawn on a fragment
+	SpritePiece []int `json:",omitempty"`
+
+	BreakImpulse float32 `json:",omitempty"`
+	Fragments    int     `json:",omitempty"`
+}
+
+// Snapshot is the state of the boxes of a world at some point in
+// time. The ground, the terrains and the force fields of the level
+// don't change and aren't part of it.
+type Snapshot struct {
+	Boxes []BoxState
+}
+
+// Size returns an estimate of the memory used by the snapshot in
+// bytes.
+func (s *Snapshot) Size() int {
+	size := int(unsafe.Sizeof(*s)) + cap(s.Boxes)*int(unsafe.Sizeof(BoxState{}))
+	for _, b := range s.Boxes {
+		size += len(b.Sprite)
+	}
+	return size
+}
+
+// Snapshot returns the current state of the boxes.
+func (w *World) Snapshot() *Snapshot {
+	s := &Snapshot{Boxes: make([]BoxState, len(w.boxes))}
+	for i, box := range w.boxes {
+		body := box.physicsBody
+		pos, vel := body.Position(), body.Velocity()
+		state := &s.Boxes[i]
+		state.Width, state.Height = box.width, box.height
+		state.X, state.Y = float32(pos.X), float32(pos.Y)
+		state.Angle = float32(body.Angle())
+		state.VX, state.VY = float32(vel.X), float32(vel.Y)
+		state.AngularVelocity = body.AngularVelocity()
+		state.Mass = float32(body.Mass())
+		state.Elasticity = box.elasticity
+		state.Color = box.color
+		if box.sprite != nil {
+			state.Sprite = box.sprite.name
+			state.SpritePiece = box.sprite.piece
+		}
+		state.BreakImpulse = box.breakImpulse
+		state.Fragments = box.fragments
+	}
+	return s
+}
+
+// Restore replaces the boxes of the world with the boxes of the
+// snapshot.
+func (w *World) Restore(s *Snapshot) {
+	for i := len(w.boxes) - 1; i >= 0; i-- {
+		w.removeBox(w.boxes[i], i)
+	}
+	for i := range w.breaking {
+		w.breaking[i] = nil
+	}
+	w.breaking = w.breaking[:0]
+
+	for _, state := range s.Boxes {
+		box := w.boxPool.get(w, state.Width, state.Height)
+		body := box.physicsBody
+		body.SetMass(vect.Float(state.Mass))
+		body.SetMoment(box.physicsShape.Moment(state.Mass))
+		body.SetPosition(vect.Vect{vect.Float(state.X), vect.Float(state.Y)})
+		body.SetAngle(vect.Float(state.Angle))
+		body.SetVelocity(state.VX, state.VY)
+		body.SetAngularVelocity(state.AngularVelocity)
+		box.setElasticity(state.Elasticity)
+		if state.Sprite != "" {
+			if region, err := w.atlas.region(state.Sprite); err == nil {
+				if p := state.SpritePiece; len(p) == 4 {
+					region = region.fragment(p[0], p[1], p[2], p[3])
+				}
+				box.setSprite(region)
+			}
+		}
+		box.color = state.Color
+		if state.BreakImpulse > 0 {
+			box.SetBreakable(state.BreakImpulse, state.Fragments)
+		}
+		w.addBox(box)
+	}
+}
@@ -3,8 +3,12 @@ package chipmunklib
 import (
 	"encoding/xml"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
 
 	"github.com/lucasb-eyer/go-colorful"
+	"github.com/remogatto/gltext"
 	"github.com/remogatto/mandala"
 	"github.com/vova616/chipmunk"
 	"github.com/vova616/chipmunk/vect"
@@ -22,49 +26,110 @@ type svgRect struct {
 	Height    float32 `xml:"height,attr"`
 	X         float32 `xml:"x,attr"`
 	Y         float32 `xml:"y,attr"`
-	Transform string  `xml:"transform,attr"`
+	Transform string  `xml:"transform,attr,omitempty"`
+
+	// The name of the atlas region used to draw the box
+	Sprite string `xml:"sprite,attr,omitempty"`
+
+	// The impulse that shatters the box, if any, and the number
+	// of its fragments
+	Breakable float32 `xml:"breakable,attr,omitempty"`
+	Fragments int     `xml:"fragments,attr,omitempty"`
+
+	// If not empty the rectangle is the region of a wind or water
+	// force field, not a box
+	Field       string   `xml:"field,attr,omitempty"`
+	Force       string   `xml:"force,attr,omitempty"`
+	Density     *float32 `xml:"density,attr,omitempty"`
+	Drag        *float32 `xml:"drag,attr,omitempty"`
+	AngularDrag *float32 `xml:"angularDrag,attr,omitempty"`
+
+	// The physical properties of the box, if not the default
+	Mass       *float32 `xml:"mass,attr,omitempty"`
+	Elasticity *float32 `xml:"elasticity,attr,omitempty"`
+}
+
+// svgCircle is the region of a radial force field.
+type svgCircle struct {
+	CX       float32 `xml:"cx,attr"`
+	CY       float32 `xml:"cy,attr"`
+	R        float32 `xml:"r,attr"`
+	Field    string  `xml:"field,attr,omitempty"`
+	Strength float32 `xml:"strength,attr,omitempty"`
+}
+
+// svgPolyline is a terrain through the given points.
+type svgPolyline struct {
+	Points string `xml:"points,attr"`
+
+	// The image in the drawable folder tiled over the terrain
+	Texture string `xml:"texture,attr,omitempty"`
+}
+
+// svgImage is a terrain built from the heightmap image in the
+// drawable folder, filling the image's rectangle.
+type svgImage struct {
+	Href   string  `xml:"href,attr"`
+	X      float32 `xml:"x,attr"`
+	Y      float32 `xml:"y,attr"`
+	Width  float32 `xml:"width,attr"`
+	Height float32 `xml:"height,attr"`
+
+	// The image in the drawable folder tiled over the terrain
+	Texture string `xml:"texture,attr,omitempty"`
 }
 
 type svgGroup struct {
-	Transform string    `xml:"transform,attr"`
-	Rects     []svgRect `xml:"rect"`
-	Line      svgLine   `xml:"line"`
+	Transform string        `xml:"transform,attr,omitempty"`
+	Rects     []svgRect     `xml:"rect"`
+	Circles   []svgCircle   `xml:"circle"`
+	Lines     []svgLine     `xml:"line"`
+	Polylines []svgPolyline `xml:"polyline"`
+	Images    []svgImage    `xml:"image"`
 }
 
 type svgFile struct {
 	XMLName xml.Name   `xml:"svg"`
+	Xmlns   string     `xml:"xmlns,attr,omitempty"`
 	Width   float32    `xml:"width,attr"`
 	Height  float32    `xml:"height,attr"`
 	Groups  []svgGroup `xml:"g"`
 }
 
+// CreateFromSvg loads a level. Absolute filenames are read from the
+// filesystem, like the levels saved by the editor, others from the
+// resources.
 func (w *World) CreateFromSvg(filename string) {
 	var svg svgFile
 
-	responseCh := make(chan mandala.LoadResourceResponse)
-	mandala.ReadResource(filename, responseCh)
-	response := <-responseCh
-
-	if response.Error != nil {
-		mandala.Fatalf(response.Error.Error())
+	buf, err := readLevel(filename)
+	if err != nil {
+		mandala.Fatalf(err.Error())
 	}
-	buf := response.Buffer
 
-	err := xml.Unmarshal(buf, &svg)
+	err = xml.Unmarshal(buf, &svg)
 	if err != nil {
 		mandala.Fatalf(err.Error())
 	}
 
-	scaleX := float32(w.width) / svg.Width
-	scaleY := float32(w.height) / svg.Height
+	// The size of the SVG document is the virtual resolution of
+	// the world
+	w.setVirtualSize(int(svg.Width), int(svg.Height))
+	w.level = &svg
 
 	for _, group := range svg.Groups {
 		for _, rect := range group.Rects {
-			rX := (rect.X + rect.Width/2) * scaleX
-			rY := float32(w.height) - (rect.Y+rect.Height/2)*scaleY
-			rW := rect.Width * scaleX
-			rH := rect.Height * scaleY
-			box := newBox(w, rW, rH)
+			if rect.Field != "" {
+				f, err := newRectField(rect, svg.Height)
+				if err != nil {
+					mandala.Fatalf(err.Error())
+				}
+				w.AddForceField(f)
+				continue
+			}
+			rX := rect.X + rect.Width/2
+			rY := svg.Height - (rect.Y + rect.Height/2)
+			box := w.boxPool.get(w, rect.Width, rect.Height)
 			pos := vect.Vect{
 				vect.Float(rX),
 				vect.Float(rY),
@@ -78,19 +143,213 @@ func (w *World) CreateFromSvg(filename string) {
 				if err != nil {
 					mandala.Fatalf(err.Error())
 				}
-				box.physicsBody.SetAngle(90 / chipmunk.DegreeConst)
+				// SVG rotates clockwise around the center
+				// of the rect
+				box.physicsBody.SetAngle(vect.Float(-a / chipmunk.DegreeConst))
+			}
+
+			if rect.Mass != nil {
+				box.physicsBody.SetMass(vect.Float(*rect.Mass))
+				box.physicsBody.SetMoment(box.physicsShape.Moment(*rect.Mass))
+			}
+			if rect.Elasticity != nil {
+				box.setElasticity(*rect.Elasticity)
+			}
+
+			// A missing sprite falls back to a flat color, so
+			// that a level still loads without its atlas
+			var region *atlasRegion
+			if rect.Sprite != "" {
+				if region, err = w.atlas.region(rect.Sprite); err != nil {
+					mandala.Logf("Drawing the box with a flat color: %s\n", err.Error())
+				}
+			}
+			if region != nil {
+				box.setSprite(region)
+			} else {
+				box.setColor(colorful.HappyColor())
+			}
+
+			if rect.Breakable > 0 {
+				box.SetBreakable(rect.Breakable, rect.Fragments)
 			}
 
-			box.openglShape.SetColor(colorful.HappyColor())
 			w.addBox(box)
 		}
 	}
-	line := svg.Groups[0].Line
-	w.setGround(newGround(
-		w,
-		0,
-		float32(w.height)-float32(line.Y1*scaleY),
-		float32(w.width),
-		float32(w.height)-float32(line.Y2*scaleY),
-	))
+	for _, group := range svg.Groups {
+		for _, line := range group.Lines {
+			segment := newGround(line.X1, svg.Height-line.Y1, line.X2, svg.Height-line.Y2)
+			if w.ground == nil {
+				w.setGround(segment)
+			} else {
+				w.addSegment(segment)
+			}
+		}
+		for _, circle := range group.Circles {
+			if circle.Field == "" {
+				continue
+			}
+			if kind, err := parseFieldKind(circle.Field); err != nil || kind != RadialField {
+				mandala.Fatalf("circles can only be radial force fields, got %q", circle.Field)
+			}
+			w.AddForceField(NewRadialField(circle.CX, svg.Height-circle.CY, circle.R, circle.Strength))
+		}
+		for _, polyline := range group.Polylines {
+			points, err := parsePoints(polyline.Points)
+			if err != nil {
+				mandala.Fatalf(err.Error())
+			}
+			for i := 1; i < len(points); i += 2 {
+				points[i] = svg.Height - points[i]
+			}
+			terrain, err := newTerrain(w, points, 0, w.terrainTexture(polyline.Texture))
+			if err != nil {
+				mandala.Fatalf(err.Error())
+			}
+			w.addTerrain(terrain)
+		}
+		for _, image := range group.Images {
+			heightmap, err := readImage(filepath.Join("drawable", image.Href))
+			if err != nil {
+				mandala.Fatalf(err.Error())
+			}
+			terrain, err := newTerrainFromHeightmap(
+				w,
+				heightmap,
+				image.X,
+				svg.Height-(image.Y+image.Height),
+				image.Width,
+				image.Height,
+				w.terrainTexture(image.Texture),
+			)
+			if err != nil {
+				mandala.Fatalf(err.Error())
+			}
+			w.addTerrain(terrain)
+		}
+	}
+}
+
+func readLevel(filename string) ([]byte, error) {
+	if filepath.IsAbs(filename) {
+		return ioutil.ReadFile(filename)
+	}
+	return readResource(filename)
+}
+
+// SaveLevel writes the level in the format read by CreateFromSvg.
+// The boxes and the segments are written as they are now, the force
+// fields and the terrains as they were loaded.
+func (w *World) SaveLevel(out io.Writer) error {
+	svg := svgFile{
+		Xmlns:  "http://www.w3.org/2000/svg",
+		Width:  float32(w.width),
+		Height: float32(w.height),
+	}
+	if w.level != nil {
+		svg.Width, svg.Height = w.level.Width, w.level.Height
+		for _, group := range w.level.Groups {
+			g := group
+			g.Rects, g.Lines = nil, nil
+			for _, rect := range group.Rects {
+				if rect.Field != "" {
+					g.Rects = append(g.Rects, rect)
+				}
+			}
+			if len(g.Rects)+len(g.Circles)+len(g.Polylines)+len(g.Images) > 0 {
+				svg.Groups = append(svg.Groups, g)
+			}
+		}
+	}
+
+	var g svgGroup
+	height := svg.Height
+	for _, box := range w.boxes {
+		body := box.physicsBody
+		x, y := box.center()
+		rect := svgRect{
+			X:         x - box.width/2,
+			Y:         height - y - box.height/2,
+			Width:     box.width,
+			Height:    box.height,
+			Breakable: box.breakImpulse,
+			Fragments: box.fragments,
+		}
+		if angle := float32(body.Angle()); angle != 0 {
+			rect.Transform = fmt.Sprintf("rotate(%g %g,%g)", -angle*chipmunk.DegreeConst, x, height-y)
+		}
+		if box.sprite != nil {
+			rect.Sprite = box.sprite.name
+		}
+		if mass := float32(body.Mass()); mass != w.config.Box.Mass {
+			rect.Mass = &mass
+		}
+		if e := box.elasticity; e != w.config.Box.Elasticity {
+			rect.Elasticity = &e
+		}
+		g.Rects = append(g.Rects, rect)
+	}
+	for _, s := range w.segments {
+		g.Lines = append(g.Lines, svgLine{s.x1, height - s.y1, s.x2, height - s.y2})
+	}
+	svg.Groups = append(svg.Groups, g)
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", " ")
+	return enc.Encode(svg)
+}
+
+// newRectField returns the wind or water field in the rectangle of
+// a level with the given height.
+func newRectField(rect svgRect, height float32) (*ForceField, error) {
+	kind, err := parseFieldKind(rect.Field)
+	if err != nil {
+		return nil, err
+	}
+	minX, minY := rect.X, height-(rect.Y+rect.Height)
+	maxX, maxY := rect.X+rect.Width, height-rect.Y
+	switch kind {
+	case WindField:
+		force, err := parsePoints(rect.Force)
+		if err != nil || len(force) != 2 {
+			return nil, fmt.Errorf("the force of a wind field must be x,y, got %q", rect.Force)
+		}
+		// The y axis of SVG grows downward
+		return NewWindField(minX, minY, maxX, maxY, force[0], -force[1]), nil
+	case WaterField:
+		density, drag, angularDrag := float32(DefaultWaterDensity), float32(DefaultWaterDrag), float32(DefaultWaterAngularDrag)
+		if rect.Density != nil {
+			density = *rect.Density
+		}
+		if rect.Drag != nil {
+			drag = *rect.Drag
+		}
+		if rect.AngularDrag != nil {
+			angularDrag = *rect.AngularDrag
+		}
+		return NewWaterField(minX, minY, maxX, maxY, density, drag, angularDrag), nil
+	}
+	return nil, fmt.Errorf("rectangles can't be %q force fields", rect.Field)
+}
+
+// terrainTexture returns the tiled texture with the given name, nil
+// if name is empty. Textures are loaded once and shared by the
+// terrains.
+func (w *World) terrainTexture(name string) gltext.Texture {
+	if name == "" {
+		return nil
+	}
+	if texture, ok := w.tiles[name]; ok {
+		return texture
+	}
+	texture, err := w.loadTileTexture(name)
+	if err != nil {
+		mandala.Fatalf(err.Error())
+	}
+	w.tiles[name] = texture
+	return texture
 }
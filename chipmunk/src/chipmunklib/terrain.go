@@ -0,0 +1,198 @@
+package chipmunklib
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/remogatto/gltext"
+	gl "github.com/remogatto/opengles2"
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+var (
+	// The color of the terrains without a texture
+	terrainColor = rgba(color.RGBA{110, 85, 60, 255})
+)
+
+// Terrain is a static ground shaped as a polyline, like hills, pits
+// and bumpy floors. The physics shape is a chain of segments and the
+// region below the polyline is filled with a tiled texture or a flat
+// color.
+type Terrain struct {
+	physicsBody   *chipmunk.Body
+	physicsShapes []*chipmunk.Shape
+
+	// The control points as x, y pairs, from left to right
+	points []float32
+
+	// The y coordinate the terrain is filled down to
+	bottom float32
+
+	world *World
+	strip *batch
+
+	// The material owned by the terrain, nil if the terrain is
+	// drawn using the flat material of the world
+	material *material
+}
+
+// newTerrain creates a terrain through the given control points,
+// given as x, y pairs. If texture isn't nil it's tiled over the
+// terrain, one texel per pixel.
+func newTerrain(world *World, points []float32, bottom float32, texture gltext.Texture) (*Terrain, error) {
+	if len(points) < 4 || len(points)%2 != 0 {
+		return nil, fmt.Errorf("a terrain needs at least two control points, got %d coordinates", len(points))
+	}
+
+	t := &Terrain{
+		points:      points,
+		bottom:      bottom,
+		world:       world,
+		physicsBody: chipmunk.NewBodyStatic(),
+	}
+
+	// Chipmunk body
+
+	for i := 2; i < len(points); i += 2 {
+		shape := chipmunk.NewSegment(
+			vect.Vect{vect.Float(points[i-2]), vect.Float(points[i-1])},
+			vect.Vect{vect.Float(points[i]), vect.Float(points[i+1])},
+			GroundRadius,
+		)
+		t.physicsBody.AddShape(shape)
+		t.physicsShapes = append(t.physicsShapes, shape)
+	}
+
+	// OpenGL strip
+
+	if texture != nil {
+		t.material = newTexturedMaterial(spriteFS, spriteVS, texture)
+		t.strip = newBatch(t.material)
+	} else {
+		t.strip = newBatch(world.renderer.flat.material)
+	}
+	t.build(texture)
+
+	return t, nil
+}
+
+// newTerrainFromHeightmap creates a terrain filling the given region
+// of the world. Each column of the image is a control point, its
+// height is proportional to the average brightness of the column.
+func newTerrainFromHeightmap(world *World, img image.Image, x, y, width, height float32, texture gltext.Texture) (*Terrain, error) {
+	b := img.Bounds()
+	if b.Dx() < 2 || b.Dy() < 1 {
+		return nil, fmt.Errorf("a heightmap must be at least 2 pixels wide, got %dx%d", b.Dx(), b.Dy())
+	}
+	points := make([]float32, 0, 2*b.Dx())
+	for cx := b.Min.X; cx < b.Max.X; cx++ {
+		var sum float32
+		for cy := b.Min.Y; cy < b.Max.Y; cy++ {
+			sum += float32(color.GrayModel.Convert(img.At(cx, cy)).(color.Gray).Y) / 255
+		}
+		px := x + width*float32(cx-b.Min.X)/float32(b.Dx()-1)
+		py := y + height*sum/float32(b.Dy())
+		points = append(points, px, py)
+	}
+	return newTerrain(world, points, y, texture)
+}
+
+// build fills the strip with a quad for each segment, from the
+// segment down to the bottom of the terrain.
+func (t *Terrain) build(texture gltext.Texture) {
+	var tw, th float32
+	if texture != nil {
+		tb := texture.Bounds()
+		tw, th = float32(tb.Dx()), float32(tb.Dy())
+	}
+	vertex := func(x, y float32) {
+		if texture != nil {
+			t.strip.addTexturedVertex(x, y, x/tw, -y/th, rgba(color.White))
+		} else {
+			t.strip.addVertex(x, y, terrainColor)
+		}
+	}
+	p := t.points
+	t.strip.begin()
+	for i := 2; i < len(p); i += 2 {
+		x0, y0, x1, y1 := p[i-2], p[i-1], p[i], p[i+1]
+		vertex(x0, t.bottom)
+		vertex(x0, y0)
+		vertex(x1, y1)
+		vertex(x1, y1)
+		vertex(x1, t.bottom)
+		vertex(x0, t.bottom)
+	}
+}
+
+func (t *Terrain) draw() {
+	t.strip.flush(&t.world.projMatrix, &t.world.viewMatrix)
+}
+
+func (t *Terrain) release() {
+	t.strip.release()
+	if t.material != nil {
+		t.material.release()
+	}
+}
+
+// parsePoints parses the points attribute of a SVG polyline, a list
+// of coordinates separated by commas or spaces.
+func parsePoints(s string) ([]float32, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	points := make([]float32, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid polyline point %q", f)
+		}
+		points = append(points, float32(v))
+	}
+	return points, nil
+}
+
+// readImage decodes a PNG image in the resources.
+func readImage(filename string) (image.Image, error) {
+	buf, err := readResource(filename)
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewBuffer(buf))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return img, nil
+}
+
+// loadTileTexture uploads a PNG image in the drawable folder as a
+// repeating texture. The size of the image must be a power of two.
+func (w *World) loadTileTexture(name string) (gltext.Texture, error) {
+	img, err := readImage(filepath.Join("drawable", name))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	if !isPowerOfTwo(b.Dx()) || !isPowerOfTwo(b.Dy()) {
+		return nil, fmt.Errorf("%s: the size of a tiled texture must be a power of two, got %dx%d", name, b.Dx(), b.Dy())
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	texture := w.UploadRGBAImage(rgba)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	return texture, nil
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
@@ -9,16 +9,15 @@ import (
 	"github.com/lucasb-eyer/go-colorful"
 	"github.com/remogatto/gltext"
 	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/i18n"
 	"github.com/remogatto/mathgl"
 	gl "github.com/remogatto/opengles2"
-	"github.com/remogatto/shaders"
-	"github.com/remogatto/shapes"
 	"github.com/vova616/chipmunk"
 	"github.com/vova616/chipmunk/vect"
 )
 
 const (
-	// Y-component for gravity
+	// Y-component for the default gravity
 	Gravity = -900
 )
 
@@ -46,29 +45,70 @@ func (t *texture) Id() uint32 {
 }
 
 type World struct {
-	width, height                 int
+	// The virtual resolution of the world
+	width, height int
+
+	// The size of the window and the letterboxed region, in
+	// window coordinates, the world is drawn into
+	windowWidth, windowHeight int
+	viewport                  image.Rectangle
+	scale                     float32
+
+	config *Config
+
 	projMatrix                    mathgl.Mat4f
 	viewMatrix                    mathgl.Mat4f
 	space                         *chipmunk.Space
 	boxes                         []*Box
 	ground                        *Ground
+	segments                      []*Ground
+	level                         *svgFile
+	terrains                      []*Terrain
+	fields                        []*ForceField
+	fieldBatch                    *batch
+	segmentBatch                  *batch
+	clip                          clipBuffer
 	explosionPlayer, impactPlayer *mandala.AudioPlayer
 	explosionBuffer, impactBuffer []byte
-	boxProgramShader              shaders.Program
-	segmentProgramShader          shaders.Program
+	renderer                      *batchRenderer
+	atlas                         *textureAtlas
+	particles                     *particleSystem
 	font                          *gltext.Font
+	messages                      *i18n.Catalog
+	breakPlayer                   *mandala.AudioPlayer
+	breakBuffer                   []byte
+	breaking                      []*Box
+	grabbed                       *Box
+	boxPool                       *boxPool
+	textures                      []*texture
+	tiles                         map[string]gltext.Texture
+	camera                        *Camera
+	debug                         *DebugDraw
+	debugLayers                   DebugLayer
 }
 
-func NewWorld(width, height int) *World {
+// NewWorld creates a world for a window of the given size. The
+// virtual resolution of the world is the size of the window until a
+// level is loaded.
+func NewWorld(width, height int, config *Config) *World {
 	world := &World{
-		width:      width,
-		height:     height,
-		projMatrix: mathgl.Ortho2D(0, float32(width), 0, float32(height)),
-		viewMatrix: mathgl.Ident4f(),
-		space:      chipmunk.NewSpace(),
+		config:       config,
+		windowWidth:  width,
+		windowHeight: height,
+		viewMatrix:   mathgl.Ident4f(),
+		space:        chipmunk.NewSpace(),
+		boxPool:      newBoxPool(),
+		tiles:        make(map[string]gltext.Texture),
+		breaking:     make([]*Box, 0, maxBreaksPerStep),
+		camera:       NewCamera(width, height),
 	}
+	world.camera.FollowSpeed = config.Camera.FollowSpeed
+	world.debugLayers = DebugAll
 
-	world.space.Gravity = vect.Vect{0, Gravity}
+	world.setVirtualSize(width, height)
+
+	world.space.Gravity = vect.Vect{vect.Float(config.Physics.Gravity[0]), vect.Float(config.Physics.Gravity[1])}
+	world.space.Iterations = config.Physics.Iterations
 
 	// Initialize the audio players
 	var err error
@@ -82,6 +122,15 @@ func NewWorld(width, height int) *World {
 		mandala.Fatalf("%s\n", err.Error())
 	}
 
+	world.breakPlayer, err = mandala.NewAudioPlayer()
+	if err != nil {
+		mandala.Fatalf("%s\n", err.Error())
+	}
+
+	setVolume(world.explosionPlayer, config.Audio.Explosion)
+	setVolume(world.impactPlayer, config.Audio.Impact)
+	setVolume(world.breakPlayer, config.Audio.Break)
+
 	// Read the PCM audio samples
 
 	responseCh := make(chan mandala.LoadResourceResponse)
@@ -102,10 +151,35 @@ func NewWorld(width, height int) *World {
 	}
 	world.impactBuffer = response.Buffer
 
-	// Compile the shaders
+	// The break sound is optional, the impact sound is played if
+	// it's missing.
+	world.breakBuffer, err = readResource(BreakSoundFilename)
+	if err != nil {
+		mandala.Logf("No break sound loaded: %s\n", err.Error())
+		world.breakBuffer = world.impactBuffer
+	}
+
+	// Pack the sprites in the atlas. Sprites are optional, the
+	// world is drawn using flat colors if the manifest is
+	// missing.
+	world.atlas, err = loadAtlas(world, AtlasManifest)
+	if err != nil {
+		mandala.Logf("No sprites loaded: %s\n", err.Error())
+		world.atlas = &textureAtlas{regions: make(map[string]*atlasRegion)}
+	}
+
+	// Create the batch renderer for the boxes
+	world.renderer = newBatchRenderer(world)
+
+	// Create the batch drawing the force fields
+	world.fieldBatch = newBatch(world.renderer.flat.material)
+
+	// Create the batch drawing the static segments
+	world.segmentBatch = newBatch(world.renderer.flat.material)
+	world.segmentBatch.mode = gl.LINES
 
-	world.boxProgramShader = shaders.NewProgram(shapes.DefaultBoxFS, shapes.DefaultBoxVS)
-	world.segmentProgramShader = shaders.NewProgram(shapes.DefaultSegmentFS, shapes.DefaultSegmentVS)
+	// Create the particle system for the visual effects
+	world.particles = newParticleSystem(world)
 
 	// Load the font
 	responseCh = make(chan mandala.LoadResourceResponse)
@@ -117,7 +191,14 @@ func NewWorld(width, height int) *World {
 		panic(err)
 	}
 
-	world.font, err = gltext.LoadTruetype(bytes.NewBuffer(fontBuffer), world, 12, 32, 127, gltext.LeftToRight)
+	// Include the glyphs of the messages of the locale, which
+	// always fit in the font
+	world.messages = loadMessages(config.Locale)
+	low, high, err := world.messages.GlyphRange()
+	if err != nil {
+		panic(err)
+	}
+	world.font, err = gltext.LoadTruetype(bytes.NewBuffer(fontBuffer), world, 12, low, high, gltext.LeftToRight)
 	if err != nil {
 		panic(err)
 	}
@@ -125,6 +206,17 @@ func NewWorld(width, height int) *World {
 	return world
 }
 
+// setVolume sets the volume of the player, from 0 to 1.
+func setVolume(player *mandala.AudioPlayer, volume float32) {
+	max, err := player.GetMaxVolumeLevel()
+	if err == nil {
+		err = player.SetVolumeLevel(volumeLevel(volume, max))
+	}
+	if err != nil {
+		mandala.Logf("Can't set the volume: %s\n", err.Error())
+	}
+}
+
 func (w *World) Projection() mathgl.Mat4f {
 	return w.projMatrix
 }
@@ -133,6 +225,120 @@ func (w *World) View() mathgl.Mat4f {
 	return w.viewMatrix
 }
 
+// setVirtualSize sets the resolution of the world. The world is
+// drawn scaled to fit the window.
+func (w *World) setVirtualSize(width, height int) {
+	w.width, w.height = width, height
+	w.projMatrix = mathgl.Ortho2D(0, float32(width), 0, float32(height))
+	w.camera.SetViewport(width, height)
+	w.camera.SetBounds(0, 0, float32(width), float32(height))
+	w.camera.MoveTo(float32(width)/2, float32(height)/2)
+	w.Resize(w.windowWidth, w.windowHeight)
+}
+
+// Resize adapts the world to a window of the given size, i.e. after
+// an orientation change. The world is uniformly scaled to fit the
+// window and centered, leaving black bars on the sides if the aspect
+// ratios don't match.
+func (w *World) Resize(width, height int) {
+	w.windowWidth, w.windowHeight = width, height
+
+	w.scale = float32(width) / float32(w.width)
+	if s := float32(height) / float32(w.height); s < w.scale {
+		w.scale = s
+	}
+	vw := int(float32(w.width) * w.scale)
+	vh := int(float32(w.height) * w.scale)
+	x, y := (width-vw)/2, (height-vh)/2
+	w.viewport = image.Rect(x, y, x+vw, y+vh)
+	w.applyViewport()
+}
+
+// applyViewport restricts the drawing to the letterboxed region.
+func (w *World) applyViewport() {
+	r := w.viewport
+	gl.Viewport(int32(r.Min.X), int32(r.Min.Y), gl.Sizei(r.Dx()), gl.Sizei(r.Dy()))
+	gl.Scissor(int32(r.Min.X), int32(r.Min.Y), gl.Sizei(r.Dx()), gl.Sizei(r.Dy()))
+	gl.Enable(gl.SCISSOR_TEST)
+}
+
+// clear clears the whole window, bars included, and restricts the
+// drawing to the letterboxed region.
+func (w *World) clear() {
+	gl.Disable(gl.SCISSOR_TEST)
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+	gl.Enable(gl.SCISSOR_TEST)
+}
+
+// windowToScreen converts window coordinates to the coordinates of
+// the scaled screen seen by the camera. Both have y growing
+// downward.
+func (w *World) windowToScreen(x, y float32) (float32, float32) {
+	top := float32(w.windowHeight - w.viewport.Max.Y)
+	return (x - float32(w.viewport.Min.X)) / w.scale, (y - top) / w.scale
+}
+
+// screenToWorld converts window coordinates, with y growing
+// downward, to world coordinates.
+func (w *World) screenToWorld(x, y float32) (float32, float32) {
+	return w.camera.ScreenToWorld(w.windowToScreen(x, y))
+}
+
+// Pan moves the camera by the given amount of window pixels.
+func (w *World) Pan(dx, dy float32) {
+	// The player takes control of the camera
+	w.camera.Follow(nil)
+	w.camera.Pan(dx/w.scale, dy/w.scale)
+}
+
+// Zoom multiplies the zoom of the camera by factor keeping the world
+// point under the given window coordinates still.
+func (w *World) Zoom(factor, x, y float32) {
+	x, y = w.windowToScreen(x, y)
+	w.camera.ZoomAt(factor, x, y)
+}
+
+// EnableDebugDraw starts drawing the physics debug overlay on top
+// of the scene and returns it.
+func (w *World) EnableDebugDraw() *DebugDraw {
+	if w.debug == nil {
+		w.debug = newDebugDraw(w, w.debugLayers)
+	}
+	return w.debug
+}
+
+// DisableDebugDraw stops drawing the physics debug overlay.
+func (w *World) DisableDebugDraw() {
+	if w.debug != nil {
+		// Keep the layers for the next time
+		w.debugLayers = w.debug.Layers
+		w.debug.release()
+		w.debug = nil
+	}
+}
+
+// DebugDraw returns the physics debug overlay, nil if it's not
+// enabled.
+func (w *World) DebugDraw() *DebugDraw {
+	return w.debug
+}
+
+// Messages returns the catalog of the text shown.
+func (w *World) Messages() *i18n.Catalog {
+	return w.messages
+}
+
+// Camera returns the camera looking at the world.
+func (w *World) Camera() *Camera {
+	return w.camera
+}
+
+// updateCamera moves the camera and updates the view matrix.
+func (w *World) updateCamera(dt float32) {
+	w.camera.update(dt)
+	w.viewMatrix = w.camera.View()
+}
+
 func (w *World) UploadRGBAImage(img *image.RGBA) gltext.Texture {
 	t := new(texture)
 	ib := img.Bounds()
@@ -142,16 +348,31 @@ func (w *World) UploadRGBAImage(img *image.RGBA) gltext.Texture {
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
 	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, gl.Sizei(ib.Dx()), gl.Sizei(ib.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Void(&img.Pix[0]))
+	w.textures = append(w.textures, t)
 	return t
 }
 
+// DeleteTexture releases a texture uploaded by UploadRGBAImage.
+func (w *World) DeleteTexture(t gltext.Texture) {
+	for i, wt := range w.textures {
+		if gltext.Texture(wt) != t {
+			continue
+		}
+		gl.DeleteTextures(1, &wt.id)
+		copy(w.textures[i:], w.textures[i+1:])
+		w.textures[len(w.textures)-1] = nil
+		w.textures = w.textures[:len(w.textures)-1]
+		return
+	}
+}
+
 func (w *World) CreateFromString(s []string) {
 	// Number of boxes of both axes
 	nY := len(s)
 	nX := len(s[0])
 
 	// Y coord of the ground
-	_, groundY := w.ground.openglShape.Center()
+	groundY := (w.ground.y1 + w.ground.y2) / 2
 	maxY := float32(w.height)
 	maxHeight := float32(maxY) - groundY
 
@@ -171,14 +392,14 @@ func (w *World) CreateFromString(s []string) {
 	for y, line := range s {
 		for x, b := range line {
 			if b == '+' {
-				box := newBox(w, boxW, boxH)
+				box := w.boxPool.get(w, boxW, boxH)
 				pos := vect.Vect{
 					vect.Float(float32(x) * boxW),
 					vect.Float(startY - (float32(y) * boxH)),
 				}
 				box.physicsBody.SetPosition(pos)
 				box.physicsBody.SetAngle(0)
-				box.openglShape.SetColor(colorful.HappyColor())
+				box.setColor(colorful.HappyColor())
 				w.addBox(box)
 			}
 		}
@@ -188,27 +409,59 @@ func (w *World) CreateFromString(s []string) {
 func (w *World) addBox(box *Box) *Box {
 	box.world = w
 	w.space.AddBody(box.physicsBody)
-	box.openglShape.AttachToWorld(w)
 	w.boxes = append(w.boxes, box)
-	box.physicsBody.UserData = impactUserData{w.impactPlayer, w.impactBuffer}
+	// Assigning a pointer to the body's UserData doesn't
+	// allocate.
+	box.physicsBody.UserData = box
 	return box
 }
 
-func (w *World) dropBox(x, y float32) {
-	box := newBox(w, 20, 20)
+// DropBox adds a spinning box at the given screen coordinates.
+func (w *World) DropBox(x, y float32) {
+	x, y = w.screenToWorld(x, y)
+	box := w.SpawnBox(x, y, 20, 20)
 	box.physicsBody.SetMass(10)
 	box.physicsBody.AddAngularVelocity(10)
 	box.physicsBody.SetAngle(vect.Float(2 * math.Pi * chipmunk.DegreeConst * rand.Float32()))
-	box.physicsBody.SetPosition(vect.Vect{vect.Float(x), vect.Float(float32(w.height) - y)})
-	w.addBox(box)
+	w.follow(box)
+}
+
+// follow makes the camera follow the box, if configured.
+func (w *World) follow(box *Box) {
+	if w.config.Camera.Follow {
+		w.camera.Follow(box.physicsBody)
+	}
+}
+
+// SpawnBox adds a box of the given size at the given world
+// coordinates.
+func (w *World) SpawnBox(x, y, width, height float32) *Box {
+	box := w.boxPool.get(w, width, height)
+	box.physicsBody.SetPosition(vect.Vect{vect.Float(x), vect.Float(y)})
+	return w.addBox(box)
 }
 
-// Explosion produce an explosion at the given coordinates.
+// Gravity returns the gravity vector in pixels/s².
+func (w *World) Gravity() (float32, float32) {
+	return float32(w.space.Gravity.X), float32(w.space.Gravity.Y)
+}
+
+// SetGravity sets the gravity vector in pixels/s².
+func (w *World) SetGravity(x, y float32) {
+	w.space.Gravity = vect.Vect{vect.Float(x), vect.Float(y)}
+}
+
+// Explosion produce an explosion at the given screen coordinates.
 func (w *World) Explosion(x, y float32) {
+	w.ExplosionAt(w.screenToWorld(x, y))
+}
+
+// ExplosionAt produce an explosion at the given world coordinates.
+func (w *World) ExplosionAt(x, y float32) {
 	w.explosionPlayer.Play(w.explosionBuffer, nil)
-	y = float32(w.height) - y
+	w.particles.emit("explosion", x, y)
 	for _, box := range w.boxes {
-		cx, cy := box.openglShape.Center()
+		cx, cy := box.center()
 		force := vect.Sub(
 			vect.Vect{vect.Float(cx / float32(w.width)), vect.Float(cy / float32(w.height))},
 			vect.Vect{vect.Float(x / float32(w.width)), vect.Float(y / float32(w.height))},
@@ -219,41 +472,234 @@ func (w *World) Explosion(x, y float32) {
 	}
 }
 
-// Remove removes the box at the given coordinates.
-func (w *World) Remove(x, y float32) int {
-	y = float32(w.height) - y
+// boxAt returns the index of the box at the given screen
+// coordinates, -1 if there's none.
+func (w *World) boxAt(x, y float32) int {
+	return w.boxAtWorld(w.screenToWorld(x, y))
+}
+
+// boxAtWorld returns the index of the box at the given world
+// coordinates, -1 if there's none.
+func (w *World) boxAtWorld(x, y float32) int {
 	for id, box := range w.boxes {
-		cx, cy := box.openglShape.Center()
+		cx, cy := box.center()
 		distance := vect.Sub(
 			vect.Vect{vect.Float(cx), vect.Float(cy)},
 			vect.Vect{vect.Float(x), vect.Float(y)},
 		)
-		if distance.LengthSqr() < vect.Float(BoxSize) {
-			w.removeBox(box, id)
+		r := vect.Float(w.config.Box.PickRadius)
+		if distance.LengthSqr() < r*r {
 			return id
 		}
 	}
 	return -1
 }
 
+// Remove removes the box at the given screen coordinates.
+func (w *World) Remove(x, y float32) int {
+	id := w.boxAt(x, y)
+	if id >= 0 {
+		w.removeBox(w.boxes[id], id)
+	}
+	return id
+}
+
+// Grab starts dragging the box at the given screen coordinates. It
+// returns false if there's no box there.
+func (w *World) Grab(x, y float32) bool {
+	id := w.boxAt(x, y)
+	if id < 0 {
+		return false
+	}
+	w.grabbed = w.boxes[id]
+	return true
+}
+
+// DragTo moves the box grabbed to the given screen coordinates.
+func (w *World) DragTo(x, y float32) {
+	if w.grabbed == nil {
+		return
+	}
+	x, y = w.screenToWorld(x, y)
+	body := w.grabbed.physicsBody
+	body.SetPosition(vect.Vect{vect.Float(x), vect.Float(y)})
+	body.SetVelocity(0, 0)
+	body.SetAngularVelocity(0)
+}
+
+// Release stops dragging the box grabbed. The camera follows the
+// box thrown, if configured.
+func (w *World) Release() {
+	if w.grabbed != nil {
+		w.follow(w.grabbed)
+	}
+	w.grabbed = nil
+}
+
+// indexOf returns the index of the box in the world, -1 if it was
+// removed.
+func (w *World) indexOf(box *Box) int {
+	for i, b := range w.boxes {
+		if b == box {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeBox removes the box from the space and gives it back to the
+// pool.
 func (w *World) removeBox(box *Box, index int) {
+	if box == w.grabbed {
+		w.grabbed = nil
+	}
+	if box.physicsBody == w.camera.Following() {
+		w.camera.Follow(nil)
+	}
 	box.physicsBody.UserData = nil
 	w.space.RemoveBody(box.physicsBody)
-	w.boxes = append(w.boxes[:index], w.boxes[index+1:]...)
+	last := len(w.boxes) - 1
+	copy(w.boxes[index:], w.boxes[index+1:])
+	w.boxes[last] = nil
+	w.boxes = w.boxes[:last]
+	w.boxPool.put(box)
+}
+
+// step advances the simulation by dt seconds, damping the velocity
+// of the boxes and applying the force fields.
+func (w *World) step(dt float32) {
+	if d := w.config.Physics.Damping; d < 1 {
+		k := float32(math.Pow(float64(d), float64(dt)))
+		for _, box := range w.boxes {
+			v := box.physicsBody.Velocity()
+			box.physicsBody.SetVelocity(float32(v.X)*k, float32(v.Y)*k)
+			box.physicsBody.SetAngularVelocity(float32(box.physicsBody.AngularVelocity()) * k)
+		}
+	}
+	for _, f := range w.fields {
+		for _, box := range w.boxes {
+			f.apply(box, w.space.Gravity, &w.clip, dt)
+		}
+	}
+	w.space.Step(vect.Float(dt))
+	w.shatterBoxes()
+}
+
+// AddForceField adds a force field to the world.
+func (w *World) AddForceField(f *ForceField) *ForceField {
+	w.fields = append(w.fields, f)
+	w.buildFields()
+	return f
+}
+
+// ForceFields returns the force fields in the world.
+func (w *World) ForceFields() []*ForceField {
+	return w.fields
+}
+
+// buildFields fills the batch drawing the force fields. Fields don't
+// move, the batch is built once and drawn at each frame.
+func (w *World) buildFields() {
+	w.fieldBatch.begin()
+	for _, f := range w.fields {
+		f.draw(w.fieldBatch)
+	}
 }
 
 func (w *World) setGround(ground *Ground) *Ground {
-	w.space.AddBody(ground.physicsBody)
-	ground.openglShape.AttachToWorld(w)
+	w.addSegment(ground)
 	w.ground = ground
 	return ground
 }
 
+// addSegment adds a static segment to the level.
+func (w *World) addSegment(segment *Ground) *Ground {
+	w.space.AddBody(segment.physicsBody)
+	w.segments = append(w.segments, segment)
+	return segment
+}
+
+// removeSegment removes a static segment from the level.
+func (w *World) removeSegment(segment *Ground) {
+	for i, s := range w.segments {
+		if s == segment {
+			w.space.RemoveBody(segment.physicsBody)
+			copy(w.segments[i:], w.segments[i+1:])
+			w.segments[len(w.segments)-1] = nil
+			w.segments = w.segments[:len(w.segments)-1]
+			break
+		}
+	}
+	if segment == w.ground {
+		w.ground = nil
+		if len(w.segments) > 0 {
+			w.ground = w.segments[0]
+		}
+	}
+}
+
+// drawSegments draws the static segments of the level.
+func (w *World) drawSegments() {
+	w.segmentBatch.begin()
+	for _, segment := range w.segments {
+		segment.draw(w.segmentBatch)
+	}
+	w.segmentBatch.flush(&w.projMatrix, &w.viewMatrix)
+}
+
+func (w *World) addTerrain(terrain *Terrain) *Terrain {
+	w.space.AddBody(terrain.physicsBody)
+	w.terrains = append(w.terrains, terrain)
+	return terrain
+}
+
+// Reset removes the bodies of the level and loads it again.
+func (w *World) Reset() {
+	w.clearLevel()
+	w.CreateFromSvg(w.config.Level)
+}
+
+// clearLevel removes the boxes, the segments, the terrains and the
+// force fields.
+func (w *World) clearLevel() {
+	for i := len(w.boxes) - 1; i >= 0; i-- {
+		w.removeBox(w.boxes[i], i)
+	}
+	for i := range w.breaking {
+		w.breaking[i] = nil
+	}
+	w.breaking = w.breaking[:0]
+	for _, segment := range w.segments {
+		w.space.RemoveBody(segment.physicsBody)
+	}
+	w.segments = nil
+	w.ground = nil
+	for _, t := range w.terrains {
+		w.space.RemoveBody(t.physicsBody)
+		t.release()
+	}
+	w.terrains = nil
+	w.fields = nil
+	w.buildFields()
+}
+
+// Destroy releases the audio players, the boxes and the OpenGL
+// resources owned by the world.
 func (w *World) Destroy() {
 	w.impactPlayer.Destroy()
 	w.explosionPlayer.Destroy()
-	for i := 0; i < len(w.boxes); i++ {
-		w.removeBox(w.boxes[i], i)
-		i--
+	w.breakPlayer.Destroy()
+	w.clearLevel()
+	w.boxPool.drain()
+	for _, t := range w.textures {
+		gl.DeleteTextures(1, &t.id)
+	}
+	w.textures = nil
+	w.fieldBatch.release()
+	w.segmentBatch.release()
+	w.renderer.release()
+	w.particles.release()
+	if w.debug != nil {
+		w.debug.release()
 	}
 }
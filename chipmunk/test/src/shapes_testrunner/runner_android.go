@@ -7,14 +7,11 @@ import (
 
 	"testlib"
 	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/storage"
 	mandalatest "github.com/remogatto/mandala/test/src/testlib"
 	"github.com/remogatto/prettytest"
 )
 
-const (
-	outputPath = "/data/data/net.mandala.test.shapes_testrunner/files/"
-)
-
 type T struct{}
 
 func (t T) Fail() {}
@@ -26,6 +23,12 @@ func main() {
 
 	mandala.Verbose = true
 
+	// The files directory of the package
+	outputPath, err := storage.Dir("shapes_testrunner")
+	if err != nil {
+		mandala.Fatalf("%s\n", err.Error())
+	}
+
 	go prettytest.RunWithFormatter(
 		t,
 		new(mandalatest.TDDFormatter),
@@ -262,6 +262,12 @@ func saveExpAct(outputPath string, filename string, exp image.Image, act image.I
 	dstRect = image.Rectangle{dp, dp.Add(expRect.Size())}
 	draw.DrawMask(dstImage, dstRect, exp, image.ZP, &image.Uniform{color.RGBA{A: 64}}, image.ZP, draw.Over)
 
+	saveImage(outputPath, filename, dstImage)
+}
+
+// saveImage saves an image as a PNG file in the output path,
+// creating it if needed.
+func saveImage(outputPath string, filename string, img image.Image) {
 	_, err := os.Stat(outputPath)
 	if os.IsNotExist(err) {
 		// Create the output dir
@@ -280,7 +286,7 @@ func saveExpAct(outputPath string, filename string, exp image.Image, act image.I
 	}
 	defer file.Close()
 
-	err = png.Encode(file, dstImage)
+	err = png.Encode(file, img)
 	if err != nil {
 		panic(err)
 	}
@@ -3,8 +3,11 @@ package testlib
 import (
 	"fmt"
 	"math/rand"
+	"testing"
+	"time"
 
 	"github.com/remogatto/imagetest"
+	"github.com/remogatto/mandala"
 	lib "github.com/remogatto/mandala-examples/chipmunk/src/chipmunklib"
 	"github.com/remogatto/mandala/test/src/testlib"
 )
@@ -23,17 +26,127 @@ func (t *TestSuite) TestRenderWorld() {
 		// state
 		rand.Seed(1234)
 
-		state := lib.NewGameState(t.renderState.window)
+		state := lib.NewGameState(t.renderState.window, lib.DefaultConfig())
 		state.Draw()
 		t.testDraw <- testlib.Screenshot(t.renderState.window)
 		t.renderState.window.SwapBuffers()
 	}
-	distance, exp, act, err := testlib.TestImage(filename, <-t.testDraw, imagetest.Center)
+	screenshot := <-t.testDraw
+	distance, exp, act, err := testlib.TestImage(filename, screenshot, imagetest.Center)
 	if err != nil {
 		panic(err)
 	}
 	t.True(distance < distanceThreshold, distanceError(distance, filename))
 	if t.Failed() {
 		saveExpAct(t.outputPath, "failed_"+filename, exp, act)
+		// The new expected image, if the change is wanted
+		saveImage(t.outputPath, "actual_"+filename, screenshot)
 	}
 }
+
+// The allocations per frame tolerated. Measured with the world at
+// rest, a frame shouldn't allocate; the bound leaves room for the
+// rare growth of a pool.
+const maxFrameAllocs = 1
+
+// The frames simulated at most waiting for the boxes of the level to
+// settle and the particles of their impacts to die.
+const settleFrames = 20 * FramesPerSecond
+
+func (t *TestSuite) TestFrameAllocations() {
+	result := make(chan testing.BenchmarkResult)
+	t.rlControl.drawFunc <- func() {
+		rand.Seed(1234)
+
+		state := lib.NewGameState(t.renderState.window, lib.DefaultConfig())
+		defer state.Destroy()
+
+		// Warm up the pools and wait for the impacts to end:
+		// the particles they emit and the box pool may
+		// allocate. Fps is never updated here, so the HUD
+		// text doesn't change.
+		for i := 0; i < FramesPerSecond; i++ {
+			state.Draw()
+		}
+		for i := 0; i < settleFrames && state.Stats().Particles > 0; i++ {
+			state.Draw()
+		}
+
+		result <- testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				state.Draw()
+			}
+		})
+	}
+	r := <-result
+	mandala.Logf("Frame benchmark: %s %s", r.String(), r.MemString())
+	t.True(r.AllocsPerOp() <= maxFrameAllocs, fmt.Sprintf("Drawing a frame allocates %d times, more than %d", r.AllocsPerOp(), maxFrameAllocs))
+}
+
+const (
+	// The boxes added by the stress test and the frame rate they
+	// must be simulated and drawn at
+	stressBoxes = 5000
+	stressFps   = 60
+
+	// The columns of the grid the boxes are spawned in
+	stressColumns = 100
+)
+
+func (t *TestSuite) TestStress() {
+	type result struct {
+		frameTime                time.Duration
+		drawCalls, baseDrawCalls int
+		stats                    lib.FrameStats
+	}
+	results := make(chan result)
+	t.rlControl.drawFunc <- func() {
+		rand.Seed(1234)
+
+		config := lib.DefaultConfig()
+		state := lib.NewGameState(t.renderState.window, config)
+		defer state.Destroy()
+		state.Draw()
+		base := state.Stats().DrawCalls
+
+		// Stack the boxes in a grid as wide as the window, so
+		// that none is culled
+		width, _ := t.renderState.window.GetSize()
+		cell := float32(width) / stressColumns
+		for i := 0; i < stressBoxes; i++ {
+			x := (float32(i%stressColumns) + 0.5) * cell
+			y := float32(100) + float32(i/stressColumns)*cell
+			state.World.SpawnBox(x, y, cell*0.8, cell*0.8)
+		}
+
+		// Warm up, then measure the time of the frames, swap
+		// included
+		for i := 0; i < stressFps; i++ {
+			state.Draw()
+		}
+		frames := 2 * stressFps
+		var r result
+		start := time.Now()
+		for i := 0; i < frames; i++ {
+			state.Draw()
+			state.SwapBuffers()
+			if calls := state.Stats().DrawCalls; calls > r.drawCalls {
+				r.drawCalls = calls
+			}
+		}
+		r.frameTime = time.Since(start) / time.Duration(frames)
+		r.baseDrawCalls = base
+		r.stats = state.Stats()
+		results <- r
+	}
+	r := <-results
+	mandala.Logf("Stress: %d bodies, %v per frame, step %.1fms, draw %.1fms, %d draw calls (%d without the boxes)",
+		r.stats.Bodies, r.frameTime, r.stats.StepTime, r.stats.DrawTime, r.drawCalls, r.baseDrawCalls)
+
+	budget := time.Second / stressFps
+	t.True(r.frameTime < budget, fmt.Sprintf("A frame with %d boxes takes %v, more than %v", stressBoxes, r.frameTime, budget))
+	// The boxes are batched: they add at most the call of the
+	// flat batch, if the level has only sprites
+	t.True(r.drawCalls <= r.baseDrawCalls+1, fmt.Sprintf("%d boxes take %d draw calls", stressBoxes, r.drawCalls-r.baseDrawCalls))
+}
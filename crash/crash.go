@@ -0,0 +1,172 @@
+// Package crash writes a report when an example panics, so that the
+// context of the crash isn't lost, and finds it again at the next
+// start.
+//
+// A report holds the reason of the panic, the stack trace, the last
+// lines logged, the version of the application, the device and a
+// snapshot of the state of the application. It's saved to the
+// storage of the application, replacing the previous one, and stays
+// there until it's exported or discarded.
+package crash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/remogatto/mandala-examples/storage"
+)
+
+const (
+	// The key and the version of the report in the storage
+	reportKey     = "crash.report"
+	reportVersion = 1
+
+	// The number of lines logged kept by default
+	DefaultLogLines = 100
+)
+
+// Report describes a crash.
+type Report struct {
+	Time    time.Time `json:"time"`
+	Reason  string    `json:"reason"`
+	Stack   string    `json:"stack"`
+	Version string    `json:"version"`
+	Device  Device    `json:"device"`
+
+	// The last lines logged before the crash, oldest first
+	Log []string `json:"log"`
+
+	// The state of the application, if any, or why it couldn't be
+	// saved
+	Snapshot      json.RawMessage `json:"snapshot,omitempty"`
+	SnapshotError string          `json:"snapshotError,omitempty"`
+}
+
+// Reporter writes the reports of an application. Its methods can be
+// called from any goroutine.
+type Reporter struct {
+	store   *storage.Store
+	version string
+	log     *Log
+
+	mutex    sync.Mutex
+	snapshot func() interface{}
+}
+
+// New returns a reporter saving to store the reports of the given
+// version of the application. store can be nil, then the reports
+// are only logged.
+func New(store *storage.Store, version string) *Reporter {
+	return &Reporter{
+		store:   store,
+		version: version,
+		log:     NewLog(DefaultLogLines),
+	}
+}
+
+// CaptureLog keeps the last lines written by the standard logger,
+// and so by mandala.Logf, for the reports. The lines are still
+// written where they were before.
+func (r *Reporter) CaptureLog() {
+	log.SetOutput(io.MultiWriter(log.Writer(), r.log))
+}
+
+// Log returns the lines kept for the reports.
+func (r *Reporter) Log() *Log {
+	return r.log
+}
+
+// SetSnapshot sets the function returning the state saved in the
+// reports. The state is encoded as JSON. The function is called
+// from the goroutine that panicked, after the panic, so it must not
+// wait for that goroutine.
+func (r *Reporter) SetSnapshot(snapshot func() interface{}) {
+	r.mutex.Lock()
+	r.snapshot = snapshot
+	r.mutex.Unlock()
+}
+
+// Report saves a report of a panic with the given reason and stack
+// trace. It returns the report saved.
+func (r *Reporter) Report(reason interface{}, stack string) (*Report, error) {
+	report := &Report{
+		Time:    time.Now(),
+		Reason:  fmt.Sprint(reason),
+		Stack:   stack,
+		Version: r.version,
+		Device:  DeviceInfo(),
+		Log:     r.log.Lines(),
+	}
+	r.mutex.Lock()
+	snapshot := r.snapshot
+	r.mutex.Unlock()
+	if snapshot != nil {
+		data, err := encodeSnapshot(snapshot)
+		if err != nil {
+			report.SnapshotError = err.Error()
+		} else {
+			report.Snapshot = data
+		}
+	}
+	if r.store == nil {
+		return report, fmt.Errorf("crash: no storage for the report")
+	}
+	return report, r.store.Put(reportKey, reportVersion, report)
+}
+
+// Pending returns the report saved by a previous run, nil if there's
+// none.
+func (r *Reporter) Pending() (*Report, error) {
+	if r.store == nil || !r.store.Has(reportKey) {
+		return nil, nil
+	}
+	report := new(Report)
+	if err := r.store.Get(reportKey, reportVersion, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Export writes the pending report to the given file as indented
+// JSON and discards it.
+func (r *Reporter) Export(filename string) error {
+	report, err := r.Pending()
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		return storage.ErrNotFound
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := storage.WriteFile(filename, data, 0644); err != nil {
+		return err
+	}
+	return r.Discard()
+}
+
+// Discard deletes the pending report.
+func (r *Reporter) Discard() error {
+	if r.store == nil {
+		return nil
+	}
+	return r.store.Delete(reportKey)
+}
+
+// encodeSnapshot encodes the state returned by snapshot. The state
+// may be inconsistent after a panic, so a panic while taking it is
+// returned as an error.
+func encodeSnapshot(snapshot func() interface{}) (data json.RawMessage, err error) {
+	defer func() {
+		if reason := recover(); reason != nil {
+			err = fmt.Errorf("crash: panic taking the snapshot: %v", reason)
+		}
+	}()
+	return json.Marshal(snapshot())
+}
@@ -0,0 +1,31 @@
+package crash
+
+import "runtime"
+
+// Device describes the device the application runs on.
+type Device struct {
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"goVersion"`
+
+	// The maker and the model of the device, empty on desktop
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Model        string `json:"model,omitempty"`
+
+	// The release of the operating system, like "4.4.2" on Android
+	// and the kernel release on Linux
+	Release string `json:"release,omitempty"`
+
+	// The API level of Android
+	SDK string `json:"sdk,omitempty"`
+}
+
+func runtimeInfo() Device {
+	return Device{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+	}
+}
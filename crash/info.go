@@ -0,0 +1,17 @@
+// +build !android
+
+package crash
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// DeviceInfo returns the platform and the kernel release.
+func DeviceInfo() Device {
+	d := runtimeInfo()
+	if release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		d.Release = strings.TrimSpace(string(release))
+	}
+	return d
+}
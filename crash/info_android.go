@@ -0,0 +1,28 @@
+// +build android
+
+package crash
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// DeviceInfo returns the platform and the model and release of the
+// device, read from the system properties.
+func DeviceInfo() Device {
+	d := runtimeInfo()
+	d.OS = "android"
+	d.Manufacturer = getprop("ro.product.manufacturer")
+	d.Model = getprop("ro.product.model")
+	d.Release = getprop("ro.build.version.release")
+	d.SDK = getprop("ro.build.version.sdk")
+	return d
+}
+
+func getprop(name string) string {
+	out, err := exec.Command("/system/bin/getprop", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
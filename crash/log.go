@@ -0,0 +1,67 @@
+package crash
+
+import (
+	"strings"
+	"sync"
+)
+
+// Log is a ring buffer keeping the last lines written to it. It can
+// be written from any goroutine.
+type Log struct {
+	mutex   sync.Mutex
+	lines   []string
+	next    int
+	partial string
+}
+
+// NewLog returns a log keeping the last size lines.
+func NewLog(size int) *Log {
+	return &Log{lines: make([]string, 0, size)}
+}
+
+// Write adds the complete lines in p. A line without its newline is
+// completed by the next write.
+func (l *Log) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	text := l.partial + string(p)
+	lines := strings.Split(text, "\n")
+	l.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		l.add(line)
+	}
+	return len(p), nil
+}
+
+// Add adds a line.
+func (l *Log) Add(line string) {
+	l.mutex.Lock()
+	l.add(line)
+	l.mutex.Unlock()
+}
+
+func (l *Log) add(line string) {
+	if cap(l.lines) == 0 {
+		return
+	}
+	if len(l.lines) < cap(l.lines) {
+		l.lines = append(l.lines, line)
+		return
+	}
+	l.lines[l.next] = line
+	l.next = (l.next + 1) % len(l.lines)
+}
+
+// Lines returns the lines kept, oldest first, including the last one
+// if not complete.
+func (l *Log) Lines() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	lines := make([]string, 0, len(l.lines)+1)
+	lines = append(lines, l.lines[l.next:]...)
+	lines = append(lines, l.lines[:l.next]...)
+	if l.partial != "" {
+		lines = append(lines, l.partial)
+	}
+	return lines
+}
@@ -206,7 +206,7 @@ func runAndroid(t *tasking.T) {
 	deployAndroid(t)
 	err := t.Exec(
 		fmt.Sprintf(
-			"adb shell am start -a android.intent.action.MAIN -n %s.%s/android.app.NativeActivity",
+			"adb shell am start -a android.intent.action.MAIN -n %s.%s/net.mandala.input.TouchActivity",
 			Domain,
 			LibName,
 		))
@@ -10,11 +10,27 @@ import (
 	"git.tideland.biz/goas/loop"
 	"github.com/remogatto/mandala"
 	"github.com/remogatto/mandala-examples/cube/src/cubelib"
+	"github.com/remogatto/mandala-examples/gesture"
+	"github.com/remogatto/mandala-examples/input"
 	gl "github.com/remogatto/opengles2"
 )
 
 const (
 	FRAMES_PER_SECOND = 30
+
+	// The rotation of the cube at each frame when left alone
+	DEFAULT_SPIN = 0.05
+
+	// The rotation of the cube for each pixel dragged
+	RADIANS_PER_PIXEL = 0.01
+)
+
+var (
+	// tracker tracks the fingers on the screen.
+	tracker = input.NewTracker(input.DefaultBufferSize)
+
+	// gestures recognizes the gestures of the fingers tracked.
+	gestures = gesture.NewRecognizer(gesture.DefaultConfig())
 )
 
 type viewportSize struct {
@@ -33,6 +49,9 @@ type renderState struct {
 	world             *cubelib.World
 	cube              *cubelib.Cube
 	angle, savedAngle float32
+
+	// The rotation at each frame
+	spin float32
 }
 
 func (renderState *renderState) init(window mandala.Window) {
@@ -56,6 +75,27 @@ func (renderState *renderState) init(window mandala.Window) {
 
 	renderState.world.Attach(renderState.cube)
 	renderState.angle = 0.0
+	renderState.spin = DEFAULT_SPIN
+}
+
+// handleGestures lets the user rotate the cube. Dragging or twisting
+// two fingers turns it, swiping spins it and a double tap restores
+// the default spin.
+func (renderState *renderState) handleGestures(gestures []gesture.Gesture) {
+	for _, g := range gestures {
+		switch g.Kind {
+		case gesture.Pan:
+			renderState.spin = 0
+			renderState.angle += g.DX * RADIANS_PER_PIXEL
+		case gesture.Rotate:
+			renderState.spin = 0
+			renderState.angle -= g.Angle
+		case gesture.Swipe:
+			renderState.spin = g.VX * RADIANS_PER_PIXEL / FRAMES_PER_SECOND
+		case gesture.DoubleTap:
+			renderState.spin = DEFAULT_SPIN
+		}
+	}
 }
 
 func newRenderLoopControl() *renderLoopControl {
@@ -98,7 +138,8 @@ func renderLoopFunc(control *renderLoopControl) loop.LoopFunc {
 
 			// At each tick render a frame and swap buffers.
 			case <-ticker.C:
-				renderState.angle += 0.05
+				renderState.handleGestures(gestures.Update(time.Now()))
+				renderState.angle += renderState.spin
 				renderState.cube.Rotate(renderState.angle, [3]float32{0, 1, 0})
 				renderState.world.Draw()
 				renderState.window.SwapBuffers()
@@ -113,6 +154,9 @@ func renderLoopFunc(control *renderLoopControl) loop.LoopFunc {
 					}
 				}
 
+			case event := <-tracker.Events():
+				renderState.handleGestures(gestures.Feed(event))
+
 			case event := <-control.pause:
 				renderState.savedAngle = renderState.angle
 				mandala.Logf("Save an angle value of %f", renderState.savedAngle)
@@ -180,17 +224,9 @@ func eventLoopFunc(renderLoopControl *renderLoopControl) loop.LoopFunc {
 				case mandala.NativeWindowCreatedEvent:
 					renderLoopControl.window <- event.Window
 
-				// Finger down/up on the screen.
-				case mandala.ActionUpDownEvent:
-					if event.Down {
-						mandala.Logf("Finger is DOWN at %f %f", event.X, event.Y)
-					} else {
-						mandala.Logf("Finger is now UP")
-					}
-
-					// Finger is moving on the screen.
-				case mandala.ActionMoveEvent:
-					mandala.Logf("Finger is moving at coord %f %f", event.X, event.Y)
+				// Finger down/up or moving on the screen.
+				case mandala.ActionUpDownEvent, mandala.ActionMoveEvent:
+					tracker.Translate(event)
 
 				case mandala.DestroyEvent:
 					mandala.Logf("Stop rendering...\n")
@@ -203,6 +239,7 @@ func eventLoopFunc(renderLoopControl *renderLoopControl) loop.LoopFunc {
 
 				case mandala.PauseEvent:
 					mandala.Logf("Application was paused. Stopping rendering ticker.")
+					tracker.Cancel(time.Now())
 					renderLoopControl.pause <- event
 
 				case mandala.ResumeEvent:
@@ -13,6 +13,7 @@ import (
 	"git.tideland.biz/goas/loop"
 	glfw "github.com/go-gl/glfw3"
 	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/input"
 )
 
 func main() {
@@ -58,6 +59,9 @@ func main() {
 
 	mandala.Init(window)
 
+	// Emulate the fingers with the mouse
+	input.EmulateTouch(window, tracker)
+
 	// Create a rendering loop control struct containing a set of
 	// channels that control rendering.
 	renderLoopControl := newRenderLoopControl()
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"git.tideland.biz/goas/loop"
 	"github.com/remogatto/mandala"
+	"github.com/remogatto/mandala-examples/input"
 	"runtime"
 )
 
@@ -15,6 +16,9 @@ func main() {
 	mandala.Verbose = true
 	mandala.Debug = true
 
+	// Track every finger on the screen
+	input.TrackMotions(tracker)
+
 	// Create rendering loop control channels
 	renderLoopControl := newRenderLoopControl()
 	// Start the rendering loop
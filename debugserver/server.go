@@ -0,0 +1,365 @@
+// Package debugserver lets external tools inspect and drive a
+// running example. It serves the state of the application as JSON
+// over HTTP, streams messages published by the application, like
+// frame statistics, over a WebSocket and forwards the commands it
+// receives to the application.
+//
+// The server only listens on the loopback interface, and rejects the
+// requests whose Host or Origin isn't a loopback address, so that web
+// pages can't reach it through the browser with forged requests or
+// DNS rebinding. On Android forward the port with adb:
+//
+//	adb forward tcp:6060 tcp:6060
+//
+// The endpoints are:
+//
+//	GET  /state           the state returned by the "state" command
+//	POST /command/<name>  runs a command, the body holds its JSON arguments
+//	GET  /ws              a WebSocket streaming the published messages
+//
+// Clients of the WebSocket run commands sending
+// {"id": 1, "command": "pause", "args": {...}} and receive
+// {"id": 1, "result": ...} or {"id": 1, "error": "..."}. Published
+// messages are sent as {"event": "stats", "data": ...}.
+package debugserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The address the server listens on if not configured
+	DefaultAddr = "localhost:6060"
+
+	// The command returning the state of the application
+	StateCommand = "state"
+
+	// How long a command waits for the application to answer
+	commandTimeout = 2 * time.Second
+
+	// The number of messages buffered for each WebSocket client
+	// before the client starts missing them
+	clientBufferSize = 16
+)
+
+var errTimeout = errors.New("the application didn't answer in time")
+
+// Request is a command sent to the application. The application
+// receives requests from Server.Requests and must answer each of
+// them with Reply.
+type Request struct {
+	Command string
+	Args    json.RawMessage
+
+	reply chan response
+}
+
+type response struct {
+	result interface{}
+	err    error
+}
+
+// Reply answers the request. The result is encoded as JSON.
+func (r *Request) Reply(result interface{}, err error) {
+	// The buffer holds the reply even if the client gave up
+	r.reply <- response{result, err}
+}
+
+// Decode decodes the arguments of the request into v. Missing
+// arguments leave v unchanged.
+func (r *Request) Decode(v interface{}) error {
+	if len(r.Args) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Args, v); err != nil {
+		return fmt.Errorf("invalid arguments for %s: %s", r.Command, err.Error())
+	}
+	return nil
+}
+
+// event is a message published to the WebSocket clients.
+type event struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// command is a command sent by a WebSocket client.
+type command struct {
+	ID      interface{}     `json:"id"`
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args"`
+}
+
+// reply answers a command of a WebSocket client.
+type reply struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Server is a debug server. Its methods can be called from any
+// goroutine.
+type Server struct {
+	addr     string
+	requests chan *Request
+
+	mutex    sync.Mutex
+	listener net.Listener
+	clients  map[*client]bool
+}
+
+// client is a WebSocket client with its queue of messages.
+type client struct {
+	conn     *websocketConn
+	messages chan []byte
+}
+
+// New returns a server that will listen on addr, which must be a
+// loopback address like "localhost:6060".
+func New(addr string) *Server {
+	return &Server{
+		addr:     addr,
+		requests: make(chan *Request),
+		clients:  make(map[*client]bool),
+	}
+}
+
+// Requests returns the channel delivering the commands to the
+// application.
+func (s *Server) Requests() <-chan *Request {
+	return s.requests
+}
+
+// Start starts listening.
+func (s *Server) Start() error {
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return err
+	}
+	if !isLoopback(host) {
+		return fmt.Errorf("the debug server can only listen on localhost, got %q", s.addr)
+	}
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.listener = listener
+	s.mutex.Unlock()
+	go http.Serve(listener, s.handler())
+	return nil
+}
+
+// handler returns the handler of the endpoints.
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveIndex)
+	mux.HandleFunc("/state", s.serveState)
+	mux.HandleFunc("/command/", s.serveCommand)
+	mux.HandleFunc("/ws", s.serveWebsocket)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !localRequest(r) {
+			http.Error(w, "only local clients are allowed", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Stop stops listening and disconnects the WebSocket clients.
+func (s *Server) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for c := range s.clients {
+		c.conn.close()
+		delete(s.clients, c)
+	}
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.listener = nil
+	return err
+}
+
+// Publish sends a message to the WebSocket clients. Clients that
+// can't keep up miss the message.
+func (s *Server) Publish(name string, data interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+	message, err := json.Marshal(event{name, data})
+	if err != nil {
+		return
+	}
+	for c := range s.clients {
+		select {
+		case c.messages <- message:
+		default:
+		}
+	}
+}
+
+// run sends a command to the application and waits for the answer.
+func (s *Server) run(name string, args json.RawMessage) (interface{}, error) {
+	r := &Request{Command: name, Args: args, reply: make(chan response, 1)}
+	timeout := time.After(commandTimeout)
+	select {
+	case s.requests <- r:
+	case <-timeout:
+		return nil, errTimeout
+	}
+	select {
+	case response := <-r.reply:
+		return response.result, response.err
+	case <-timeout:
+		return nil, errTimeout
+	}
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "GET /state\nPOST /command/<name>\nGET /ws\n")
+}
+
+func (s *Server) serveState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	result, err := s.run(StateCommand, nil)
+	writeResult(w, result, err)
+}
+
+func (s *Server) serveCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/command/")
+	args, err := ioutil.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(strings.TrimSpace(string(args))) == 0 {
+		args = nil
+	}
+	result, err := s.run(name, args)
+	writeResult(w, result, err)
+}
+
+// writeResult writes the answer of a command as JSON.
+func writeResult(w http.ResponseWriter, result interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err == errTimeout:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(reply{Error: err.Error()})
+	case err != nil:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(reply{Error: err.Error()})
+	default:
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	c := &client{conn: conn, messages: make(chan []byte, clientBufferSize)}
+	s.mutex.Lock()
+	s.clients[c] = true
+	s.mutex.Unlock()
+
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case message := <-c.messages:
+				if conn.writeMessage(message) != nil {
+					conn.close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		message, err := conn.readMessage()
+		if err != nil {
+			break
+		}
+		var cmd command
+		var rep reply
+		if err := json.Unmarshal(message, &cmd); err != nil {
+			rep.Error = "invalid command: " + err.Error()
+		} else {
+			rep.ID = cmd.ID
+			rep.Result, err = s.run(cmd.Command, cmd.Args)
+			if err != nil {
+				rep.Error = err.Error()
+			}
+		}
+		data, err := json.Marshal(rep)
+		if err != nil {
+			data, _ = json.Marshal(reply{ID: rep.ID, Error: err.Error()})
+		}
+		if conn.writeMessage(data) != nil {
+			break
+		}
+	}
+
+	close(done)
+	s.mutex.Lock()
+	delete(s.clients, c)
+	s.mutex.Unlock()
+	conn.close()
+}
+
+// localRequest returns true if the request is addressed to a
+// loopback host and, if sent by a browser, comes from a page on a
+// loopback host.
+func localRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = strings.Trim(r.Host, "[]")
+	}
+	if !isLoopback(host) {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && isLoopback(u.Hostname())
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
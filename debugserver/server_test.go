@@ -0,0 +1,91 @@
+package debugserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalRequests(t *testing.T) {
+	tests := []struct {
+		host, origin string
+		status       int
+	}{
+		{"localhost:6060", "", http.StatusOK},
+		{"127.0.0.1:6060", "", http.StatusOK},
+		{"[::1]:6060", "", http.StatusOK},
+		{"localhost", "", http.StatusOK},
+		{"localhost:6060", "http://localhost:8000", http.StatusOK},
+		{"localhost:6060", "http://127.0.0.1", http.StatusOK},
+		{"example.com:6060", "", http.StatusForbidden},
+		{"rebound.example.com", "http://rebound.example.com", http.StatusForbidden},
+		{"192.168.1.2:6060", "", http.StatusForbidden},
+		{"localhost:6060", "http://example.com", http.StatusForbidden},
+		{"localhost:6060", "null", http.StatusForbidden},
+	}
+	handler := New(DefaultAddr).handler()
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("Host %q, Origin %q: got status %d, want %d", test.host, test.origin, w.Code, test.status)
+		}
+	}
+}
+
+func TestWebsocketCommand(t *testing.T) {
+	s := New(DefaultAddr)
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+	go func() {
+		for r := range s.Requests() {
+			r.Reply(r.Command+" done", nil)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /ws HTTP/1.1\r\n" +
+		"Host: " + conn.RemoteAddr().String() + "\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got status %d, want %d", response.StatusCode, http.StatusSwitchingProtocols)
+	}
+	// The accept key of the example of RFC 6455
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got accept key %q", accept)
+	}
+
+	conn.Write(clientFrame(true, opText, []byte(`{"id": 7, "command": "pause"}`), true, 0))
+	_, opcode, payload, err := readServerFrame(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep reply
+	if err := json.Unmarshal(payload, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if opcode != opText || rep.ID != float64(7) || rep.Result != "pause done" || rep.Error != "" {
+		t.Errorf("got opcode %#x and reply %+v", opcode, rep)
+	}
+}
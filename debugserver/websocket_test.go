@@ -0,0 +1,207 @@
+package debugserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// newPipe returns the server side of a WebSocket connection and the
+// raw client side.
+func newPipe() (*websocketConn, net.Conn) {
+	server, client := net.Pipe()
+	return &websocketConn{conn: server, reader: bufio.NewReader(server)}, client
+}
+
+// clientFrame encodes a frame as a client does. If length is 126 or
+// 127 the length of the payload is encoded in 16 or 64 bits even if
+// shorter.
+func clientFrame(fin bool, opcode byte, payload []byte, masked bool, length int) []byte {
+	var b bytes.Buffer
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	b.WriteByte(first)
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case length == 127:
+		b.WriteByte(maskBit | 127)
+		binary.Write(&b, binary.BigEndian, uint64(len(payload)))
+	case length == 126:
+		b.WriteByte(maskBit | 126)
+		binary.Write(&b, binary.BigEndian, uint16(len(payload)))
+	default:
+		b.WriteByte(maskBit | byte(len(payload)))
+	}
+	if !masked {
+		b.Write(payload)
+		return b.Bytes()
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	b.Write(mask[:])
+	for i, c := range payload {
+		b.WriteByte(c ^ mask[i%4])
+	}
+	return b.Bytes()
+}
+
+// readServerFrame decodes a frame sent by the server.
+func readServerFrame(r io.Reader) (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[1]&0x80 != 0 {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	length := uint64(header[1])
+	switch length {
+	case 126:
+		var ext uint16
+		err = binary.Read(r, binary.BigEndian, &ext)
+		length = uint64(ext)
+	case 127:
+		err = binary.Read(r, binary.BigEndian, &length)
+	}
+	if err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	return
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		length int
+	}{
+		{"7 bit length", 125, 0},
+		{"16 bit length", 300, 126},
+		{"64 bit length", 1000, 127},
+		{"largest message", maxMessageSize, 127},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, client := newPipe()
+			defer client.Close()
+			payload := bytes.Repeat([]byte("abcdefg"), test.size/7+1)[:test.size]
+			go client.Write(clientFrame(true, opText, payload, true, test.length))
+			message, err := conn.readMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(message, payload) {
+				t.Errorf("got %d bytes, want %d bytes unmasked", len(message), len(payload))
+			}
+		})
+	}
+}
+
+func TestReadFragmentedMessage(t *testing.T) {
+	conn, client := newPipe()
+	defer client.Close()
+	go func() {
+		client.Write(clientFrame(false, opText, []byte("hello "), true, 0))
+		client.Write(clientFrame(true, opContinuation, []byte("world"), true, 0))
+	}()
+	message, err := conn.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != "hello world" {
+		t.Errorf("got %q, want %q", message, "hello world")
+	}
+}
+
+func TestRejectUnmaskedFrame(t *testing.T) {
+	conn, client := newPipe()
+	defer client.Close()
+	go client.Write(clientFrame(true, opText, []byte("hello"), false, 0))
+	if _, err := conn.readMessage(); err == nil {
+		t.Error("an unmasked client frame was accepted")
+	}
+}
+
+func TestRejectLargeFrame(t *testing.T) {
+	conn, client := newPipe()
+	defer client.Close()
+	// Only the header is sent, the length alone is refused
+	var header bytes.Buffer
+	header.Write([]byte{0x80 | opText, 0x80 | 127})
+	binary.Write(&header, binary.BigEndian, uint64(maxMessageSize+1))
+	go client.Write(header.Bytes())
+	if _, err := conn.readMessage(); err != errMessageTooLarge {
+		t.Errorf("got %v, want %v", err, errMessageTooLarge)
+	}
+}
+
+func TestPing(t *testing.T) {
+	conn, client := newPipe()
+	defer client.Close()
+	pong := make(chan []byte, 1)
+	go func() {
+		client.Write(clientFrame(true, opPing, []byte("are you there"), true, 0))
+		_, opcode, payload, err := readServerFrame(client)
+		if err != nil || opcode != opPong {
+			pong <- nil
+			return
+		}
+		pong <- payload
+		client.Write(clientFrame(true, opText, []byte("after the ping"), true, 0))
+	}()
+	message, err := conn.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-pong; string(got) != "are you there" {
+		t.Errorf("pong payload %q, want the ping payload", got)
+	}
+	if string(message) != "after the ping" {
+		t.Errorf("got %q, want the message after the ping", message)
+	}
+}
+
+func TestClose(t *testing.T) {
+	conn, client := newPipe()
+	defer client.Close()
+	closed := make(chan byte, 1)
+	go func() {
+		client.Write(clientFrame(true, opClose, nil, true, 0))
+		_, opcode, _, _ := readServerFrame(client)
+		closed <- opcode
+	}()
+	if _, err := conn.readMessage(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+	if opcode := <-closed; opcode != opClose {
+		t.Errorf("the server answered with opcode %#x, want a close frame", opcode)
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xffff, 0x10000} {
+		conn, client := newPipe()
+		payload := bytes.Repeat([]byte{'x'}, size)
+		go conn.writeMessage(payload)
+		fin, opcode, got, err := readServerFrame(client)
+		client.Close()
+		if err != nil {
+			t.Fatalf("%d bytes: %s", size, err.Error())
+		}
+		if !fin || opcode != opText || len(got) != size {
+			t.Errorf("%d bytes: got fin %v, opcode %#x, %d bytes", size, fin, opcode, len(got))
+		}
+	}
+}
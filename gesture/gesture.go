@@ -0,0 +1,359 @@
+// Package gesture recognizes taps, double taps, long presses,
+// swipes, pans, pinches and rotations in the pointer events of the
+// input package.
+package gesture
+
+import (
+	"math"
+	"time"
+
+	"github.com/remogatto/mandala-examples/input"
+)
+
+// Kind is the kind of a gesture.
+type Kind int
+
+const (
+	// A pointer went down and up quickly without moving
+	Tap Kind = iota
+
+	// Two taps close in time and space
+	DoubleTap
+
+	// A pointer stayed down without moving
+	LongPress
+
+	// A pan ended with a fast movement
+	Swipe
+
+	// A pointer is moving on the screen
+	Pan
+
+	// The pointer of a pan went up
+	PanEnd
+
+	// The distance between two pointers changed
+	Pinch
+
+	// The angle between two pointers changed
+	Rotate
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Tap:
+		return "tap"
+	case DoubleTap:
+		return "double tap"
+	case LongPress:
+		return "long press"
+	case Swipe:
+		return "swipe"
+	case Pan:
+		return "pan"
+	case PanEnd:
+		return "pan end"
+	case Pinch:
+		return "pinch"
+	case Rotate:
+		return "rotate"
+	}
+	return "unknown"
+}
+
+// Direction is the main direction of a swipe.
+type Direction int
+
+const (
+	Left Direction = iota
+	Right
+	Up
+	Down
+)
+
+// Gesture is a recognized gesture. Coordinates are in window pixels
+// with y growing downward.
+type Gesture struct {
+	Kind Kind
+
+	// Where the gesture happened. For two pointer gestures it's
+	// the point halfway between them.
+	X, Y float32
+
+	// The movement since the previous pan, pinch or rotate
+	DX, DY float32
+
+	// The velocity and the direction of swipes in pixels/s
+	VX, VY    float32
+	Direction Direction
+
+	// The ratio between the current and the previous distance of
+	// the pointers of a pinch
+	Scale float32
+
+	// The angle in radians the pointers of a rotation turned
+	// since the previous rotation, counterclockwise on screen
+	Angle float32
+}
+
+// Config holds the thresholds used to recognize the gestures.
+type Config struct {
+	// How far in pixels a pointer can move and still tap or long
+	// press
+	TapSlop float32
+
+	// The longest duration of a tap
+	TapTimeout time.Duration
+
+	// The longest time between the taps of a double tap. If zero
+	// double taps aren't recognized and taps are reported as
+	// soon as the pointer goes up, otherwise a tap is reported
+	// once it's sure it isn't the first of a double tap.
+	DoubleTapTimeout time.Duration
+
+	// How far in pixels the taps of a double tap can be
+	DoubleTapSlop float32
+
+	// How long a pointer must stay down to long press
+	LongPressTimeout time.Duration
+
+	// The minimum velocity in pixels/s and the minimum distance
+	// in pixels of a swipe
+	SwipeMinVelocity float32
+	SwipeMinDistance float32
+}
+
+// DefaultConfig returns thresholds that suit most touch screens.
+func DefaultConfig() Config {
+	return Config{
+		TapSlop:          10,
+		TapTimeout:       300 * time.Millisecond,
+		DoubleTapTimeout: 300 * time.Millisecond,
+		DoubleTapSlop:    40,
+		LongPressTimeout: 600 * time.Millisecond,
+		SwipeMinVelocity: 500,
+		SwipeMinDistance: 50,
+	}
+}
+
+// pointer is a tracked pointer with its gesture state.
+type pointer struct {
+	input.Pointer
+	panning bool
+}
+
+// Recognizer turns pointer events into gestures. It isn't safe for
+// concurrent use.
+type Recognizer struct {
+	Config Config
+
+	pointers []pointer
+
+	// Set once a gesture other than a tap happened, until all
+	// the pointers go up
+	consumed bool
+
+	// The tap waiting to become a double tap
+	pendingTap     bool
+	tapX, tapY     float32
+	tapTime        time.Time
+	longPressFired bool
+
+	// The distance and the angle between the first two pointers
+	distance, angle float32
+
+	out []Gesture
+}
+
+// NewRecognizer returns a recognizer using the given thresholds.
+func NewRecognizer(config Config) *Recognizer {
+	return &Recognizer{
+		Config:   config,
+		pointers: make([]pointer, 0, 4),
+		out:      make([]Gesture, 0, 4),
+	}
+}
+
+// Feed processes a pointer event and returns the recognized
+// gestures. The returned slice is valid until the next call to Feed
+// or Update.
+func (r *Recognizer) Feed(e input.Event) []Gesture {
+	r.out = r.out[:0]
+	switch e.Action {
+	case input.Down:
+		r.down(e.Pointer)
+	case input.Move:
+		r.move(e.Pointer)
+	case input.Up:
+		r.up(e.Pointer)
+	}
+	return r.out
+}
+
+// Update recognizes the gestures that depend on time passing, like
+// long presses and delayed taps. Call it at each frame.
+func (r *Recognizer) Update(now time.Time) []Gesture {
+	r.out = r.out[:0]
+	if r.pendingTap && now.Sub(r.tapTime) > r.Config.DoubleTapTimeout {
+		r.pendingTap = false
+		r.emit(Gesture{Kind: Tap, X: r.tapX, Y: r.tapY})
+	}
+	if len(r.pointers) == 1 && !r.consumed && !r.longPressFired {
+		p := &r.pointers[0]
+		if !p.panning && now.Sub(p.StartTime) >= r.Config.LongPressTimeout {
+			r.longPressFired = true
+			r.emit(Gesture{Kind: LongPress, X: p.X, Y: p.Y})
+		}
+	}
+	return r.out
+}
+
+func (r *Recognizer) emit(g Gesture) {
+	r.out = append(r.out, g)
+}
+
+func (r *Recognizer) find(id input.PointerID) int {
+	for i := range r.pointers {
+		if r.pointers[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Recognizer) down(p input.Pointer) {
+	if len(r.pointers) == 0 {
+		r.consumed = false
+		r.longPressFired = false
+	}
+	r.pointers = append(r.pointers, pointer{Pointer: p})
+	if len(r.pointers) == 2 {
+		// A second pointer starts a pinch or a rotation
+		r.consumed = true
+		r.distance, r.angle = r.span()
+	}
+}
+
+func (r *Recognizer) move(p input.Pointer) {
+	i := r.find(p.ID)
+	if i < 0 {
+		return
+	}
+	old := r.pointers[i]
+	r.pointers[i].Pointer = p
+
+	if len(r.pointers) >= 2 {
+		if i < 2 {
+			r.twoPointers(old.Pointer, i)
+		}
+		return
+	}
+
+	if !old.panning && distance(p.X-p.StartX, p.Y-p.StartY) > r.Config.TapSlop {
+		r.pointers[i].panning = true
+		r.consumed = true
+	}
+	if r.pointers[i].panning {
+		r.emit(Gesture{Kind: Pan, X: p.X, Y: p.Y, DX: p.X - old.X, DY: p.Y - old.Y})
+	}
+}
+
+// twoPointers recognizes pinches and rotations after the i-th of
+// the first two pointers moved from old.
+func (r *Recognizer) twoPointers(old input.Pointer, i int) {
+	a, b := r.pointers[0].Pointer, r.pointers[1].Pointer
+	cx, cy := (a.X+b.X)/2, (a.Y+b.Y)/2
+	if i == 0 {
+		a = old
+	} else {
+		b = old
+	}
+	ocx, ocy := (a.X+b.X)/2, (a.Y+b.Y)/2
+
+	d, angle := r.span()
+	if r.distance > 0 && d > 0 && d != r.distance {
+		r.emit(Gesture{Kind: Pinch, X: cx, Y: cy, DX: cx - ocx, DY: cy - ocy, Scale: d / r.distance})
+	}
+	if delta := wrapAngle(angle - r.angle); delta != 0 {
+		r.emit(Gesture{Kind: Rotate, X: cx, Y: cy, Angle: delta})
+	}
+	r.distance, r.angle = d, angle
+}
+
+func (r *Recognizer) up(p input.Pointer) {
+	i := r.find(p.ID)
+	if i < 0 {
+		return
+	}
+	state := r.pointers[i]
+	state.Pointer = p
+	r.pointers = append(r.pointers[:i], r.pointers[i+1:]...)
+	if len(r.pointers) == 2 {
+		r.distance, r.angle = r.span()
+	}
+
+	switch {
+	case state.panning:
+		r.emit(Gesture{Kind: PanEnd, X: p.X, Y: p.Y})
+		dx, dy := p.X-p.StartX, p.Y-p.StartY
+		if distance(p.VX, p.VY) >= r.Config.SwipeMinVelocity && distance(dx, dy) >= r.Config.SwipeMinDistance {
+			r.emit(Gesture{Kind: Swipe, X: p.X, Y: p.Y, VX: p.VX, VY: p.VY, Direction: direction(dx, dy)})
+		}
+
+	case !r.consumed && !r.longPressFired && len(r.pointers) == 0 && p.Duration() <= r.Config.TapTimeout:
+		r.tap(p)
+	}
+}
+
+func (r *Recognizer) tap(p input.Pointer) {
+	if r.Config.DoubleTapTimeout == 0 {
+		r.emit(Gesture{Kind: Tap, X: p.X, Y: p.Y})
+		return
+	}
+	if r.pendingTap && p.Time.Sub(r.tapTime) <= r.Config.DoubleTapTimeout &&
+		distance(p.X-r.tapX, p.Y-r.tapY) <= r.Config.DoubleTapSlop {
+		r.pendingTap = false
+		r.emit(Gesture{Kind: DoubleTap, X: p.X, Y: p.Y})
+		return
+	}
+	if r.pendingTap {
+		r.emit(Gesture{Kind: Tap, X: r.tapX, Y: r.tapY})
+	}
+	r.pendingTap = true
+	r.tapX, r.tapY, r.tapTime = p.X, p.Y, p.Time
+}
+
+// span returns the distance and the angle between the first two
+// pointers. The angle is counterclockwise on screen.
+func (r *Recognizer) span() (float32, float32) {
+	a, b := r.pointers[0], r.pointers[1]
+	dx, dy := b.X-a.X, b.Y-a.Y
+	return distance(dx, dy), float32(math.Atan2(float64(-dy), float64(dx)))
+}
+
+func distance(dx, dy float32) float32 {
+	return float32(math.Hypot(float64(dx), float64(dy)))
+}
+
+func wrapAngle(a float32) float32 {
+	for a > math.Pi {
+		a -= 2 * math.Pi
+	}
+	for a < -math.Pi {
+		a += 2 * math.Pi
+	}
+	return a
+}
+
+func direction(dx, dy float32) Direction {
+	if math.Abs(float64(dx)) > math.Abs(float64(dy)) {
+		if dx < 0 {
+			return Left
+		}
+		return Right
+	}
+	if dy < 0 {
+		return Up
+	}
+	return Down
+}
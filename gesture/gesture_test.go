@@ -0,0 +1,247 @@
+package gesture
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/remogatto/mandala-examples/input"
+)
+
+// step is a synthetic pointer event, or a call to Update if action
+// is update.
+type step struct {
+	at     time.Duration
+	action string
+	id     input.PointerID
+	x, y   float32
+}
+
+func down(ms int, id input.PointerID, x, y float32) step {
+	return step{time.Duration(ms) * time.Millisecond, "down", id, x, y}
+}
+
+func move(ms int, id input.PointerID, x, y float32) step {
+	return step{time.Duration(ms) * time.Millisecond, "move", id, x, y}
+}
+
+func up(ms int, id input.PointerID, x, y float32) step {
+	return step{time.Duration(ms) * time.Millisecond, "up", id, x, y}
+}
+
+func update(ms int) step {
+	return step{at: time.Duration(ms) * time.Millisecond, action: "update"}
+}
+
+// run feeds the steps to a recognizer through a tracker and returns
+// all the gestures recognized.
+func run(config Config, steps []step) []Gesture {
+	tracker := input.NewTracker(input.DefaultBufferSize)
+	r := NewRecognizer(config)
+	start := time.Unix(0, 0)
+	var gestures []Gesture
+	for _, s := range steps {
+		when := start.Add(s.at)
+		switch s.action {
+		case "down":
+			tracker.Down(s.id, s.x, s.y, when)
+		case "move":
+			tracker.Move(s.id, s.x, s.y, when)
+		case "up":
+			tracker.Up(s.id, s.x, s.y, when)
+		case "update":
+			gestures = append(gestures, r.Update(when)...)
+		}
+		for len(tracker.Events()) > 0 {
+			gestures = append(gestures, r.Feed(<-tracker.Events())...)
+		}
+	}
+	return gestures
+}
+
+func kinds(gestures []Gesture) []Kind {
+	k := make([]Kind, len(gestures))
+	for i, g := range gestures {
+		k[i] = g.Kind
+	}
+	return k
+}
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+var recognizerTests = []struct {
+	name  string
+	steps []step
+	want  []Kind
+	check func(t *testing.T, gestures []Gesture)
+}{
+	{
+		name:  "tap waits for the double tap timeout",
+		steps: []step{down(0, 0, 10, 10), up(100, 0, 10, 10), update(200)},
+		want:  nil,
+	},
+	{
+		name:  "tap",
+		steps: []step{down(0, 0, 10, 10), up(100, 0, 12, 10), update(500)},
+		want:  []Kind{Tap},
+		check: func(t *testing.T, g []Gesture) {
+			if g[0].X != 12 || g[0].Y != 10 {
+				t.Errorf("tap at %g,%g, want 12,10", g[0].X, g[0].Y)
+			}
+		},
+	},
+	{
+		name:  "too long for a tap",
+		steps: []step{down(0, 0, 10, 10), up(400, 0, 10, 10), update(1000)},
+		want:  nil,
+	},
+	{
+		name: "double tap",
+		steps: []step{
+			down(0, 0, 10, 10), up(100, 0, 10, 10),
+			down(200, 0, 20, 15), up(250, 0, 20, 15),
+			update(1000),
+		},
+		want: []Kind{DoubleTap},
+	},
+	{
+		name: "taps too far apart in time",
+		steps: []step{
+			down(0, 0, 10, 10), up(100, 0, 10, 10),
+			update(450),
+			down(500, 0, 10, 10), up(550, 0, 10, 10),
+			update(1000),
+		},
+		want: []Kind{Tap, Tap},
+	},
+	{
+		name: "taps too far apart in space",
+		steps: []step{
+			down(0, 0, 10, 10), up(100, 0, 10, 10),
+			down(150, 0, 100, 10), up(200, 0, 100, 10),
+			update(1000),
+		},
+		want: []Kind{Tap, Tap},
+	},
+	{
+		name:  "long press",
+		steps: []step{down(0, 0, 10, 10), update(300), update(700), update(800), up(900, 0, 10, 10), update(2000)},
+		want:  []Kind{LongPress},
+	},
+	{
+		name:  "a moving pointer doesn't long press",
+		steps: []step{down(0, 0, 10, 10), move(100, 0, 40, 10), update(700), up(800, 0, 40, 10)},
+		want:  []Kind{Pan, PanEnd},
+	},
+	{
+		name: "pan",
+		steps: []step{
+			down(0, 0, 0, 0),
+			move(10, 0, 5, 0),
+			move(20, 0, 20, 0),
+			move(30, 0, 20, 8),
+			up(1000, 0, 20, 8),
+		},
+		want: []Kind{Pan, Pan, PanEnd},
+		check: func(t *testing.T, g []Gesture) {
+			if g[0].DX != 15 || g[0].DY != 0 {
+				t.Errorf("first pan moved %g,%g, want 15,0", g[0].DX, g[0].DY)
+			}
+			if g[1].DX != 0 || g[1].DY != 8 {
+				t.Errorf("second pan moved %g,%g, want 0,8", g[1].DX, g[1].DY)
+			}
+			if g[2].X != 20 || g[2].Y != 8 {
+				t.Errorf("pan ended at %g,%g, want 20,8", g[2].X, g[2].Y)
+			}
+		},
+	},
+	{
+		name: "swipe",
+		steps: []step{
+			down(0, 0, 0, 0),
+			move(10, 0, 30, 0),
+			move(20, 0, 60, 0),
+			up(30, 0, 90, 0),
+		},
+		want: []Kind{Pan, Pan, PanEnd, Swipe},
+		check: func(t *testing.T, g []Gesture) {
+			if g[3].Direction != Right {
+				t.Errorf("swiped toward %d, want right", g[3].Direction)
+			}
+		},
+	},
+	{
+		name: "pinch",
+		steps: []step{
+			down(0, 0, 0, 0),
+			down(0, 1, 100, 0),
+			move(10, 1, 200, 0),
+			move(20, 0, 100, 0),
+			up(30, 0, 100, 0),
+			up(30, 1, 200, 0),
+			update(1000),
+		},
+		want: []Kind{Pinch, Pinch},
+		check: func(t *testing.T, g []Gesture) {
+			if !near(g[0].Scale, 2) {
+				t.Errorf("first pinch scale %g, want 2", g[0].Scale)
+			}
+			if !near(g[1].Scale, 0.5) {
+				t.Errorf("second pinch scale %g, want 0.5", g[1].Scale)
+			}
+			if g[0].X != 100 || g[0].DX != 50 {
+				t.Errorf("first pinch at %g moved %g, want 100 and 50", g[0].X, g[0].DX)
+			}
+		},
+	},
+	{
+		name: "rotate",
+		steps: []step{
+			down(0, 0, 0, 0),
+			down(0, 1, 100, 0),
+			move(10, 1, 0, -100),
+			up(20, 1, 0, -100),
+			up(20, 0, 0, 0),
+		},
+		want: []Kind{Rotate},
+		check: func(t *testing.T, g []Gesture) {
+			if !near(g[0].Angle, math.Pi/2) {
+				t.Errorf("rotated by %g, want %g", g[0].Angle, math.Pi/2)
+			}
+		},
+	},
+}
+
+func TestRecognizer(t *testing.T) {
+	for _, test := range recognizerTests {
+		t.Run(test.name, func(t *testing.T) {
+			gestures := run(DefaultConfig(), test.steps)
+			got := kinds(gestures)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got %v, want %v", got, test.want)
+				}
+			}
+			if test.check != nil {
+				test.check(t, gestures)
+			}
+		})
+	}
+}
+
+func TestTapWithoutDoubleTap(t *testing.T) {
+	config := DefaultConfig()
+	config.DoubleTapTimeout = 0
+	got := kinds(run(config, []step{
+		down(0, 0, 10, 10), up(100, 0, 10, 10),
+		down(150, 0, 10, 10), up(200, 0, 10, 10),
+	}))
+	if len(got) != 2 || got[0] != Tap || got[1] != Tap {
+		t.Errorf("got %v, want two taps reported as the pointer goes up", got)
+	}
+}
@@ -0,0 +1,17 @@
+// +build !android
+
+package i18n
+
+import "os"
+
+// DetectLocale returns the locale of the user from the environment,
+// looking at LC_ALL, LC_MESSAGES and LANG as POSIX systems do.
+// DefaultLocale is returned if none is set.
+func DetectLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := Normalize(os.Getenv(name)); locale != "" {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
@@ -0,0 +1,45 @@
+// +build android
+
+package i18n
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// DetectLocale returns the locale chosen in the settings of the
+// device, read from the system properties. DefaultLocale is returned
+// if none is set.
+func DetectLocale() string {
+	// Android 6 and later
+	if locale := getprop("persist.sys.locale"); locale != "" {
+		return Normalize(locale)
+	}
+	// Older releases store the language and the country apart
+	if language := getprop("persist.sys.language"); language != "" {
+		return Normalize(join(language, getprop("persist.sys.country")))
+	}
+	// The locale the device shipped with
+	if locale := getprop("ro.product.locale"); locale != "" {
+		return Normalize(locale)
+	}
+	if language := getprop("ro.product.locale.language"); language != "" {
+		return Normalize(join(language, getprop("ro.product.locale.region")))
+	}
+	return DefaultLocale
+}
+
+func getprop(name string) string {
+	out, err := exec.Command("/system/bin/getprop", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func join(language, region string) string {
+	if region == "" {
+		return language
+	}
+	return language + "-" + region
+}
@@ -0,0 +1,217 @@
+// Package i18n translates the text shown by the examples. Messages
+// are read from JSON catalogs, one per locale:
+//
+//	{
+//	    "locale": "it",
+//	    "messages": {
+//	        "fps": "Fotogrammi al secondo {0}",
+//	        "boxes": { "one": "{0} scatola", "other": "{0} scatole" }
+//	    }
+//	}
+//
+// A message is either a string or an object with a string for each
+// plural form of the language: zero, one, two, few, many and other.
+// {0}, {1}, ... are replaced by the arguments, formatted with the fmt
+// verb given after a colon if any, like {0:%.1f}. {{ is a literal
+// brace.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The runes of printable ASCII, always included in the glyph range
+const (
+	firstPrintable = ' '
+	lastPrintable  = '~'
+)
+
+// MaxGlyphs is the size of the largest glyph range GlyphRange
+// accepts. Fonts are loaded for a contiguous range of runes, so a
+// single rune far from the others, like a typographic quote, would
+// load thousands of glyphs.
+const MaxGlyphs = 1024
+
+// message is a translated text, with its plural forms if any.
+type message struct {
+	text  string
+	forms map[Form]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &m.forms); err != nil {
+		return fmt.Errorf("a message must be a string or an object of plural forms")
+	}
+	for form := range m.forms {
+		if !form.valid() {
+			return fmt.Errorf("unknown plural form %q", form)
+		}
+	}
+	return nil
+}
+
+// Catalog holds the messages of a locale.
+type Catalog struct {
+	// The locale of the messages, like "it" or "pt-BR"
+	Locale string
+
+	messages map[string]*message
+	plural   PluralRule
+	fallback *Catalog
+}
+
+// catalogFile is the format of the catalogs.
+type catalogFile struct {
+	Locale   string              `json:"locale"`
+	Messages map[string]*message `json:"messages"`
+}
+
+// Parse parses a catalog.
+func Parse(data []byte) (*Catalog, error) {
+	var file catalogFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %s", err.Error())
+	}
+	if file.Locale == "" {
+		return nil, fmt.Errorf("invalid catalog: missing locale")
+	}
+	c := New(file.Locale)
+	for key, m := range file.Messages {
+		if m != nil {
+			c.messages[key] = m
+		}
+	}
+	return c, nil
+}
+
+// New returns an empty catalog for the given locale.
+func New(locale string) *Catalog {
+	return &Catalog{
+		Locale:   locale,
+		messages: make(map[string]*message),
+		plural:   Plural(locale),
+	}
+}
+
+// SetFallback sets the catalog used for the messages missing from
+// c, usually the English one.
+func (c *Catalog) SetFallback(fallback *Catalog) {
+	c.fallback = fallback
+}
+
+// T returns the message with the given key formatted with args. If
+// the message is missing from c and its fallbacks the key is
+// returned.
+func (c *Catalog) T(key string, args ...interface{}) string {
+	for catalog := c; catalog != nil; catalog = catalog.fallback {
+		if m, ok := catalog.messages[key]; ok {
+			if m.forms == nil {
+				return format(m.text, args)
+			}
+			if text, ok := m.forms[Other]; ok {
+				return format(text, args)
+			}
+		}
+	}
+	return key
+}
+
+// N returns the plural form of the message with the given key for
+// the quantity n. The arguments are n followed by args, so n is {0}.
+func (c *Catalog) N(key string, n int, args ...interface{}) string {
+	args = append([]interface{}{n}, args...)
+	for catalog := c; catalog != nil; catalog = catalog.fallback {
+		m, ok := catalog.messages[key]
+		if !ok {
+			continue
+		}
+		if m.forms == nil {
+			return format(m.text, args)
+		}
+		if text, ok := m.forms[catalog.plural(n)]; ok {
+			return format(text, args)
+		}
+		if text, ok := m.forms[Other]; ok {
+			return format(text, args)
+		}
+	}
+	return key
+}
+
+// GlyphRange returns the smallest range of runes including
+// printable ASCII and every rune of the messages of c and of its
+// fallbacks. Fonts loaded for this range can draw all the messages,
+// and the numbers formatted into them. It fails if the range is
+// larger than MaxGlyphs, naming the message with the highest rune.
+func (c *Catalog) GlyphRange() (low, high rune, err error) {
+	low, high = firstPrintable, lastPrintable
+	var highKey string
+	add := func(key, s string) {
+		for _, r := range s {
+			if r < firstPrintable || r == utf8.RuneError {
+				continue
+			}
+			if r > high {
+				high, highKey = r, key
+			}
+		}
+	}
+	for catalog := c; catalog != nil; catalog = catalog.fallback {
+		for key, m := range catalog.messages {
+			add(key, m.text)
+			for _, text := range m.forms {
+				add(key, text)
+			}
+		}
+	}
+	if n := int(high-low) + 1; n > MaxGlyphs {
+		return low, high, fmt.Errorf("i18n: the %s messages need %d glyphs, more than %d, because %q contains %U", c.Locale, n, MaxGlyphs, highKey, high)
+	}
+	return low, high, nil
+}
+
+// format replaces the placeholders of text with args.
+func format(text string, args []interface{}) string {
+	if strings.IndexByte(text, '{') < 0 {
+		return text
+	}
+	var buf []byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '{' {
+			buf = append(buf, c)
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '{' {
+			buf = append(buf, '{')
+			i++
+			continue
+		}
+		end := strings.IndexByte(text[i:], '}')
+		if end < 0 {
+			buf = append(buf, text[i:]...)
+			break
+		}
+		placeholder := text[i+1 : i+end]
+		verb := "%v"
+		if colon := strings.IndexByte(placeholder, ':'); colon >= 0 {
+			placeholder, verb = placeholder[:colon], placeholder[colon+1:]
+		}
+		n, err := strconv.Atoi(placeholder)
+		if err != nil || n < 0 || n >= len(args) {
+			// Leave unknown placeholders visible
+			buf = append(buf, text[i:i+end+1]...)
+		} else {
+			buf = append(buf, fmt.Sprintf(verb, args[n])...)
+		}
+		i += end
+	}
+	return string(buf)
+}
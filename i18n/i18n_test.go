@@ -0,0 +1,203 @@
+package i18n
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var pluralTests = []struct {
+	locale string
+	forms  map[int]Form
+}{
+	{"en", map[int]Form{0: Other, 1: One, 2: Other, 11: Other}},
+	{"it-IT", map[int]Form{0: Other, 1: One, 5: Other}},
+	{"fr", map[int]Form{0: One, 1: One, 2: Other}},
+	{"ja", map[int]Form{0: Other, 1: Other, 2: Other}},
+	{"ru", map[int]Form{
+		1: One, 21: One, 101: One, 11: Many,
+		2: Few, 4: Few, 22: Few, 12: Many, 14: Many,
+		0: Many, 5: Many, 20: Many, 111: Many, -1: One,
+	}},
+	{"hr", map[int]Form{1: One, 21: One, 11: Other, 2: Few, 24: Few, 12: Other, 0: Other, 5: Other, 20: Other}},
+	{"sr", map[int]Form{1: One, 3: Few, 5: Other, 15: Other, 100: Other}},
+	{"bs", map[int]Form{31: One, 33: Few, 13: Other, 25: Other}},
+	{"pl", map[int]Form{1: One, 2: Few, 22: Few, 12: Many, 21: Many, 5: Many, 0: Many}},
+	{"cs", map[int]Form{1: One, 2: Few, 4: Few, 5: Other, 22: Other}},
+	{"ar", map[int]Form{0: Zero, 1: One, 2: Two, 3: Few, 110: Few, 11: Many, 99: Many, 100: Other, 102: Other}},
+	{"xx", map[int]Form{1: One, 2: Other}},
+}
+
+func TestPlural(t *testing.T) {
+	for _, test := range pluralTests {
+		rule := Plural(test.locale)
+		for n, want := range test.forms {
+			if got := rule(n); got != want {
+				t.Errorf("%s: %d is %s, want %s", test.locale, n, got, want)
+			}
+		}
+	}
+}
+
+var formatTests = []struct {
+	text string
+	args []interface{}
+	want string
+}{
+	{"no placeholders", nil, "no placeholders"},
+	{"Score {0}", []interface{}{42}, "Score 42"},
+	{"{1} and {0}", []interface{}{"a", "b"}, "b and a"},
+	{"{0:%g}x{1:%g}", []interface{}{1.5, 2.0}, "1.5x2"},
+	{"{0:%.1f}", []interface{}{0.25}, "0.2"},
+	{"{0:%03d}", []interface{}{7}, "007"},
+	{"{{0}", []interface{}{1}, "{0}"},
+	{"{2} missing", []interface{}{1}, "{2} missing"},
+	{"{x} invalid", []interface{}{1}, "{x} invalid"},
+	{"unterminated {0", []interface{}{1}, "unterminated {0"},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range formatTests {
+		if got := format(test.text, test.args); got != test.want {
+			t.Errorf("format(%q, %v) = %q, want %q", test.text, test.args, got, test.want)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	defaults, err := Parse([]byte(`{
+	    "locale": "en",
+	    "messages": {
+	        "boxes": { "one": "{0} box", "other": "{0} boxes" },
+	        "score": "Score {0}",
+	        "undo": "Undo"
+	    }
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Parse([]byte(`{
+	    "locale": "hr",
+	    "messages": {
+	        "boxes": { "one": "{0} kutija", "few": "{0} kutije", "other": "{0} kutija" },
+	        "score": "Bodovi {0}"
+	    }
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetFallback(defaults)
+	tests := []struct {
+		got, want string
+	}{
+		{c.N("boxes", 1), "1 kutija"},
+		{c.N("boxes", 3), "3 kutije"},
+		{c.N("boxes", 5), "5 kutija"},
+		{c.T("score", 7), "Bodovi 7"},
+		{c.T("undo"), "Undo"},
+		{c.T("missing"), "missing"},
+		{defaults.N("boxes", 2), "2 boxes"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("got %q, want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{"messages": {}}`,
+		`{"locale": "en", "messages": {"a": 1}}`,
+		`{"locale": "en", "messages": {"a": {"several": "x"}}}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s parsed, want an error", data)
+		}
+	}
+}
+
+var normalizeTests = []struct {
+	locale, want string
+}{
+	{"it_IT.UTF-8", "it-IT"},
+	{"pt_br", "pt-BR"},
+	{"sr_RS@latin", "sr-RS"},
+	{"zh_hant_tw", "zh-Hant-TW"},
+	{"EN", "en"},
+	{"C", ""},
+	{"POSIX", ""},
+	{"C.UTF-8", ""},
+	{"", ""},
+}
+
+func TestNormalize(t *testing.T) {
+	for _, test := range normalizeTests {
+		if got := Normalize(test.locale); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.locale, got, test.want)
+		}
+	}
+}
+
+var candidatesTests = []struct {
+	locale string
+	want   []string
+}{
+	{"pt-BR", []string{"pt-BR", "pt"}},
+	{"zh-Hant-TW", []string{"zh-Hant-TW", "zh-Hant", "zh"}},
+	{"it", []string{"it"}},
+	{"", nil},
+}
+
+func TestCandidates(t *testing.T) {
+	for _, test := range candidatesTests {
+		if got := Candidates(test.locale); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Candidates(%q) = %q, want %q", test.locale, got, test.want)
+		}
+	}
+}
+
+var glyphRangeTests = []struct {
+	name     string
+	messages string
+	high     rune
+	err      string
+}{
+	{"ASCII", `{"a": "Undo"}`, '~', ""},
+	{"Latin", `{"a": "Perché", "b": { "one": "città" }}`, 'é', ""},
+	{"Greek", `{"a": "Αναίρεση"}`, 'σ', ""},
+	{"the highest glyph", `{"a": "` + string(firstPrintable+MaxGlyphs-1) + `"}`, firstPrintable + MaxGlyphs - 1, ""},
+	{"Cyrillic", `{"a": "Отменить"}`, 'ь', `"a" contains U+044C`},
+	{"a typographic quote", `{"a": "l’ultimo"}`, '’', `"a" contains U+2019`},
+}
+
+func TestGlyphRange(t *testing.T) {
+	for _, test := range glyphRangeTests {
+		c, err := Parse([]byte(`{"locale": "xx", "messages": ` + test.messages + `}`))
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		low, high, err := c.GlyphRange()
+		if low != ' ' || high != test.high {
+			t.Errorf("%s: range %U-%U, want U+0020-%U", test.name, low, high, test.high)
+		}
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %s", test.name, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: no error, want one over %d glyphs", test.name, MaxGlyphs)
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want it to contain %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestGlyphRangeIncludesFallback(t *testing.T) {
+	defaults, _ := Parse([]byte(`{"locale": "en", "messages": {"a": "Ä"}}`))
+	c := New("it")
+	c.SetFallback(defaults)
+	if _, high, _ := c.GlyphRange(); high != 'Ä' {
+		t.Errorf("high %U, want %U", high, 'Ä')
+	}
+}
@@ -0,0 +1,45 @@
+package i18n
+
+import "strings"
+
+// DefaultLocale is the locale used when none can be detected.
+const DefaultLocale = "en"
+
+// Normalize converts a POSIX locale like "it_IT.UTF-8" to a BCP 47
+// tag like "it-IT". The C and POSIX locales become the empty
+// string.
+func Normalize(locale string) string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "C" || locale == "POSIX" {
+		return ""
+	}
+	parts := strings.Split(strings.Replace(locale, "_", "-", -1), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		// Regions are upper case, scripts title case
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		} else if len(parts[i]) == 4 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Candidates returns the locales to try in order to find a catalog
+// for locale, from the most specific to the language alone: "pt-BR"
+// and "pt" for "pt-BR".
+func Candidates(locale string) []string {
+	var candidates []string
+	for locale != "" {
+		candidates = append(candidates, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return candidates
+}
@@ -0,0 +1,147 @@
+package i18n
+
+import "strings"
+
+// Form is a plural form, as named by the Unicode CLDR.
+type Form string
+
+const (
+	Zero  Form = "zero"
+	One   Form = "one"
+	Two   Form = "two"
+	Few   Form = "few"
+	Many  Form = "many"
+	Other Form = "other"
+)
+
+func (f Form) valid() bool {
+	switch f {
+	case Zero, One, Two, Few, Many, Other:
+		return true
+	}
+	return false
+}
+
+// PluralRule returns the plural form of a language for a quantity.
+type PluralRule func(n int) Form
+
+// The plural rules of the languages, by ISO 639-1 code. Languages
+// missing from the table use the English rule.
+var pluralRules = map[string]PluralRule{}
+
+func init() {
+	set := func(rule PluralRule, languages ...string) {
+		for _, l := range languages {
+			pluralRules[l] = rule
+		}
+	}
+	set(otherRule, "ja", "ko", "zh", "vi", "th", "id", "ms")
+	set(oneRule, "en", "de", "nl", "sv", "da", "no", "nb", "fi", "it", "es", "el", "hu", "tr", "bg", "et", "ca")
+	set(zeroOneRule, "fr", "pt", "hi")
+	set(slavicRule, "ru", "uk", "be")
+	set(serboCroatianRule, "sr", "hr", "bs")
+	set(polishRule, "pl")
+	set(czechRule, "cs", "sk")
+	set(arabicRule, "ar")
+}
+
+// Plural returns the plural rule of the language of locale.
+func Plural(locale string) PluralRule {
+	if rule, ok := pluralRules[language(locale)]; ok {
+		return rule
+	}
+	return oneRule
+}
+
+func otherRule(n int) Form {
+	return Other
+}
+
+func oneRule(n int) Form {
+	if n == 1 {
+		return One
+	}
+	return Other
+}
+
+func zeroOneRule(n int) Form {
+	if n == 0 || n == 1 {
+		return One
+	}
+	return Other
+}
+
+func slavicRule(n int) Form {
+	n = abs(n)
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return One
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return Few
+	}
+	return Many
+}
+
+// serboCroatianRule is slavicRule without the many form: 5 to 20
+// and the like are other.
+func serboCroatianRule(n int) Form {
+	if form := slavicRule(n); form != Many {
+		return form
+	}
+	return Other
+}
+
+func polishRule(n int) Form {
+	n = abs(n)
+	switch {
+	case n == 1:
+		return One
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return Few
+	}
+	return Many
+}
+
+func czechRule(n int) Form {
+	n = abs(n)
+	switch {
+	case n == 1:
+		return One
+	case n >= 2 && n <= 4:
+		return Few
+	}
+	return Other
+}
+
+func arabicRule(n int) Form {
+	n = abs(n)
+	switch {
+	case n == 0:
+		return Zero
+	case n == 1:
+		return One
+	case n == 2:
+		return Two
+	case n%100 >= 3 && n%100 <= 10:
+		return Few
+	case n%100 >= 11:
+		return Many
+	}
+	return Other
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// language returns the language code of locale, like "pt" for
+// "pt-BR".
+func language(locale string) string {
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	return strings.ToLower(locale)
+}
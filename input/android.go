@@ -0,0 +1,35 @@
+// +build android
+
+package input
+
+import "C"
+import (
+	"sync"
+	"time"
+	"unsafe"
+)
+
+var (
+	motionMutex   sync.Mutex
+	motionTracker *Tracker
+)
+
+// TrackMotions feeds the tracker with every pointer of the motion
+// events reported by TouchActivity. The activity must be declared in
+// the manifest in place of android.app.NativeActivity, or extended
+// by the activity declared there.
+func TrackMotions(t *Tracker) {
+	motionMutex.Lock()
+	motionTracker = t
+	motionMutex.Unlock()
+}
+
+//export Java_net_mandala_input_TouchActivity_onPointer
+func Java_net_mandala_input_TouchActivity_onPointer(env, class unsafe.Pointer, action, id C.int, x, y C.float) {
+	motionMutex.Lock()
+	t := motionTracker
+	motionMutex.Unlock()
+	if t != nil {
+		t.Motion(MotionAction(action), PointerID(id), float32(x), float32(y), time.Now())
+	}
+}
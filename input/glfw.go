@@ -0,0 +1,122 @@
+// +build !android
+
+package input
+
+import (
+	"time"
+
+	glfw "github.com/go-gl/glfw3"
+)
+
+// The pointers emulated with the mouse
+const (
+	// The first button pressed
+	MousePointer PointerID = iota
+
+	// The finger mirrored around the center of the window while
+	// the modifier is held, or the second button pressed
+	SecondPointer
+)
+
+// The modifier that adds the mirrored finger while the left button
+// is pressed
+const EmulationModifier = glfw.ModControl
+
+// Mouse emulates up to two fingers with the mouse of a window.
+type Mouse struct {
+	tracker         *Tracker
+	window          *glfw.Window
+	left, right     bool
+	mirrored        bool
+	leftID, rightID PointerID
+}
+
+// EmulateTouch feeds the tracker with the mouse of the window. The
+// left button is a finger. Holding the modifier while pressing the
+// left button adds a second finger mirrored around the center of the
+// window, to pinch and rotate. The right button is a finger too, so
+// pressing both buttons gives two independent fingers.
+//
+// It replaces the mouse callbacks installed by the framework, so
+// mandala.ActionUpDownEvent and mandala.ActionMoveEvent aren't sent
+// anymore. Callbacks installed afterwards can forward the mouse
+// events to the returned emulation.
+func EmulateTouch(window *glfw.Window, tracker *Tracker) *Mouse {
+	m := &Mouse{tracker: tracker, window: window}
+	window.SetMouseButtonCallback(m.Button)
+	window.SetCursorPositionCallback(m.Cursor)
+	return m
+}
+
+// freePointer returns the pointer not used by the other button.
+func freePointer(otherDown bool, other PointerID) PointerID {
+	if otherDown && other == MousePointer {
+		return SecondPointer
+	}
+	return MousePointer
+}
+
+func (m *Mouse) mirror(x, y float32) (float32, float32) {
+	w, h := m.window.GetSize()
+	return float32(w) - x, float32(h) - y
+}
+
+// Button is the mouse button callback of the emulation.
+func (m *Mouse) Button(window *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+	x64, y64 := window.GetCursorPosition()
+	x, y := float32(x64), float32(y64)
+	now := time.Now()
+	down := action == glfw.Press
+
+	switch button {
+	case glfw.MouseButtonLeft:
+		if down == m.left {
+			return
+		}
+		m.left = down
+		if down {
+			m.leftID = freePointer(m.right, m.rightID)
+			m.tracker.Down(m.leftID, x, y, now)
+			if !m.right && mods&EmulationModifier != 0 {
+				m.mirrored = true
+				mx, my := m.mirror(x, y)
+				m.tracker.Down(SecondPointer, mx, my, now)
+			}
+		} else {
+			m.tracker.Up(m.leftID, x, y, now)
+			if m.mirrored {
+				m.mirrored = false
+				mx, my := m.mirror(x, y)
+				m.tracker.Up(SecondPointer, mx, my, now)
+			}
+		}
+
+	case glfw.MouseButtonRight:
+		if down == m.right || m.mirrored {
+			return
+		}
+		m.right = down
+		if down {
+			m.rightID = freePointer(m.left, m.leftID)
+			m.tracker.Down(m.rightID, x, y, now)
+		} else {
+			m.tracker.Up(m.rightID, x, y, now)
+		}
+	}
+}
+
+// Cursor is the cursor position callback of the emulation.
+func (m *Mouse) Cursor(window *glfw.Window, x64, y64 float64) {
+	x, y := float32(x64), float32(y64)
+	now := time.Now()
+	if m.left {
+		m.tracker.Move(m.leftID, x, y, now)
+		if m.mirrored {
+			mx, my := m.mirror(x, y)
+			m.tracker.Move(SecondPointer, mx, my, now)
+		}
+	}
+	if m.right {
+		m.tracker.Move(m.rightID, x, y, now)
+	}
+}
@@ -0,0 +1,294 @@
+// Package input tracks the pointers touching the screen. It turns
+// the raw events of the framework, or of the mouse on desktop, into
+// consistent down, move and up streams with a pointer ID, the
+// position where the pointer went down, its velocity and
+// timestamps.
+package input
+
+import (
+	"sync"
+	"time"
+
+	"github.com/remogatto/mandala"
+)
+
+const (
+	// The number of events buffered before moves are dropped
+	DefaultBufferSize = 64
+
+	// How much the last movement weighs on the velocity of a
+	// pointer, from 0 to 1
+	velocitySmoothing = 0.5
+
+	// How often the events not delivered because the buffer was
+	// full are sent again
+	retryInterval = 10 * time.Millisecond
+)
+
+// PointerID identifies a pointer while it's down.
+type PointerID int
+
+// Action is what a pointer did.
+type Action int
+
+const (
+	Down Action = iota
+	Move
+	Up
+)
+
+func (a Action) String() string {
+	switch a {
+	case Down:
+		return "down"
+	case Move:
+		return "move"
+	case Up:
+		return "up"
+	}
+	return "unknown"
+}
+
+// Pointer is the state of a finger, or of an emulated finger, on the
+// screen. Coordinates are in window pixels with y growing downward.
+type Pointer struct {
+	ID PointerID
+
+	StartX, StartY float32
+	X, Y           float32
+
+	// The velocity in pixels/s
+	VX, VY float32
+
+	// When the pointer went down and when it last changed
+	StartTime, Time time.Time
+}
+
+// Duration returns for how long the pointer has been down.
+func (p Pointer) Duration() time.Duration {
+	return p.Time.Sub(p.StartTime)
+}
+
+// Event is a change of a pointer. Pointer is a snapshot of the
+// state of the pointer after the change.
+type Event struct {
+	Action  Action
+	Pointer Pointer
+}
+
+// MotionAction is the action of an Android motion event, as
+// returned by MotionEvent.getActionMasked.
+type MotionAction int
+
+const (
+	MotionDown        MotionAction = 0
+	MotionUp          MotionAction = 1
+	MotionMove        MotionAction = 2
+	MotionCancel      MotionAction = 3
+	MotionPointerDown MotionAction = 5
+	MotionPointerUp   MotionAction = 6
+)
+
+// Tracker keeps the state of the active pointers and delivers their
+// events. The methods feeding the tracker can be called from any
+// goroutine and never block. A pointer always goes down before
+// moving, and always goes up, even if the source loses track of it.
+//
+// When the buffer is full moves are dropped, the next event of the
+// pointer carrying its position, while downs and ups are kept and
+// delivered in order as soon as there's room.
+type Tracker struct {
+	mutex    sync.Mutex
+	pointers map[PointerID]*Pointer
+	events   chan Event
+
+	// The downs and ups not delivered yet and whether sending
+	// them again is scheduled
+	pending  []Event
+	retrying bool
+}
+
+// NewTracker returns a tracker buffering up to bufferSize events.
+func NewTracker(bufferSize int) *Tracker {
+	return &Tracker{
+		pointers: make(map[PointerID]*Pointer),
+		events:   make(chan Event, bufferSize),
+	}
+}
+
+// Events returns the channel delivering the events.
+func (t *Tracker) Events() <-chan Event {
+	return t.events
+}
+
+// Down puts a pointer down at the given position. If the pointer
+// is already down it goes up first.
+func (t *Tracker) Down(id PointerID, x, y float32, when time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if p, ok := t.pointers[id]; ok {
+		t.send(Event{Up, *p})
+	}
+	p := &Pointer{
+		ID:        id,
+		StartX:    x,
+		StartY:    y,
+		X:         x,
+		Y:         y,
+		StartTime: when,
+		Time:      when,
+	}
+	t.pointers[id] = p
+	t.send(Event{Down, *p})
+}
+
+// Move moves a pointer. Moving a pointer that isn't down does
+// nothing.
+func (t *Tracker) Move(id PointerID, x, y float32, when time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if p, ok := t.pointers[id]; ok {
+		t.update(p, x, y, when)
+		t.send(Event{Move, *p})
+	}
+}
+
+// Up lifts a pointer. Lifting a pointer that isn't down does
+// nothing.
+func (t *Tracker) Up(id PointerID, x, y float32, when time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if p, ok := t.pointers[id]; ok {
+		t.update(p, x, y, when)
+		t.send(Event{Up, *p})
+		delete(t.pointers, id)
+	}
+}
+
+// Cancel lifts all the pointers where they are, i.e. when the
+// application is paused.
+func (t *Tracker) Cancel(when time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cancel(when)
+}
+
+func (t *Tracker) cancel(when time.Time) {
+	for id, p := range t.pointers {
+		p.Time = when
+		t.send(Event{Up, *p})
+		delete(t.pointers, id)
+	}
+}
+
+// Pointers returns a snapshot of the pointers currently down.
+func (t *Tracker) Pointers() []Pointer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	pointers := make([]Pointer, 0, len(t.pointers))
+	for _, p := range t.pointers {
+		pointers = append(pointers, *p)
+	}
+	return pointers
+}
+
+// Motion feeds the tracker with a pointer of an Android motion
+// event. A down of the first pointer starts a new gesture: the
+// pointers the source lost track of go up first.
+func (t *Tracker) Motion(action MotionAction, id PointerID, x, y float32, when time.Time) {
+	switch action {
+	case MotionDown:
+		t.mutex.Lock()
+		t.cancel(when)
+		t.mutex.Unlock()
+		t.Down(id, x, y, when)
+	case MotionPointerDown:
+		t.Down(id, x, y, when)
+	case MotionMove:
+		t.Move(id, x, y, when)
+	case MotionUp, MotionPointerUp:
+		t.Up(id, x, y, when)
+	case MotionCancel:
+		t.Cancel(when)
+	}
+}
+
+// Translate feeds the tracker with the touch events of the
+// framework and returns true if the event was one of them.
+//
+// The events of the framework carry no pointer index, so only the
+// primary pointer is tracked, always with ID 0. On Android the
+// examples take the touches from the framework with TouchActivity,
+// which reports every pointer to Motion; see TrackMotions.
+func (t *Tracker) Translate(event interface{}) bool {
+	now := time.Now()
+	switch e := event.(type) {
+	case mandala.ActionUpDownEvent:
+		if e.Down {
+			t.Down(0, e.X, e.Y, now)
+		} else {
+			t.Up(0, e.X, e.Y, now)
+		}
+	case mandala.ActionMoveEvent:
+		t.Move(0, e.X, e.Y, now)
+	default:
+		return false
+	}
+	return true
+}
+
+func (t *Tracker) update(p *Pointer, x, y float32, when time.Time) {
+	if dt := float32(when.Sub(p.Time).Seconds()); dt > 0 {
+		p.VX += velocitySmoothing * ((x-p.X)/dt - p.VX)
+		p.VY += velocitySmoothing * ((y-p.Y)/dt - p.VY)
+	}
+	p.X, p.Y = x, y
+	p.Time = when
+}
+
+// send delivers an event without blocking. It's called with the
+// mutex locked.
+func (t *Tracker) send(e Event) {
+	t.flush()
+	if len(t.pending) == 0 {
+		select {
+		case t.events <- e:
+			return
+		default:
+		}
+	}
+	if e.Action == Move {
+		return
+	}
+	t.pending = append(t.pending, e)
+	if !t.retrying {
+		t.retrying = true
+		time.AfterFunc(retryInterval, t.retry)
+	}
+}
+
+// flush delivers the pending events the buffer has room for. It's
+// called with the mutex locked.
+func (t *Tracker) flush() {
+	for len(t.pending) > 0 {
+		select {
+		case t.events <- t.pending[0]:
+			t.pending = t.pending[1:]
+		default:
+			return
+		}
+	}
+	t.pending = nil
+}
+
+// retry delivers the pending events until there are none left.
+func (t *Tracker) retry() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.flush()
+	if len(t.pending) > 0 {
+		time.AfterFunc(retryInterval, t.retry)
+		return
+	}
+	t.retrying = false
+}
@@ -0,0 +1,189 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// step is a synthetic pointer event. The motion steps go through
+// Motion, the others through the method with the same name.
+type step struct {
+	ms     int
+	action string
+	motion MotionAction
+	id     PointerID
+	x, y   float32
+}
+
+func down(ms int, id PointerID, x, y float32) step {
+	return step{ms: ms, action: "down", id: id, x: x, y: y}
+}
+
+func move(ms int, id PointerID, x, y float32) step {
+	return step{ms: ms, action: "move", id: id, x: x, y: y}
+}
+
+func up(ms int, id PointerID, x, y float32) step {
+	return step{ms: ms, action: "up", id: id, x: x, y: y}
+}
+
+func cancel(ms int) step {
+	return step{ms: ms, action: "cancel"}
+}
+
+func motion(ms int, action MotionAction, id PointerID, x, y float32) step {
+	return step{ms: ms, action: "motion", motion: action, id: id, x: x, y: y}
+}
+
+// feed feeds the steps to the tracker.
+func feed(tracker *Tracker, steps []step) {
+	start := time.Unix(0, 0)
+	for _, s := range steps {
+		when := start.Add(time.Duration(s.ms) * time.Millisecond)
+		switch s.action {
+		case "down":
+			tracker.Down(s.id, s.x, s.y, when)
+		case "move":
+			tracker.Move(s.id, s.x, s.y, when)
+		case "up":
+			tracker.Up(s.id, s.x, s.y, when)
+		case "cancel":
+			tracker.Cancel(when)
+		case "motion":
+			tracker.Motion(s.motion, s.id, s.x, s.y, when)
+		}
+	}
+}
+
+// received returns the events buffered, as "action id x,y".
+func received(tracker *Tracker) []string {
+	var events []string
+	for len(tracker.Events()) > 0 {
+		e := <-tracker.Events()
+		events = append(events, fmt.Sprintf("%s %d %g,%g", e.Action, e.Pointer.ID, e.Pointer.X, e.Pointer.Y))
+	}
+	return events
+}
+
+var trackerTests = []struct {
+	name  string
+	steps []step
+	want  []string
+}{
+	{
+		name:  "down, move and up",
+		steps: []step{down(0, 0, 1, 2), move(10, 0, 3, 4), up(20, 0, 5, 6)},
+		want:  []string{"down 0 1,2", "move 0 3,4", "up 0 5,6"},
+	},
+	{
+		name:  "a pointer that isn't down doesn't move or go up",
+		steps: []step{move(0, 0, 1, 2), up(10, 0, 1, 2)},
+		want:  nil,
+	},
+	{
+		name:  "a pointer down again goes up first",
+		steps: []step{down(0, 0, 1, 2), down(10, 0, 3, 4)},
+		want:  []string{"down 0 1,2", "up 0 1,2", "down 0 3,4"},
+	},
+	{
+		name: "pointers are tracked by id",
+		steps: []step{
+			down(0, 0, 1, 1), down(5, 1, 9, 9),
+			move(10, 1, 8, 8), up(20, 0, 2, 2), up(30, 1, 7, 7),
+		},
+		want: []string{"down 0 1,1", "down 1 9,9", "move 1 8,8", "up 0 2,2", "up 1 7,7"},
+	},
+	{
+		name:  "cancel lifts the pointers where they are",
+		steps: []step{down(0, 0, 1, 2), move(10, 0, 3, 4), cancel(20), up(30, 0, 5, 6)},
+		want:  []string{"down 0 1,2", "move 0 3,4", "up 0 3,4"},
+	},
+	{
+		name: "motion events",
+		steps: []step{
+			motion(0, MotionDown, 0, 1, 1),
+			motion(5, MotionPointerDown, 3, 9, 9),
+			motion(10, MotionMove, 0, 2, 2),
+			motion(10, MotionMove, 3, 8, 8),
+			motion(20, MotionPointerUp, 0, 2, 2),
+			motion(30, MotionUp, 3, 7, 7),
+		},
+		want: []string{"down 0 1,1", "down 3 9,9", "move 0 2,2", "move 3 8,8", "up 0 2,2", "up 3 7,7"},
+	},
+	{
+		name: "a motion down lifts the pointers lost",
+		steps: []step{
+			motion(0, MotionDown, 0, 1, 1),
+			motion(10, MotionDown, 0, 5, 5),
+		},
+		want: []string{"down 0 1,1", "up 0 1,1", "down 0 5,5"},
+	},
+	{
+		name: "a motion cancel lifts all the pointers",
+		steps: []step{
+			motion(0, MotionDown, 0, 1, 1),
+			motion(10, MotionCancel, 0, 2, 2),
+			motion(10, MotionCancel, 0, 2, 2),
+		},
+		want: []string{"down 0 1,1", "up 0 1,1"},
+	},
+}
+
+func TestTracker(t *testing.T) {
+	for _, test := range trackerTests {
+		tracker := NewTracker(DefaultBufferSize)
+		feed(tracker, test.steps)
+		if got := received(tracker); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	tracker := NewTracker(DefaultBufferSize)
+	feed(tracker, []step{down(0, 0, 0, 0), move(100, 0, 10, 0), move(200, 0, 20, -10)})
+	p := tracker.Pointers()[0]
+
+	// 100 px/s then 100,-100 px/s, each weighing half
+	if p.VX != 75 || p.VY != -50 {
+		t.Errorf("velocity %g,%g, want 75,-50", p.VX, p.VY)
+	}
+	if p.StartX != 0 || p.Duration() != 200*time.Millisecond {
+		t.Errorf("started at %g %v ago, want 0 200ms ago", p.StartX, p.Duration())
+	}
+}
+
+func TestFullBufferDoesntBlock(t *testing.T) {
+	tracker := NewTracker(1)
+	done := make(chan bool)
+	go func() {
+		feed(tracker, []step{
+			down(0, 0, 1, 1), move(10, 0, 2, 2), move(20, 0, 3, 3),
+			down(30, 1, 4, 4), up(40, 0, 5, 5), up(50, 1, 6, 6),
+		})
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the tracker blocked on a full buffer")
+	}
+
+	// The moves are dropped, the downs and ups are delivered in
+	// order as the buffer empties
+	want := []string{"down 0 1,1", "down 1 4,4", "up 0 5,5", "up 1 6,6"}
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case e := <-tracker.Events():
+			got = append(got, fmt.Sprintf("%s %d %g,%g", e.Action, e.Pointer.ID, e.Pointer.X, e.Pointer.Y))
+		case <-time.After(time.Second):
+			t.Fatalf("got %q, the rest wasn't delivered", got)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package net.mandala.input;
+
+import android.app.NativeActivity;
+import android.content.pm.ActivityInfo;
+import android.content.pm.PackageManager;
+import android.os.Bundle;
+import android.view.MotionEvent;
+
+// TouchActivity reports every pointer of the touches to the Go
+// tracker. The native input queue of NativeActivity reports only the
+// primary pointer, so the touches are taken from it.
+public class TouchActivity extends NativeActivity
+{
+    @Override
+    protected void onCreate(Bundle savedInstanceState) {
+	// The native method is resolved in the library of the
+	// activity, which must be loaded from Java
+	try {
+	    ActivityInfo info = getPackageManager().getActivityInfo(getIntent().getComponent(), PackageManager.GET_META_DATA);
+	    System.loadLibrary(info.metaData.getString(META_DATA_LIB_NAME));
+	} catch (PackageManager.NameNotFoundException e) {
+	    throw new RuntimeException(e);
+	}
+
+	super.onCreate(savedInstanceState);
+
+	// Deliver the input events to the activity instead of the
+	// native input queue
+	getWindow().takeInputQueue(null);
+    }
+
+    @Override
+    public boolean dispatchTouchEvent(MotionEvent event) {
+	int action = event.getActionMasked();
+	if (action == MotionEvent.ACTION_POINTER_DOWN || action == MotionEvent.ACTION_POINTER_UP) {
+	    // Only the pointer at the action index went down or up
+	    int i = event.getActionIndex();
+	    onPointer(action, event.getPointerId(i), event.getX(i), event.getY(i));
+	} else {
+	    for (int i = 0; i < event.getPointerCount(); i++) {
+		onPointer(action, event.getPointerId(i), event.getX(i), event.getY(i));
+	    }
+	}
+	return true;
+    }
+
+    // onPointer feeds the tracker with a pointer of a motion event,
+    // the action being the one returned by getActionMasked.
+    private static native void onPointer(int action, int id, float x, float y);
+}
@@ -0,0 +1,33 @@
+// +build !android
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Dir returns the data directory of the application named app,
+// following the XDG base directory specification:
+// $XDG_DATA_HOME/app, or ~/.local/share/app if XDG_DATA_HOME isn't
+// set.
+func Dir(app string) (string, error) {
+	base := os.Getenv("XDG_DATA_HOME")
+	// Relative paths are invalid according to the specification
+	if base == "" || !filepath.IsAbs(base) {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return "", errors.New("storage: neither XDG_DATA_HOME nor HOME are set")
+		}
+		base = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(base, app), nil
+}
+
+// SharedDir returns the directory where the files meant for the
+// user, like exported reports, are written. On desktop it's the
+// data directory, which the user can already read.
+func SharedDir(app string) (string, error) {
+	return Dir(app)
+}
@@ -0,0 +1,62 @@
+// +build android
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Dir returns the files directory of the Android package,
+// /data/data/<package>/files, which only the application can
+// access. The name of the package is the name of the process, app
+// is ignored.
+func Dir(app string) (string, error) {
+	name, err := packageName()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join("/data/data", name, "files"), nil
+}
+
+// SharedDir returns the files directory of the Android package on
+// the external storage, <storage>/Android/data/<package>/files,
+// which the user can read over USB, with adb pull and from the
+// other applications. Writing there needs the
+// WRITE_EXTERNAL_STORAGE permission before Android 4.4. app is
+// ignored.
+func SharedDir(app string) (string, error) {
+	name, err := packageName()
+	if err != nil {
+		return "", err
+	}
+	base := os.Getenv("EXTERNAL_STORAGE")
+	if base == "" {
+		base = "/sdcard"
+	}
+	return filepath.Join(base, "Android", "data", name, "files"), nil
+}
+
+// packageName returns the name of the Android package, read from
+// the name of the process.
+func packageName() (string, error) {
+	cmdline, err := ioutil.ReadFile("/proc/self/cmdline")
+	if err != nil {
+		return "", err
+	}
+	name := cmdline
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	// Processes of services are named <package>:<service>
+	if i := bytes.IndexByte(name, ':'); i >= 0 {
+		name = name[:i]
+	}
+	if len(name) == 0 || bytes.IndexByte(name, '/') >= 0 {
+		return "", errors.New("storage: can't find the name of the package")
+	}
+	return string(name), nil
+}
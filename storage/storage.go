@@ -0,0 +1,302 @@
+// Package storage saves settings, progress and other user data in a
+// writable directory private to the application: the files directory
+// of the package on Android and the XDG data directory on Linux.
+//
+// Values are stored by key, each in its own file, together with the
+// version of their format. Files are replaced atomically, so a crash
+// while saving leaves the previous value in place. Data saved with an
+// older version is upgraded by the migrations registered for the key
+// when it's read.
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// The extension of the files holding the values
+	extension = ".dat"
+
+	// The header of the files: magic, version and checksum of the
+	// payload
+	magic      = "MSD1"
+	headerSize = len(magic) + 8
+)
+
+var (
+	// ErrNotFound is returned reading a key never saved.
+	ErrNotFound = errors.New("storage: key not found")
+
+	// ErrCorrupt is returned reading a file damaged or not written
+	// by this package.
+	ErrCorrupt = errors.New("storage: corrupt data")
+)
+
+// VersionError is returned reading a value saved with a version that
+// can't be upgraded to the one wanted, either because it's newer or
+// because a migration is missing.
+type VersionError struct {
+	Key            string
+	Stored, Wanted int
+}
+
+func (e *VersionError) Error() string {
+	if e.Stored > e.Wanted {
+		return fmt.Sprintf("storage: %s has version %d, newer than %d", e.Key, e.Stored, e.Wanted)
+	}
+	return fmt.Sprintf("storage: no migration of %s from version %d", e.Key, e.Stored)
+}
+
+// Migration converts the data of a key from a version to the next.
+type Migration func(data []byte) ([]byte, error)
+
+// Store is a directory of versioned values. Its methods can be
+// called from any goroutine.
+type Store struct {
+	dir string
+
+	mutex      sync.Mutex
+	migrations map[string]map[int]Migration
+}
+
+// Open opens the store of the application, creating its directory
+// if needed. See Dir.
+func Open(app string) (*Store, error) {
+	dir, err := Dir(app)
+	if err != nil {
+		return nil, err
+	}
+	return OpenDir(dir)
+}
+
+// OpenDir opens a store in the given directory, creating it if
+// needed.
+func OpenDir(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{
+		dir:        dir,
+		migrations: make(map[string]map[int]Migration),
+	}, nil
+}
+
+// Dir returns the directory of the store. Other files of the
+// application, like screenshots, can be saved there too.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Migrate registers the migration of the data of key from version
+// from to from+1.
+func (s *Store) Migrate(key string, from int, m Migration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.migrations[key] == nil {
+		s.migrations[key] = make(map[int]Migration)
+	}
+	s.migrations[key][from] = m
+}
+
+// Put saves v encoded as JSON.
+func (s *Store) Put(key string, version int, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.PutBlob(key, version, data)
+}
+
+// Get decodes the JSON value saved for key into v, upgrading it to
+// the given version.
+func (s *Store) Get(key string, version int, v interface{}) error {
+	data, err := s.GetBlob(key, version)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// PutBlob saves data.
+func (s *Store) PutBlob(key string, version int, data []byte) error {
+	filename, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return writeBlob(filename, version, data)
+}
+
+// GetBlob returns the data saved for key, upgrading it to the given
+// version. Upgraded data is saved back.
+func (s *Store) GetBlob(key string, version int) ([]byte, error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, data, err := readBlob(filename)
+	if err != nil {
+		return nil, err
+	}
+	if stored == version {
+		return data, nil
+	}
+	if stored > version {
+		return nil, &VersionError{key, stored, version}
+	}
+	for v := stored; v < version; v++ {
+		m := s.migrations[key][v]
+		if m == nil {
+			return nil, &VersionError{key, v, version}
+		}
+		if data, err = m(data); err != nil {
+			return nil, fmt.Errorf("storage: migrating %s from version %d: %s", key, v, err.Error())
+		}
+	}
+	return data, writeBlob(filename, version, data)
+}
+
+// Has returns true if a value is saved for key.
+func (s *Store) Has(key string) bool {
+	filename, err := s.filename(key)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filename)
+	return err == nil
+}
+
+// Delete removes the value saved for key, if any.
+func (s *Store) Delete(key string) error {
+	filename, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Keys returns the keys saved, sorted.
+func (s *Store) Keys() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.Mode().IsRegular() && strings.HasSuffix(name, extension) && validKey(strings.TrimSuffix(name, extension)) {
+			keys = append(keys, strings.TrimSuffix(name, extension))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// filename returns the file holding the value of key.
+func (s *Store) filename(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(s.dir, key+extension), nil
+}
+
+// validKey returns true if the key is a plain file name made of
+// letters, digits, dots, dashes and underscores.
+func validKey(key string) bool {
+	if key == "" || key[0] == '.' {
+		return false
+	}
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func writeBlob(filename string, version int, data []byte) error {
+	buf := make([]byte, headerSize+len(data))
+	copy(buf, magic)
+	binary.BigEndian.PutUint32(buf[len(magic):], uint32(version))
+	binary.BigEndian.PutUint32(buf[len(magic)+4:], crc32.ChecksumIEEE(data))
+	copy(buf[headerSize:], data)
+	return WriteFile(filename, buf, 0600)
+}
+
+func readBlob(filename string) (int, []byte, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return 0, nil, ErrNotFound
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(buf) < headerSize || string(buf[:len(magic)]) != magic {
+		return 0, nil, ErrCorrupt
+	}
+	version := int(binary.BigEndian.Uint32(buf[len(magic):]))
+	data := buf[headerSize:]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(buf[len(magic)+4:]) {
+		return 0, nil, ErrCorrupt
+	}
+	return version, data, nil
+}
+
+// WriteFile writes data to a file atomically: readers see either the
+// previous content or the new one, even if the application crashes
+// while writing.
+func WriteFile(filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Make the rename durable, where directories can be synced
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
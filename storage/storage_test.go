@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type settings struct {
+	Volume float32
+	Name   string
+}
+
+func openTemp(t *testing.T) *Store {
+	s, err := OpenDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPutGet(t *testing.T) {
+	s := openTemp(t)
+	want := settings{0.5, "player"}
+	if err := s.Put("settings", 1, &want); err != nil {
+		t.Fatal(err)
+	}
+	var got settings
+	if err := s.Get("settings", 1, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if !s.Has("settings") || s.Has("other") {
+		t.Error("Has doesn't match the keys saved")
+	}
+	keys, err := s.Keys()
+	if err != nil || !reflect.DeepEqual(keys, []string{"settings"}) {
+		t.Errorf("got keys %v and %v, want [settings]", keys, err)
+	}
+	if err := s.Delete("settings"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get("settings", 1, &got); err != ErrNotFound {
+		t.Errorf("got %v after deleting, want ErrNotFound", err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	s := openTemp(t)
+	for _, key := range []string{"", ".hidden", "../escape", "a/b", "spa ce"} {
+		if err := s.PutBlob(key, 1, nil); err == nil {
+			t.Errorf("key %q was accepted", key)
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"empty", func([]byte) []byte { return nil }},
+		{"truncated header", func(data []byte) []byte { return data[:headerSize-1] }},
+		{"wrong magic", func(data []byte) []byte {
+			data[0] = 'X'
+			return data
+		}},
+		{"flipped payload bit", func(data []byte) []byte {
+			data[len(data)-1] ^= 1
+			return data
+		}},
+		{"truncated payload", func(data []byte) []byte { return data[:len(data)-1] }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := openTemp(t)
+			if err := s.PutBlob("progress", 1, []byte(`{"level": 3}`)); err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(s.Dir(), "progress"+extension)
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filename, test.corrupt(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.GetBlob("progress", 1); err != ErrCorrupt {
+				t.Errorf("got %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	s := openTemp(t)
+	if err := s.PutBlob("progress", 3, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.GetBlob("progress", 2)
+	verr, ok := err.(*VersionError)
+	if !ok {
+		t.Fatalf("got %v, want a VersionError", err)
+	}
+	if verr.Key != "progress" || verr.Stored != 3 || verr.Wanted != 2 {
+		t.Errorf("got %+v", verr)
+	}
+	if !strings.Contains(verr.Error(), "newer") {
+		t.Errorf("the error %q doesn't say the data is newer", verr.Error())
+	}
+}
+
+func TestMissingMigration(t *testing.T) {
+	s := openTemp(t)
+	if err := s.PutBlob("progress", 1, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	s.Migrate("progress", 1, func(data []byte) ([]byte, error) {
+		return []byte("v2"), nil
+	})
+	_, err := s.GetBlob("progress", 3)
+	verr, ok := err.(*VersionError)
+	if !ok {
+		t.Fatalf("got %v, want a VersionError", err)
+	}
+	if verr.Stored != 2 || verr.Wanted != 3 {
+		t.Errorf("got %+v, want the missing migration from 2 to 3", verr)
+	}
+
+	// The data isn't written back when an upgrade fails
+	version, data, err := readBlob(filepath.Join(s.Dir(), "progress"+extension))
+	if err != nil || version != 1 || string(data) != "v1" {
+		t.Errorf("got version %d, data %q and %v, want the stored data unchanged", version, data, err)
+	}
+}
+
+func TestFailedMigration(t *testing.T) {
+	s := openTemp(t)
+	if err := s.PutBlob("progress", 1, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	s.Migrate("progress", 1, func(data []byte) ([]byte, error) {
+		return nil, errors.New("bad data")
+	})
+	if _, err := s.GetBlob("progress", 2); err == nil || !strings.Contains(err.Error(), "bad data") {
+		t.Errorf("got %v, want the error of the migration", err)
+	}
+}
+
+func TestMigrationWrittenBack(t *testing.T) {
+	s := openTemp(t)
+	if err := s.PutBlob("settings", 1, []byte(`{"Volume": 50}`)); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	// Version 2 stores the volume from 0 to 1
+	s.Migrate("settings", 1, func(data []byte) ([]byte, error) {
+		calls++
+		return bytes.Replace(data, []byte("50"), []byte("0.5"), 1), nil
+	})
+	// Version 3 adds the name
+	s.Migrate("settings", 2, func(data []byte) ([]byte, error) {
+		calls++
+		return bytes.Replace(data, []byte("}"), []byte(`, "Name": "player"}`), 1), nil
+	})
+
+	var got settings
+	if err := s.Get("settings", 3, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (settings{0.5, "player"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	version, _, err := readBlob(filepath.Join(s.Dir(), "settings"+extension))
+	if err != nil || version != 3 {
+		t.Errorf("got version %d and %v written back, want 3", version, err)
+	}
+	if err := s.Get("settings", 3, &got); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("the migrations ran %d times, want 2", calls)
+	}
+}
+
+func TestWriteFileLeavesNoTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil || string(data) != "second" {
+		t.Errorf("got %q and %v, want the last content", data, err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("got %d files, want only the file written", len(infos))
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want 0600", info.Mode().Perm())
+	}
+}